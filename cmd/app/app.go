@@ -7,6 +7,7 @@ import (
 	"syscall"
 
 	"rss/configs"
+	"rss/internal/blob"
 	"rss/internal/repository"
 	"rss/internal/restapi"
 	"rss/internal/usecase"
@@ -27,8 +28,13 @@ func main() {
 	if err != nil {
 		log.Fatal().Err(err).Msg("fail new repository")
 	}
+	// хранилище архивных вложений
+	store, err := blob.New(cfg.Blob)
+	if err != nil {
+		log.Fatal().Err(err).Msg("fail new blob store")
+	}
 	// слой бизнес логики
-	uc := usecase.New(repo)
+	uc := usecase.New(repo, store, cfg.Refresh, cfg.Mail, cfg.Export)
 
 	// слой транспорта http
 	rest := restapi.New(uc, cfg.Http, log)
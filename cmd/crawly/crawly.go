@@ -2,14 +2,20 @@ package main
 
 import (
 	"context"
+	"flag"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"rss/configs"
+	"rss/internal/blob"
 	"rss/internal/crawly"
+	"rss/internal/entity"
 	"rss/internal/repository"
+	"rss/internal/sendmail"
 	"rss/logger"
+
+	"github.com/rs/zerolog"
 )
 
 func main() {
@@ -23,12 +29,27 @@ func main() {
 		log.Fatal().Err(err).Msg("fail read config")
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		replay(ctx, cfg, log, os.Args[2:])
+		return
+	}
+
 	repo, err := repository.New(ctx, cfg.PgString, log)
 	if err != nil {
 		log.Fatal().Err(err).Msg("fail new repository")
 	}
 
-	crawl := crawly.New(repo, cfg.Crawly, log)
+	store, err := blob.New(cfg.Blob)
+	if err != nil {
+		log.Fatal().Err(err).Msg("fail new blob store")
+	}
+
+	mail, err := sendmail.New(cfg.Mail)
+	if err != nil {
+		log.Fatal().Err(err).Msg("fail new mail sender")
+	}
+
+	crawl := crawly.New(repo, store, mail, cfg.Crawly, log)
 	crawl.Run()
 	log.Info().Msg("starting crawly")
 
@@ -38,3 +59,40 @@ func main() {
 	sign := <-signals
 	log.Info().Str("signal", sign.String()).Msg("stoping crawly")
 }
+
+// replay разбирает сохраненные ответы каналов без сети:
+//
+//	crawly replay [-feed pk] [-limit n]  снимки из feed_snapshot
+//	crawly replay -dir ./fixtures        файлы каталога, база не нужна
+func replay(ctx context.Context, cfg config.Config, log zerolog.Logger, args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	feedPk := fs.Int("feed", 0, "feed pk, 0 all feeds")
+	limit := fs.Int("limit", 100, "snapshots to replay")
+	dir := fs.String("dir", "", "directory of fixture files instead of database")
+	fs.Parse(args)
+
+	var snapshots []entity.Snapshot
+	if *dir != "" {
+		var err error
+		if snapshots, err = crawly.LoadFixtures(*dir); err != nil {
+			log.Fatal().Err(err).Msg("fail load fixtures")
+		}
+	} else {
+		repo, err := repository.New(ctx, cfg.PgString, log)
+		if err != nil {
+			log.Fatal().Err(err).Msg("fail new repository")
+		}
+		if snapshots, err = repo.Snapshots(ctx, *feedPk, *limit); err != nil {
+			log.Fatal().Err(err).Msg("fail load snapshots")
+		}
+	}
+
+	failed, err := crawly.Replay(snapshots, os.Stdout)
+	if err != nil {
+		log.Fatal().Err(err).Msg("fail replay")
+	}
+	log.Info().Int("snapshots", len(snapshots)).Int("failed", failed).Msg("replay done")
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -1,6 +1,19 @@
 CREATE TABLE feed (
     pk SERIAL PRIMARY KEY,
-    feed_url VARCHAR(256) UNIQUE NOT NULL
+    feed_url VARCHAR(256) UNIQUE NOT NULL,
+    archive_media BOOLEAN NOT NULL DEFAULT false,
+    media_retention_days INT NOT NULL DEFAULT 0,
+    media_max_count INT NOT NULL DEFAULT 0,
+    fetch_full_content BOOLEAN NOT NULL DEFAULT false,
+    -- rss | html | json | sitemap | newsletter, source_config селекторы для html и пути для json
+    kind VARCHAR(16) NOT NULL DEFAULT 'rss',
+    source_config JSONB NOT NULL DEFAULT '{}',
+    -- цепочка процессоров статей [{"name": "drop", "params": {"title": "..."}}]
+    processors JSONB NOT NULL DEFAULT '[]',
+    redirect_url VARCHAR(256),
+    redirect_count INT NOT NULL DEFAULT 0,
+    gone TIMESTAMP WITH TIME ZONE,
+    moved_to INT REFERENCES feed
 );
 CREATE TABLE article (
     pk SERIAL PRIMARY KEY,
@@ -9,17 +22,260 @@ CREATE TABLE article (
     source_url VARCHAR(256) UNIQUE NOT NULL,
     published TIMESTAMP WITH TIME ZONE,
     recorded TIMESTAMP WITH TIME ZONE DEFAULT transaction_timestamp(),
-    feed_pk INT REFERENCES feed NOT NULL
+    feed_pk INT REFERENCES feed NOT NULL,
+    full_content TEXT,
+    extracted TIMESTAMP WITH TIME ZONE,
+    extract_attempts INT NOT NULL DEFAULT 0,
+    content_hash VARCHAR(64) NOT NULL DEFAULT '',
+    simhash BIGINT NOT NULL DEFAULT 0,
+    cluster_pk INT,
+    -- правила пользователей уже применены crawly
+    ruled BOOLEAN NOT NULL DEFAULT false
 );
+CREATE INDEX article_cluster_pk_idx ON article (cluster_pk);
+CREATE INDEX article_unclustered_idx ON article (pk) WHERE cluster_pk IS NULL;
+CREATE INDEX article_unruled_idx ON article (pk) WHERE NOT ruled;
+-- непрочитанные сохраненных поисков
+CREATE INDEX article_recorded_idx ON article (recorded);
+-- полнотекстовый поиск и сохраненные поиски по всем статьям
+CREATE INDEX article_search_idx ON article
+    USING GIN (to_tsvector('simple', coalesce(title, '') || ' ' || coalesce(content, '')));
+CREATE TABLE article_revision (
+    pk SERIAL PRIMARY KEY,
+    article_pk INT REFERENCES article ON DELETE CASCADE NOT NULL,
+    content_hash VARCHAR(64) NOT NULL,
+    title TEXT,
+    content TEXT,
+    published TIMESTAMP WITH TIME ZONE,
+    recorded TIMESTAMP WITH TIME ZONE DEFAULT transaction_timestamp()
+);
+CREATE INDEX article_revision_article_pk_idx ON article_revision (article_pk);
+CREATE TABLE article_dead_letter (
+    pk SERIAL PRIMARY KEY,
+    source_url TEXT UNIQUE NOT NULL,
+    feed_pk INT NOT NULL,
+    reason TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 1,
+    payload JSONB NOT NULL,
+    content_hash VARCHAR(64) NOT NULL DEFAULT '',
+    simhash BIGINT NOT NULL DEFAULT 0,
+    created TIMESTAMP WITH TIME ZONE DEFAULT transaction_timestamp(),
+    updated TIMESTAMP WITH TIME ZONE DEFAULT transaction_timestamp()
+);
+CREATE TABLE enclosure (
+    pk SERIAL PRIMARY KEY,
+    article_pk INT REFERENCES article ON DELETE CASCADE NOT NULL,
+    kind VARCHAR(16) NOT NULL DEFAULT 'enclosure',
+    url TEXT NOT NULL,
+    mime_type VARCHAR(128) NOT NULL DEFAULT '',
+    length BIGINT NOT NULL DEFAULT 0,
+    duration INT NOT NULL DEFAULT 0,
+    blob_key TEXT,
+    archived TIMESTAMP WITH TIME ZONE,
+    attempts INT NOT NULL DEFAULT 0,
+    evicted BOOLEAN NOT NULL DEFAULT false,
+    UNIQUE (article_pk, url)
+);
+CREATE TABLE author (
+    pk SERIAL PRIMARY KEY,
+    name VARCHAR(256) NOT NULL,
+    email VARCHAR(256) NOT NULL DEFAULT '',
+    UNIQUE (name, email)
+);
+CREATE TABLE article_author (
+    article_pk INT REFERENCES article ON DELETE CASCADE NOT NULL,
+    author_pk INT REFERENCES author NOT NULL,
+    UNIQUE (article_pk, author_pk)
+);
+CREATE TABLE category (
+    pk SERIAL PRIMARY KEY,
+    name VARCHAR(256) UNIQUE NOT NULL
+);
+CREATE TABLE article_category (
+    article_pk INT REFERENCES article ON DELETE CASCADE NOT NULL,
+    category_pk INT REFERENCES category NOT NULL,
+    UNIQUE (article_pk, category_pk)
+);
+CREATE INDEX article_category_category_pk_idx ON article_category (category_pk);
+CREATE INDEX article_author_author_pk_idx ON article_author (author_pk);
 CREATE TABLE person (
-    pk UUID PRIMARY KEY
+    pk UUID PRIMARY KEY,
+    -- логин и пароль для сторонних клиентов (Google Reader API)
+    login VARCHAR(64) UNIQUE,
+    api_password VARCHAR(128),
+    -- md5(login:password) для Fever API
+    fever_key VARCHAR(32) UNIQUE
+);
+CREATE TABLE web_session (
+    -- sha256 токена из cookie
+    token_hash VARCHAR(64) PRIMARY KEY,
+    person_pk UUID REFERENCES person ON DELETE CASCADE NOT NULL,
+    csrf VARCHAR(64) NOT NULL,
+    expires TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE TABLE api_token (
+    -- sha256 выданного токена
+    token_hash VARCHAR(64) PRIMARY KEY,
+    person_pk UUID REFERENCES person ON DELETE CASCADE NOT NULL,
+    created TIMESTAMP WITH TIME ZONE DEFAULT transaction_timestamp()
+);
+-- папки подписок пользователя, вложенность один уровень
+CREATE TABLE folder (
+    pk SERIAL PRIMARY KEY,
+    person_pk UUID REFERENCES person ON DELETE CASCADE NOT NULL,
+    parent_pk INT REFERENCES folder ON DELETE CASCADE,
+    title VARCHAR(128) NOT NULL,
+    UNIQUE NULLS NOT DISTINCT (person_pk, parent_pk, title)
 );
 CREATE TABLE subscribe (
     person_pk UUID REFERENCES person,
     feed_pk INT REFERENCES feed,
     UNIQUE (person_pk, feed_pk),
-    viewed TIMESTAMP WITH TIME ZONE DEFAULT transaction_timestamp() - INTERVAL '1 MONTH'
+    viewed TIMESTAMP WITH TIME ZONE DEFAULT transaction_timestamp() - INTERVAL '1 MONTH',
+    folder_pk INT REFERENCES folder ON DELETE SET NULL,
+    -- настройки подписки: свое название, порядок, отложенный до muted_until канал и уведомления
+    title VARCHAR(256),
+    pinned BOOLEAN NOT NULL DEFAULT false,
+    priority INT NOT NULL DEFAULT 0,
+    muted_until TIMESTAMP WITH TIME ZONE,
+    notify BOOLEAN NOT NULL DEFAULT true
+);
+-- прочитано и избранное по статьям, read NULL значит по subscribe.viewed
+CREATE TABLE article_state (
+    person_pk UUID REFERENCES person ON DELETE CASCADE NOT NULL,
+    article_pk INT REFERENCES article ON DELETE CASCADE NOT NULL,
+    read BOOLEAN,
+    starred BOOLEAN NOT NULL DEFAULT false,
+    -- hidden и tags ставят правила пользователя
+    hidden BOOLEAN NOT NULL DEFAULT false,
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    updated TIMESTAMP WITH TIME ZONE DEFAULT transaction_timestamp(),
+    PRIMARY KEY (person_pk, article_pk)
+);
+CREATE INDEX article_state_starred_idx ON article_state (person_pk) WHERE starred;
+CREATE TABLE rule (
+    pk SERIAL PRIMARY KEY,
+    person_pk UUID REFERENCES person ON DELETE CASCADE NOT NULL,
+    title VARCHAR(128) NOT NULL,
+    condition JSONB NOT NULL,
+    actions JSONB NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created TIMESTAMP WITH TIME ZONE DEFAULT transaction_timestamp()
+);
+CREATE INDEX rule_person_idx ON rule (person_pk) WHERE enabled;
+CREATE TABLE saved_search (
+    pk SERIAL PRIMARY KEY,
+    person_pk UUID REFERENCES person ON DELETE CASCADE NOT NULL,
+    title VARCHAR(128) NOT NULL,
+    query TEXT NOT NULL DEFAULT '',
+    feeds INT[] NOT NULL DEFAULT '{}',
+    -- в нижнем регистре
+    categories TEXT[] NOT NULL DEFAULT '{}',
+    window_days INT NOT NULL DEFAULT 0,
+    alert_url TEXT NOT NULL DEFAULT '',
+    alert_email VARCHAR(256) NOT NULL DEFAULT '',
+    -- письма уходят только после подтверждения кодом, code хранит sha256 отправленного кода
+    alert_email_confirmed BOOLEAN NOT NULL DEFAULT false,
+    alert_email_code VARCHAR(64) NOT NULL DEFAULT '',
+    viewed TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT transaction_timestamp(),
+    created TIMESTAMP WITH TIME ZONE DEFAULT transaction_timestamp()
+);
+CREATE INDEX saved_search_person_idx ON saved_search (person_pk);
+CREATE TABLE digest (
+    person_pk UUID PRIMARY KEY REFERENCES person ON DELETE CASCADE,
+    email VARCHAR(256) NOT NULL,
+    frequency VARCHAR(16) NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    hour INT NOT NULL DEFAULT 8,
+    weekday INT NOT NULL DEFAULT 1,
+    last_sent TIMESTAMP WITH TIME ZONE,
+    next_send TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX digest_next_send_idx ON digest (next_send);
+-- выделение в статье: цитата с контекстом и смещения в символах по тексту без html,
+-- content_hash статьи на момент привязки, после правки статьи выделение перепривязывается по цитате
+CREATE TABLE highlight (
+    pk SERIAL PRIMARY KEY,
+    person_pk UUID REFERENCES person ON DELETE CASCADE NOT NULL,
+    article_pk INT REFERENCES article ON DELETE CASCADE NOT NULL,
+    exact TEXT NOT NULL,
+    prefix TEXT NOT NULL DEFAULT '',
+    suffix TEXT NOT NULL DEFAULT '',
+    start_pos INT NOT NULL,
+    end_pos INT NOT NULL,
+    content_hash VARCHAR(64) NOT NULL DEFAULT '',
+    -- цитаты больше нет в тексте статьи
+    orphaned BOOLEAN NOT NULL DEFAULT false,
+    created TIMESTAMP WITH TIME ZONE DEFAULT transaction_timestamp(),
+    updated TIMESTAMP WITH TIME ZONE DEFAULT transaction_timestamp()
+);
+CREATE INDEX highlight_person_idx ON highlight (person_pk, article_pk);
+-- заметка к статье или к выделению
+CREATE TABLE note (
+    pk SERIAL PRIMARY KEY,
+    person_pk UUID REFERENCES person ON DELETE CASCADE NOT NULL,
+    article_pk INT REFERENCES article ON DELETE CASCADE NOT NULL,
+    highlight_pk INT REFERENCES highlight ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    created TIMESTAMP WITH TIME ZONE DEFAULT transaction_timestamp(),
+    updated TIMESTAMP WITH TIME ZONE DEFAULT transaction_timestamp()
+);
+CREATE INDEX note_person_idx ON note (person_pk, article_pk);
+CREATE TABLE feed_snapshot (
+    pk SERIAL PRIMARY KEY,
+    feed_pk INT REFERENCES feed ON DELETE CASCADE NOT NULL,
+    url TEXT NOT NULL,
+    status INT NOT NULL,
+    headers JSONB NOT NULL DEFAULT '{}',
+    -- тело ответа сжато gzip
+    body BYTEA NOT NULL,
+    created TIMESTAMP WITH TIME ZONE DEFAULT transaction_timestamp()
+);
+CREATE INDEX feed_snapshot_feed_pk_idx ON feed_snapshot (feed_pk, pk DESC);
+CREATE TABLE inbound_address (
+    pk SERIAL PRIMARY KEY,
+    token VARCHAR(32) UNIQUE NOT NULL,
+    person_pk UUID REFERENCES person ON DELETE CASCADE NOT NULL,
+    feed_pk INT REFERENCES feed ON DELETE CASCADE NOT NULL,
+    title VARCHAR(256) NOT NULL DEFAULT '',
+    created TIMESTAMP WITH TIME ZONE DEFAULT transaction_timestamp()
+);
+CREATE INDEX inbound_address_person_pk_idx ON inbound_address (person_pk);
+CREATE TABLE notification (
+    pk SERIAL PRIMARY KEY,
+    person_pk UUID REFERENCES person ON DELETE CASCADE NOT NULL,
+    feed_pk INT REFERENCES feed,
+    kind VARCHAR(32) NOT NULL,
+    message TEXT NOT NULL,
+    created TIMESTAMP WITH TIME ZONE DEFAULT transaction_timestamp(),
+    seen BOOLEAN NOT NULL DEFAULT false
+);
+CREATE INDEX notification_person_pk_idx ON notification (person_pk) WHERE NOT seen;
+CREATE TABLE refresh_job (
+    pk SERIAL PRIMARY KEY,
+    feed_pk INT REFERENCES feed ON DELETE CASCADE NOT NULL,
+    person_pk UUID REFERENCES person,
+    status VARCHAR(16) NOT NULL DEFAULT 'queued',
+    -- пройти и страницы истории канала
+    backfill BOOLEAN NOT NULL DEFAULT false,
+    items INT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    created TIMESTAMP WITH TIME ZONE DEFAULT transaction_timestamp(),
+    started TIMESTAMP WITH TIME ZONE,
+    finished TIMESTAMP WITH TIME ZONE
 );
+-- на канал одна задача в очереди или в работе
+CREATE UNIQUE INDEX refresh_job_active_idx ON refresh_job (feed_pk) WHERE status IN ('queued', 'running');
+CREATE INDEX refresh_job_person_idx ON refresh_job (person_pk, created);
+-- crawly слушает feed_refresh и забирает задачу сразу, без ожидания опроса
+CREATE FUNCTION notify_refresh_job() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('feed_refresh', NEW.pk::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER refresh_job_notify AFTER INSERT ON refresh_job
+    FOR EACH ROW EXECUTE FUNCTION notify_refresh_job();
 INSERT INTO person (pk)
 VALUES
 ('35be0a7c-8570-4987-be59-efeac5906d74'),
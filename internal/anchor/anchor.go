@@ -0,0 +1,126 @@
+// Package anchor привязывает выделения к тексту статьи: цитата с контекстом
+// и смещения в символах по тексту без html и лишних пробелов.
+package anchor
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"rss/internal/htmltext"
+)
+
+// длина контекста prefix и suffix в символах
+const contextLen = 32
+
+// Quote цитата выделения с окружающим текстом.
+type Quote struct {
+	Exact  string
+	Prefix string
+	Suffix string
+}
+
+// Text текст статьи, по которому считаются смещения:
+// без тегов, пробельные символы схлопнуты в один пробел.
+func Text(content string) string {
+	return Normalize(htmltext.Strip(content))
+}
+
+// Normalize схлопывает пробелы, цитаты сравниваются в том же виде что и текст.
+func Normalize(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Find ищет цитату в тексте и возвращает смещения [start, end) в символах, hint -1 без подсказки.
+// Если по hint цитата на месте, берется она, иначе из всех вхождений то,
+// у которого больше совпадает контекст, при равенстве ближайшее к hint.
+func Find(text string, q Quote, hint int) (int, int, bool) {
+	exact := Normalize(q.Exact)
+	if exact == "" {
+		return 0, 0, false
+	}
+	n := utf8.RuneCountInString(exact)
+	runes := []rune(text)
+	// hint приходит от клиента, за пределами текста подсказки нет
+	if hint < 0 || hint > len(runes) {
+		hint = -1
+	}
+	if hint >= 0 && hint <= len(runes)-n && string(runes[hint:hint+n]) == exact {
+		return hint, hint + n, true
+	}
+
+	prefix, suffix := []rune(collapse(q.Prefix)), []rune(collapse(q.Suffix))
+	best, bestScore, bestDist := -1, -1, 0
+	for from := 0; ; {
+		i := strings.Index(text[from:], exact)
+		if i < 0 {
+			break
+		}
+		byteStart := from + i
+		start := utf8.RuneCountInString(text[:byteStart])
+		score := commonSuffix(runes[:start], prefix) + commonPrefix(runes[start+n:], suffix)
+		dist := abs(start - hint)
+		if score > bestScore || (score == bestScore && dist < bestDist) {
+			best, bestScore, bestDist = start, score, dist
+		}
+		_, size := utf8.DecodeRuneInString(text[byteStart:])
+		from = byteStart + size
+	}
+	if best < 0 {
+		return 0, 0, false
+	}
+	return best, best + n, true
+}
+
+// Context возвращает текст до и после выделения для будущей перепривязки.
+func Context(text string, start int, end int) (string, string) {
+	runes := []rune(text)
+	return string(runes[max(start-contextLen, 0):start]), string(runes[end:min(end+contextLen, len(runes))])
+}
+
+// collapse схлопывает пробелы как Normalize, но оставляет их по краям,
+// пробел на границе контекста тоже совпадение.
+func collapse(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// commonSuffix длина общего окончания s и ctx.
+func commonSuffix(s []rune, ctx []rune) int {
+	n := 0
+	for n < len(s) && n < len(ctx) && s[len(s)-1-n] == ctx[len(ctx)-1-n] {
+		n++
+	}
+	return n
+}
+
+// commonPrefix длина общего начала s и ctx.
+func commonPrefix(s []rune, ctx []rune) int {
+	n := 0
+	for n < len(s) && n < len(ctx) && s[n] == ctx[n] {
+		n++
+	}
+	return n
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
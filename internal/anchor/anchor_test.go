@@ -0,0 +1,103 @@
+package anchor
+
+import (
+	"math"
+	"testing"
+)
+
+func TestText(t *testing.T) {
+	got := Text("<p>Привет,\n  <b>мир</b>.</p><p>Это&nbsp;тест &amp; всё.</p>")
+	want := "Привет, мир . Это тест & всё."
+	if got != want {
+		t.Errorf("Text = %q, want %q", got, want)
+	}
+}
+
+func TestFind(t *testing.T) {
+	const text = "Привет, мир. Это тест. Снова тест и еще тест."
+	tests := []struct {
+		name  string
+		q     Quote
+		hint  int
+		start int
+		ok    bool
+	}{
+		{"single", Quote{Exact: "мир"}, -1, 8, true},
+		{"first of duplicates without context", Quote{Exact: "тест"}, -1, 17, true},
+		{"hint on the spot", Quote{Exact: "тест"}, 40, 40, true},
+		{"nearest to hint", Quote{Exact: "тест"}, 30, 29, true},
+		{"context beats distance", Quote{Exact: "тест", Prefix: "еще ", Suffix: "."}, 18, 40, true},
+		{"prefix picks duplicate", Quote{Exact: "тест", Prefix: "Снова "}, -1, 29, true},
+		{"suffix picks duplicate", Quote{Exact: "тест", Suffix: " и"}, -1, 29, true},
+		{"hint on the spot beats context", Quote{Exact: "тест", Prefix: "еще "}, 17, 17, true},
+		{"context whitespace collapsed", Quote{Exact: "тест", Prefix: "Снова\n\t ", Suffix: "  и"}, -1, 29, true},
+		{"exact whitespace collapsed", Quote{Exact: "Снова\n тест"}, -1, 23, true},
+		{"hint past the end", Quote{Exact: "тест"}, 1000, 17, true},
+		{"hint overflows", Quote{Exact: "тест"}, math.MaxInt, 17, true},
+		{"negative hint", Quote{Exact: "тест"}, math.MinInt, 17, true},
+		{"hint at the end", Quote{Exact: "тест"}, 45, 40, true},
+		{"missing", Quote{Exact: "нет такого"}, 0, 0, false},
+		{"empty", Quote{Exact: "  "}, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, ok := Find(text, tt.q, tt.hint)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if start != tt.start {
+				t.Errorf("start = %d, want %d", start, tt.start)
+			}
+			if got, want := string([]rune(text)[start:end]), Normalize(tt.q.Exact); got != want {
+				t.Errorf("text[start:end] = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestContext(t *testing.T) {
+	tests := []struct {
+		name           string
+		text           string
+		start, end     int
+		prefix, suffix string
+	}{
+		{"short text", "один два три", 5, 8, "один ", " три"},
+		{"at the start", "один два", 0, 4, "", " два"},
+		{"at the end", "один два", 5, 8, "один ", ""},
+		{
+			"clipped to 32 characters",
+			"ёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёё цитата жжжжжжжжжжжжжжжжжжжжжжжжжжжжжжжжжжжж",
+			37, 43,
+			"ёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёё ",
+			" жжжжжжжжжжжжжжжжжжжжжжжжжжжжжжж",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix, suffix := Context(tt.text, tt.start, tt.end)
+			if prefix != tt.prefix || suffix != tt.suffix {
+				t.Errorf("Context = %q, %q, want %q, %q", prefix, suffix, tt.prefix, tt.suffix)
+			}
+		})
+	}
+}
+
+// Перепривязка после правки: контекст с прошлой версии находит цитату на новом месте.
+func TestFindAfterRevision(t *testing.T) {
+	old := Text("<p>Привет, мир. Это тест.</p><p>Снова тест и еще тест.</p>")
+	start, end, _ := Find(old, Quote{Exact: "тест", Prefix: "Снова "}, -1)
+	prefix, suffix := Context(old, start, end)
+
+	revised := Text("<p>Новое начало. Привет, мир. Это тест.</p><p>Снова тест и еще тест.</p>")
+	got, _, ok := Find(revised, Quote{Exact: "тест", Prefix: prefix, Suffix: suffix}, start)
+	if !ok {
+		t.Fatal("quote not found after revision")
+	}
+	if want := start + len([]rune("Новое начало. ")); got != want {
+		t.Errorf("start = %d, want %d", got, want)
+	}
+}
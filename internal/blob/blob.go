@@ -0,0 +1,36 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"rss/configs"
+)
+
+var (
+	ErrNotFound = errors.New("blob not found")
+	ErrDisabled = errors.New("blob store disabled")
+)
+
+// Store хранилище архивных вложений.
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// New создает хранилище по конфигу,
+// для backend none возвращает nil, nil.
+func New(cfg config.BlobConfig) (Store, error) {
+	switch cfg.Backend {
+	case "", "none":
+		return nil, nil
+	case "fs":
+		return NewFS(cfg.Dir)
+	case "s3":
+		return NewS3(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey)
+	}
+	return nil, fmt.Errorf("unknown blob backend %q", cfg.Backend)
+}
@@ -0,0 +1,133 @@
+package crawly
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"rss/internal/entity"
+	"rss/internal/sendmail"
+)
+
+// сколько оповещений отправляется одновременно
+const alertWorkers = 8
+
+// alertAll отправляет оповещения параллельно, возвращается когда отправлены все.
+func (c *Crawly) alertAll(ctx context.Context, alerts []entity.SearchAlert) {
+	sem := newSemaphore(alertWorkers)
+	var wg sync.WaitGroup
+	for _, a := range alerts {
+		sem.Acquire()
+		wg.Add(1)
+		go func(a entity.SearchAlert) {
+			defer wg.Done()
+			defer sem.Release()
+			c.alert(ctx, a)
+		}(a)
+	}
+	wg.Wait()
+}
+
+// alert отправляет новые статьи сохраненного поиска на callback и почту.
+func (c *Crawly) alert(ctx context.Context, a entity.SearchAlert) {
+	log := c.log.With().Int("search", a.Search.Pk).Int("articles", len(a.Articles)).Logger()
+	if a.Search.AlertUrl != "" {
+		if err := c.alertCallback(ctx, a); err != nil {
+			log.Err(err).Str("url", a.Search.AlertUrl).Msg("alert callback")
+		}
+	}
+	if a.Search.AlertEmail != "" && a.Search.AlertEmailConfirmed {
+		if err := c.mail.Send(ctx, alertMessage(a)); err != nil {
+			log.Err(err).Msg("alert email")
+		}
+	}
+}
+
+// alertCallback POST json SearchAlert, ответ вне 2xx ошибка.
+func (c *Crawly) alertCallback(ctx context.Context, a entity.SearchAlert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.ReqTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.Search.AlertUrl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := c.alertClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+// alertMessage текстовое письмо со списком статей.
+func alertMessage(a entity.SearchAlert) sendmail.Message {
+	var b strings.Builder
+	fmt.Fprintf(&b, "New articles for saved search %q:\n\n", a.Search.Title)
+	for _, ref := range a.Articles {
+		fmt.Fprintf(&b, "%s\n%s\n\n", ref.Title, ref.SourceUrl)
+	}
+	return sendmail.Message{
+		To:      []string{a.Search.AlertEmail},
+		Subject: fmt.Sprintf("%s: %d new articles", a.Search.Title, len(a.Articles)),
+		Text:    b.String(),
+	}
+}
+
+// sendAlertConfirms отправляет коды подтверждения новым alert_email.
+// Код сначала запоминается и только потом отправляется, упавшее письмо не повторяется,
+// пользователь задает адрес заново. В письме нет текста пользователя.
+func (c *Crawly) sendAlertConfirms(ctx context.Context) error {
+	pending, err := c.repo.PendingAlertEmails(ctx, c.cfg.DigestBatch)
+	if err != nil {
+		return err
+	}
+	for _, s := range pending {
+		buf := make([]byte, 20)
+		if _, err := rand.Read(buf); err != nil {
+			return err
+		}
+		code := hex.EncodeToString(buf)
+		sum := sha256.Sum256([]byte(code))
+		claimed, err := c.repo.ClaimAlertEmail(ctx, s.Pk, s.AlertEmail, hex.EncodeToString(sum[:]))
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		if err := c.mail.Send(ctx, confirmMessage(s, code)); err != nil {
+			c.log.Err(err).Int("search", s.Pk).Msg("alert confirm email")
+		}
+	}
+	return nil
+}
+
+// confirmMessage письмо с кодом подтверждения адреса оповещений.
+func confirmMessage(s entity.SavedSearch, code string) sendmail.Message {
+	return sendmail.Message{
+		To:      []string{s.AlertEmail},
+		Subject: "Confirm saved search alerts",
+		Text: fmt.Sprintf("This address was set to receive saved search alerts.\n\n"+
+			"To confirm, send POST /searches/%d/confirm with code=%s\n\n"+
+			"If you did not request this, ignore this letter: no alerts are sent until the address is confirmed.\n",
+			s.Pk, code),
+	}
+}
@@ -0,0 +1,107 @@
+package crawly
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// rel ссылок на предыдущие страницы канала в порядке предпочтения, RFC 5005
+var pagingRels = []string{"prev-archive", "next"}
+
+// nextPage следующая страница истории канала задачи с backfill.
+// Сначала ссылки RFC 5005, у WordPress без них ?paged=N.
+// kept статей страницы ушло на запись после процессоров.
+func (c *Crawly) nextPage(f fetched, page Page, kept int) (task, bool) {
+	if !f.backfill || f.depth >= c.cfg.BackfillDepth || len(page.Articles) == 0 {
+		return task{}, false
+	}
+	next := f.task
+	next.depth++
+	next.items += kept
+
+	if link := pagingLink(f.body); link != "" {
+		base, _ := url.Parse(f.url())
+		next.page = resolveRef(base, link)
+		next.paged = 0
+		return next, next.page != "" && next.page != f.url()
+	}
+	if !strings.Contains(strings.ToLower(page.Generator), "wordpress") {
+		return task{}, false
+	}
+	if next.paged == 0 {
+		// сам канал это первая страница
+		next.paged = 1
+	}
+	next.paged++
+	paged, err := url.Parse(f.feed.FeedUrl)
+	if err != nil {
+		return task{}, false
+	}
+	q := paged.Query()
+	q.Set("paged", strconv.Itoa(next.paged))
+	paged.RawQuery = q.Encode()
+	next.page = paged.String()
+	return next, true
+}
+
+// backfill ставит страницу истории в очередь скачивания.
+// Отправка из отдельной горутины: parser не должен ждать на fetchQ,
+// иначе при полных очередях fetcher и parser ждали бы друг друга.
+func (c *Crawly) backfill(t task) {
+	c.log.Debug().Str("url", t.page).Int("depth", t.depth).Msg("backfill")
+	go func() {
+		c.fetchQ <- t
+	}()
+}
+
+// pagingLink ищет ссылку на предыдущую страницу канала среди link уровня канала,
+// ссылки внутри entry и item пропускаются. gofeed теряет rel у ссылок atom.
+func pagingLink(body []byte) string {
+	links := make(map[string]string)
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	dec.Strict = false
+
+	var inItem int
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case "entry", "item":
+				inItem++
+			case "link":
+				if inItem > 0 {
+					continue
+				}
+				var rel, href string
+				for _, attr := range el.Attr {
+					switch attr.Name.Local {
+					case "rel":
+						rel = attr.Value
+					case "href":
+						href = attr.Value
+					}
+				}
+				if _, ok := links[rel]; !ok && href != "" {
+					links[rel] = strings.TrimSpace(href)
+				}
+			}
+		case xml.EndElement:
+			if el.Name.Local == "entry" || el.Name.Local == "item" {
+				inItem--
+			}
+		}
+	}
+	for _, rel := range pagingRels {
+		if href, ok := links[rel]; ok {
+			return href
+		}
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package crawly
+
+import (
+	"context"
+	"time"
+
+	"rss/internal/entity"
+	"rss/internal/simhash"
+)
+
+// ключ advisory lock кластеризации, общий для всех инстансов crawly
+const clusterLockKey = 30_001
+
+// clusterer переодически раскладывает новые статьи по кластерам почти одинаковых сюжетов.
+// Статья попадает в кластер ближайшей по SimHash статьи за окно ClusterWindow,
+// иначе открывает свой кластер с cluster_pk равным своему pk.
+// Статьи кластера, корень которого снова не разложен, раскладываются заново.
+func (c *Crawly) clusterer() {
+	ticker := time.NewTicker(c.cfg.ClusterDelay)
+	defer ticker.Stop()
+	for {
+		<-ticker.C
+		ctx := context.TODO()
+
+		// кластеры зависят друг от друга, поэтому раскладывает один инстанс
+		_, err := c.repo.WithLock(ctx, clusterLockKey, c.cluster)
+		if err != nil {
+			c.log.Err(err).Msg("cluster")
+		}
+	}
+}
+
+func (c *Crawly) cluster(ctx context.Context) error {
+	fresh, err := c.repo.Unclustered(ctx, c.cfg.ClusterBatch)
+	if err != nil || len(fresh) == 0 {
+		return err
+	}
+	// среди новых бывают правленые корни кластеров, их соседи раскладываются заново
+	pks := make([]int, len(fresh))
+	for i, fp := range fresh {
+		pks[i] = fp.Pk
+	}
+	if err := c.repo.ReleaseClusters(ctx, pks); err != nil {
+		return err
+	}
+	known, err := c.repo.ClusterCandidates(ctx, time.Now().Add(-c.cfg.ClusterWindow))
+	if err != nil {
+		return err
+	}
+
+	for i := range fresh {
+		fresh[i].ClusterPk = c.nearestCluster(fresh[i], known)
+		if fresh[i].Simhash != 0 {
+			// следующие статьи пакета сравниваются и с этой
+			known = append(known, fresh[i])
+		}
+	}
+
+	c.log.Debug().Int("len", len(fresh)).Msg("clustered")
+	return c.repo.SetClusters(ctx, fresh)
+}
+
+// nearestCluster кластер ближайшей статьи в пределах ClusterDistance.
+func (c *Crawly) nearestCluster(fp entity.Fingerprint, known []entity.Fingerprint) int {
+	// пустой отпечаток у статей без текста, их не с чем сравнивать
+	if fp.Simhash == 0 {
+		return fp.Pk
+	}
+	cluster, best := fp.Pk, c.cfg.ClusterDistance+1
+	for _, k := range known {
+		if d := simhash.Distance(fp.Simhash, k.Simhash); d < best {
+			cluster, best = k.ClusterPk, d
+		}
+	}
+	return cluster
+}
@@ -1,58 +1,171 @@
 package crawly
 /*
 	Концепция
-	1) keeper переодически получает список rss источников из базы данных. 
-	2) множество горутин ограниченное семафором, по горутине на каждый url.
-	3) cumulative накаплевает Article к себе, при накоплении до лимита или по дедлайну сливает в базу данных.
+	Конвейер из стадий с ограниченными очередями между ними:
+	1) keeper переодически получает список rss источников из базы данных, 
+	   ставит в fetchQ каналы которые еще не в работе.
+	2) ConnLimit воркеров fetcher скачивают каналы в parseQ.
+	3) ParseWorkers воркеров parser разбирают и нормализуют item,
+	   прогоняют по цепочке процессоров канала и пишут в itemsCh.
+	4) cumulative накаплевает Article к себе, при накоплении до лимита или по дедлайну сливает в базу данных.
+	Медленная база заполняет очереди по цепочке, но не держит соединения к источникам.
+	refresher ставит в fetchQ внеочередные обновления из api, задачи приходят через postgres.
+	5) archiver при включенном хранилище скачивает вложения каналов с archive_media.
+	6) extractor извлекает полный текст статей каналов с fetch_full_content.
+	7) clusterer раскладывает статьи разных каналов про один сюжет по кластерам.
+	8) mailer принимает письма рассылок на адреса пользователей по SMTP.
+	9) ruler применяет правила подписчиков к новым статьям
+	   и оповещает о них по сохраненным поискам.
+	10) digester при настроенной почте рассылает письма с непрочитанными по расписанию пользователей.
+	На первом скачивании канала и по запросу администратора parser
+	возвращает в fetchQ страницы истории канала, пока не пройдет BackfillDepth.
 */
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
 	"time"
 
 	"rss/configs"
+	"rss/internal/blob"
 	"rss/internal/entity"
+	"rss/internal/safehttp"
+	"rss/internal/sendmail"
 
-	"github.com/mmcdole/gofeed"
 	"github.com/rs/zerolog"
 )
 
 
-const startKeeperDelay = 5 * time.Second
+const (
+	startKeeperDelay = 5 * time.Second
+	userAgent        = "rss-crawly/1.0"
+)
+
+var (
+	errFeedTooLarge = errors.New("feed too large")
+	errFeedGone     = errors.New("feed gone")
+)
 
 
 type Repository interface {
     Available(ctx context.Context) ([]entity.Feed, error)
-    AddArticle(ctx context.Context, batch []entity.Article)
+    AddArticle(ctx context.Context, batch []entity.Article) []entity.ArticleResult
+    BulkAddArticle(ctx context.Context, batch []entity.Article) (entity.BulkResult, error)
+    PendingMedia(ctx context.Context, limit int) ([]entity.MediaJob, error)
+    MarkArchived(ctx context.Context, pk int, blobKey string, length int64) error
+    ExpiredMedia(ctx context.Context, limit int) ([]entity.MediaJob, error)
+    MarkEvicted(ctx context.Context, pk int) error
+    PendingExtract(ctx context.Context, limit int) ([]entity.ExtractJob, error)
+    SaveFullContent(ctx context.Context, pk int, content string) error
+    WithLock(ctx context.Context, key int64, fn func(ctx context.Context) error) (bool, error)
+    Unclustered(ctx context.Context, limit int) ([]entity.Fingerprint, error)
+    ReleaseClusters(ctx context.Context, pks []int) error
+    ClusterCandidates(ctx context.Context, since time.Time) ([]entity.Fingerprint, error)
+    SetClusters(ctx context.Context, fps []entity.Fingerprint) error
+    ClaimRefresh(ctx context.Context, limit int) ([]entity.RefreshJob, error)
+    ReleaseRefresh(ctx context.Context, pk int) error
+    FinishRefresh(ctx context.Context, pk int, items int, errMsg string) error
+    ListenRefresh(ctx context.Context, notify func()) error
+    RecordRedirect(ctx context.Context, feedPk int, target string) (int, error)
+    ResetRedirect(ctx context.Context, feedPk int) error
+    MoveFeed(ctx context.Context, feedPk int, target string) (int, error)
+    MarkGone(ctx context.Context, feedPk int) error
+    SaveSnapshot(ctx context.Context, s entity.Snapshot, keep int) error
+    InboundFeed(ctx context.Context, token string) (entity.Feed, error)
+    Unruled(ctx context.Context, limit int) ([]entity.Article, error)
+    FeedRules(ctx context.Context, feedPks []int) (map[int][]entity.Rule, error)
+    ApplyRules(ctx context.Context, hits []entity.RuleHit, ruled []int) error
+    SearchAlerts(ctx context.Context, pks []int) ([]entity.SearchAlert, error)
+    PendingAlertEmails(ctx context.Context, limit int) ([]entity.SavedSearch, error)
+    ClaimAlertEmail(ctx context.Context, pk int, email string, codeHash string) (bool, error)
+    DueDigests(ctx context.Context, now time.Time, limit int) ([]entity.Digest, error)
+    ClaimDigest(ctx context.Context, personPk string, due time.Time, next time.Time) (bool, error)
+    Subscriptions(ctx context.Context, personPk string) ([]entity.Subscription, error)
+    Stream(ctx context.Context, personPk string, f entity.StreamFilter) ([]entity.StreamItem, error)
+    StreamCount(ctx context.Context, personPk string, f entity.StreamFilter) (int, error)
 }
 
 type Crawly struct {
-	parser *gofeed.Parser
+	client *http.Client
+	// alertClient для callback адресов пользователей, только публичные адреса
+	alertClient *http.Client
+	// mediaClient для вложений из чужих каналов, только публичные адреса
+	mediaClient *http.Client
+	// extractClient для страниц статей из чужих каналов, только публичные адреса
+	extractClient *http.Client
 	repo   Repository
+	store  blob.Store
+	mail   *sendmail.Sender
 	cfg    config.CrawlyConfig
 	log    zerolog.Logger
+	stats  stats
+
+	// очереди между стадиями
+	fetchQ  chan task
+	parseQ  chan fetched
+	itemsCh chan entity.Article
+	// каналы от постановки в fetchQ до конца разбора
+	inflight *inflight
+	// цепочки процессоров статей по каналам
+	chains *chains
 }
 
-func New(repo Repository, cfg config.CrawlyConfig, log zerolog.Logger) *Crawly {
+// New store может быть nil, тогда вложения не архивируются,
+// mail может быть nil, тогда оповещения почтой не отправляются.
+func New(repo Repository, store blob.Store, mail *sendmail.Sender, cfg config.CrawlyConfig, log zerolog.Logger) *Crawly {
 	return &Crawly{
-		parser: gofeed.NewParser(),
+		client: &http.Client{CheckRedirect: checkRedirect},
+		alertClient: safehttp.Client(cfg.ReqTimeout),
+		mediaClient: safehttp.Client(cfg.ArchiveTimeout),
+		extractClient: safehttp.Client(cfg.ExtractTimeout),
 		repo: repo,
+		store: store,
+		mail: mail,
 		cfg: cfg,
 		log: log,
+		inflight: newInflight(),
+		chains: newChains(),
 	}
 }
 
 func (c *Crawly) Run() {
-	itemsCh := make(chan entity.Article, 1)
+	c.fetchQ = make(chan task, c.cfg.FetchQueue)
+	c.parseQ = make(chan fetched, c.cfg.ParseQueue)
+	c.itemsCh = make(chan entity.Article, c.cfg.PersistQueue)
 
-	go c.keeper(itemsCh)
-	go c.cumulative(itemsCh)
+	go c.keeper()
+	go c.refresher()
+	for i := 0; i < c.cfg.ConnLimit; i++ {
+		go c.fetcher()
+	}
+	for i := 0; i < c.cfg.ParseWorkers; i++ {
+		go c.parser()
+	}
+	go c.cumulative(c.itemsCh)
+	go c.extractor()
+	go c.clusterer()
+	go c.ruler()
+	if c.store != nil {
+		go c.archiver()
+	}
+	if c.cfg.SmtpListen != "" {
+		go c.mailer()
+	}
+	if c.mail != nil {
+		go c.digester()
+	}
+	if c.cfg.MetricsPort != "" {
+		go c.serveMetrics()
+	}
 }
 
 // keeper переодически получает список rss источников
-// на каждый источник запускает горутину
-func (c *Crawly) keeper(itemsCh chan<- entity.Article) {
+// и ставит в очередь скачивания те, что еще не в работе.
+// keeper никогда не блокируется: если очередь полна, канал ждет следующего цикла.
+func (c *Crawly) keeper() {
 	ctx := context.TODO()
-	sem := newSemaphore(c.cfg.ConnLimit)
 
 	ticker := time.NewTicker(startKeeperDelay)
 	defer ticker.Stop()
@@ -66,49 +179,134 @@ func (c *Crawly) keeper(itemsCh chan<- entity.Article) {
 			c.log.Err(err).Msg("repo feed")
 		}
 
+		var queued, busy, full int
 		for _, source := range feeds {
-			sem.Acquire()
+			if !c.inflight.add(source.Pk) {
+				// прошлый цикл еще не закончил этот канал
+				busy++
+				continue
+			}
+			select {
+			case c.fetchQ <- task{feed: source}:
+				queued++
+			default:
+				c.inflight.done(source.Pk)
+				full++
+			}
+		}
+		c.log.Debug().Int("queued", queued).Int("busy", busy).Int("full", full).Msg("schedule")
+	}
+}
 
-			go func() {
-				c.requester(itemsCh, source)
-				sem.Release()
-			}()
+// fetcher скачивает канал и передает тело ответа на разбор.
+// Тело читается целиком, так что соединение освобождается до разбора и записи.
+func (c *Crawly) fetcher() {
+	for t := range c.fetchQ {
+		resp, err := c.fetch(t.url())
+		if t.page != "" {
+			// страница истории: редиректы и 410 к самому каналу не относятся,
+			// ошибка только заканчивает проход по истории
+			if err != nil {
+				c.log.Err(err).Str("url", t.page).Msg("fetch backfill page")
+				c.finish(t, t.items, nil)
+				continue
+			}
+			c.snapshot(t, resp)
+			c.parseQ <- fetched{task: t, body: resp.body}
+			continue
 		}
+		if err != nil {
+			c.log.Err(err).Str("url", t.feed.FeedUrl).Msg("fetch")
+			if errors.Is(err, errFeedGone) {
+				c.markGone(t.feed)
+			}
+			c.finish(t, 0, err)
+			continue
+		}
+		c.trackRedirect(t.feed, resp)
+		c.snapshot(t, resp)
+		c.parseQ <- fetched{task: t, body: resp.body}
 	}
 }
 
-// requester делает get запрос, каждый item из ответа пишет в канал
-func (c *Crawly) requester(itemsCh chan<- entity.Article, source entity.Feed) {
+func (c *Crawly) fetch(url string) (response, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.ReqTimeout)
 	defer cancel()
 
-	feed, err := c.parser.ParseURLWithContext(source.FeedUrl, ctx)
+	trace := &redirectTrace{}
+	ctx = context.WithValue(ctx, redirectTraceKey{}, trace)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		c.log.Err(err).Str("url", source.FeedUrl).Msg("gofeed get")
-		return
+		return response{}, err
 	}
+	req.Header.Set("User-Agent", userAgent)
 
-	for _, item := range feed.Items {
-		article := entity.Article{
-			Title: item.Title,
-			SourceUrl: item.Link,
-			FeedPk: source.Pk,
-		}
-		// нам нужна последняя дата
-		if item.UpdatedParsed != nil {
-			article.Published = *item.UpdatedParsed
-		} else {
-			article.Published = *item.PublishedParsed
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return response{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusGone {
+		return response{}, errFeedGone
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return response{}, fmt.Errorf("status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, c.cfg.FetchMaxSize+1))
+	if err != nil {
+		return response{}, err
+	}
+	if int64(len(body)) > c.cfg.FetchMaxSize {
+		return response{}, errFeedTooLarge
+	}
+	return response{
+		status:    resp.StatusCode,
+		header:    resp.Header,
+		body:      body,
+		finalUrl:  resp.Request.URL.String(),
+		permanent: trace.permanent(),
+	}, nil
+}
+
+// parser разбирает скачанные каналы источником по виду канала, каждую статью пишет в очередь записи.
+// У каждого воркера свой набор источников, gofeed.Parser не рассчитан на конкурентный вызов.
+func (c *Crawly) parser() {
+	sources := newSources()
+	for f := range c.parseQ {
+		page, kept, err := c.parse(sources, f)
+		if err != nil {
+			c.log.Err(err).Str("url", f.url()).Str("kind", f.feed.Kind).Msg("parse")
+			if f.page != "" {
+				// битая страница истории не делает задачу упавшей
+				err = nil
+			}
+			c.finish(f.task, f.items, err)
+			continue
 		}
-		// контента может не быть 
-		if item.Content != "" {
-			article.Content = item.Content
-		} else {
-			article.Content = item.Description
+		if next, ok := c.nextPage(f, page, kept); ok {
+			c.backfill(next)
+			continue
 		}
+		c.finish(f.task, f.items+kept, nil)
+	}
+}
 
-		itemsCh <- article
+// parse разбирает канал, прогоняет статьи по процессорам канала и передает на запись.
+// Возвращает страницу как есть и количество статей переданных на запись.
+func (c *Crawly) parse(sources map[string]Source, f fetched) (Page, int, error) {
+	page, err := parseBody(sources, f.feed, f.url(), f.body)
+	if err != nil {
+		return page, 0, err
+	}
+	articles := c.process(f.feed, page.Articles)
+	for _, article := range articles {
+		// при медленной записи очередь заполняется и разбор ждет,
+		// скачивание при этом ждет только на очереди разбора
+		c.itemsCh <- article
 	}
+	return page, len(articles), nil
 }
 
 // cumulative накаплевает Article к себе,
@@ -117,8 +315,15 @@ func (c *Crawly) cumulative(itemsCh <-chan entity.Article) {
 	batch := make([]entity.Article, 0, c.cfg.CumLimit)
 
 	flush := func() {
-		c.log.Debug().Int("len batch", len(batch)).Msg("flush")
-		c.repo.AddArticle(context.TODO(), batch)
+		n := c.save(context.TODO(), batch)
+		c.stats.add(n)
+
+		event := c.log.Debug()
+		if n.failed > 0 {
+			event = c.log.Warn()
+		}
+		event.Int("len batch", len(batch)).Int("inserted", n.inserted).Int("updated", n.updated).
+			Int("unchanged", n.unchanged).Int("failed", n.failed).Msg("flush")
 		// batch на переиспользование
 		batch = batch[:0]
 	}
@@ -149,4 +354,23 @@ func (c *Crawly) cumulative(itemsCh <-chan entity.Article) {
 			}
 		}
 	}
-}
\ No newline at end of file
+}
+// save пишет пакет статей, при CumBulk через COPY,
+// если массовая запись упала, то пакет повторяется по статье через AddArticle.
+func (c *Crawly) save(ctx context.Context, batch []entity.Article) flushCounts {
+	if c.cfg.CumBulk {
+		res, err := c.repo.BulkAddArticle(ctx, batch)
+		if err == nil {
+			return flushCounts{inserted: res.Inserted, updated: res.Updated, unchanged: res.Unchanged, failed: res.Failed}
+		}
+		c.log.Err(err).Int("len batch", len(batch)).Msg("bulk add article, fallback to batch")
+	}
+
+	results := c.repo.AddArticle(ctx, batch)
+	for _, res := range results {
+		if res.Status == entity.ArticleFailed {
+			c.log.Warn().Str("url", res.SourceUrl).Str("reason", res.Reason).Msg("article dead letter")
+		}
+	}
+	return countResults(results)
+}
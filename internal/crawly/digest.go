@@ -0,0 +1,79 @@
+package crawly
+
+import (
+	"context"
+	"time"
+
+	"rss/internal/digest"
+	"rss/internal/entity"
+)
+
+// ключ advisory lock рассылки, общий для всех инстансов crawly
+const digestLockKey = 30_003
+
+// digester переодически отправляет письма с непрочитанными, время которых наступило,
+// и коды подтверждения адресов оповещений сохраненных поисков.
+// Рассылка сначала переносится на следующее время и только потом отправляется,
+// так что письмо уходит не больше одного раза, упавшее ждет следующего периода.
+func (c *Crawly) digester() {
+	ticker := time.NewTicker(c.cfg.DigestDelay)
+	defer ticker.Stop()
+	for {
+		<-ticker.C
+		ctx := context.TODO()
+
+		_, err := c.repo.WithLock(ctx, digestLockKey, c.sendDigests)
+		if err != nil {
+			c.log.Err(err).Msg("digests")
+		}
+		if err := c.sendAlertConfirms(ctx); err != nil {
+			c.log.Err(err).Msg("alert confirms")
+		}
+	}
+}
+
+func (c *Crawly) sendDigests(ctx context.Context) error {
+	now := time.Now()
+	due, err := c.repo.DueDigests(ctx, now, c.cfg.DigestBatch)
+	if err != nil {
+		return err
+	}
+	for _, d := range due {
+		claimed, err := c.repo.ClaimDigest(ctx, d.PersonPk, d.NextSend, digest.Next(d, now))
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		if err := c.sendDigest(ctx, d, now); err != nil {
+			c.log.Err(err).Str("person", d.PersonPk).Msg("send digest")
+		}
+	}
+	return nil
+}
+
+// sendDigest отправляет непрочитанные, записанные за период, без них письма нет.
+func (c *Crawly) sendDigest(ctx context.Context, d entity.Digest, now time.Time) error {
+	since := digest.Period(d, now)
+	filter := entity.StreamFilter{Unread: true, RecordedSince: since, Limit: c.cfg.DigestLimit}
+	items, err := c.repo.Stream(ctx, d.PersonPk, filter)
+	if err != nil || len(items) == 0 {
+		return err
+	}
+	total, err := c.repo.StreamCount(ctx, d.PersonPk, filter)
+	if err != nil {
+		return err
+	}
+	subs, err := c.repo.Subscriptions(ctx, d.PersonPk)
+	if err != nil {
+		return err
+	}
+
+	msg, err := digest.Render(d.Email, digest.Build(d, subs, items, total, since))
+	if err != nil {
+		return err
+	}
+	c.log.Debug().Str("person", d.PersonPk).Int("articles", total).Msg("digest")
+	return c.mail.Send(ctx, msg)
+}
@@ -0,0 +1,84 @@
+package crawly
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	"rss/internal/entity"
+	"rss/internal/readability"
+)
+
+// extractor переодически забирает статьи каналов с fetch_full_content
+// и извлекает основной контент страниц, со своим лимитом конкурентности.
+func (c *Crawly) extractor() {
+	sem := newSemaphore(c.cfg.ExtractLimit)
+
+	ticker := time.NewTicker(c.cfg.ExtractDelay)
+	defer ticker.Stop()
+	for {
+		<-ticker.C
+		ctx := context.TODO()
+
+		jobs, err := c.repo.PendingExtract(ctx, c.cfg.ExtractBatch)
+		if err != nil {
+			c.log.Err(err).Msg("repo pending extract")
+			continue
+		}
+
+		// ждем весь пакет, чтобы циклы не накладывались
+		var wg sync.WaitGroup
+		for _, job := range jobs {
+			sem.Acquire()
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+				defer sem.Release()
+				c.extract(ctx, job)
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// extract скачивает страницу статьи и сохраняет ее основной контент.
+func (c *Crawly) extract(ctx context.Context, job entity.ExtractJob) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.ExtractTimeout)
+	defer cancel()
+
+	content, err := c.fetchMainContent(ctx, job.SourceUrl)
+	if err != nil {
+		c.log.Err(err).Str("url", job.SourceUrl).Msg("extract")
+		return
+	}
+	if err := c.repo.SaveFullContent(ctx, job.Pk, content); err != nil {
+		c.log.Err(err).Int("pk", job.Pk).Msg("repo save full content")
+	}
+}
+
+func (c *Crawly) fetchMainContent(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.extractClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status %s", resp.Status)
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != "" && mt != "text/html" && mt != "application/xhtml+xml" {
+		return "", fmt.Errorf("unexpected content type %s", mt)
+	}
+
+	// страница берется с финального url после редиректов
+	return readability.Extract(io.LimitReader(resp.Body, c.cfg.ExtractMaxSize), resp.Request.URL.String())
+}
@@ -0,0 +1,113 @@
+package crawly
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"rss/internal/entity"
+	"rss/internal/simhash"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// лимит длины имени автора и категории, как в таблицах
+const maxNameLen = 256
+
+// fingerprint считает хэш контента и SimHash статьи.
+func fingerprint(a *entity.Article) {
+	a.ContentHash = contentHash(*a)
+	a.Simhash = simhash.Fingerprint(a.Title, a.Content)
+}
+
+// normalize собирает статью из item канала.
+func normalize(feedPk int, item *gofeed.Item) entity.Article {
+	article := entity.Article{
+		Title: item.Title,
+		SourceUrl: item.Link,
+		FeedPk: feedPk,
+		Enclosures: enclosures(item),
+		Authors: authors(item),
+		Categories: categories(item),
+	}
+	// нам нужна последняя дата, без дат время получения
+	switch {
+	case item.UpdatedParsed != nil:
+		article.Published = *item.UpdatedParsed
+	case item.PublishedParsed != nil:
+		article.Published = *item.PublishedParsed
+	default:
+		article.Published = time.Now()
+	}
+	// контента может не быть 
+	if item.Content != "" {
+		article.Content = item.Content
+	} else {
+		article.Content = item.Description
+	}
+	return article
+}
+
+// authors собирает авторов item без повторов.
+func authors(item *gofeed.Item) []entity.Author {
+	people := item.Authors
+	if len(people) == 0 && item.Author != nil {
+		people = []*gofeed.Person{item.Author}
+	}
+
+	var res []entity.Author
+	seen := make(map[entity.Author]bool)
+	for _, p := range people {
+		if p == nil {
+			continue
+		}
+		a := entity.Author{
+			Name:  truncate(strings.TrimSpace(p.Name)),
+			Email: truncate(strings.TrimSpace(p.Email)),
+		}
+		if a.Name == "" {
+			a.Name = a.Email
+		}
+		if a.Name == "" || seen[a] {
+			continue
+		}
+		seen[a] = true
+		res = append(res, a)
+	}
+	return res
+}
+
+// categories собирает категории item без повторов без учета регистра.
+func categories(item *gofeed.Item) []string {
+	var res []string
+	seen := make(map[string]bool)
+	for _, c := range item.Categories {
+		c = truncate(strings.TrimSpace(c))
+		key := strings.ToLower(c)
+		if c == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		res = append(res, c)
+	}
+	return res
+}
+
+// truncate обрезает строку до maxNameLen рун.
+func truncate(s string) string {
+	r := []rune(s)
+	if len(r) > maxNameLen {
+		return string(r[:maxNameLen])
+	}
+	return s
+}
+
+// contentHash хэш заголовка и контента статьи.
+func contentHash(a entity.Article) string {
+	h := sha256.New()
+	h.Write([]byte(a.Title))
+	h.Write([]byte{0})
+	h.Write([]byte(a.Content))
+	return hex.EncodeToString(h.Sum(nil))
+}
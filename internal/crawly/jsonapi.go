@@ -0,0 +1,97 @@
+package crawly
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"rss/internal/entity"
+)
+
+var errJsonItems = errors.New("json item path is not an array")
+
+// jsonSource собирает статьи из ответа JSON API по путям канала:
+// item путь к массиву, например $.data.items[*], поля относительно элемента, например author.name или links[0].href.
+type jsonSource struct{}
+
+func (jsonSource) Parse(feed entity.Feed, pageUrl string, body []byte) (Page, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var root any
+	if err := dec.Decode(&root); err != nil {
+		return Page{}, err
+	}
+	cfg := feed.Source
+
+	items, ok := jsonPath(root, cfg.Item).([]any)
+	if !ok {
+		return Page{}, errJsonItems
+	}
+	base, _ := url.Parse(pageUrl)
+
+	page := Page{}
+	for _, item := range items {
+		link := jsonString(jsonPath(item, fieldPath(cfg.Link, "url")))
+		if link == "" {
+			continue
+		}
+		page.Articles = append(page.Articles, entity.Article{
+			Title:     jsonString(jsonPath(item, fieldPath(cfg.Title, "title"))),
+			SourceUrl: resolveRef(base, link),
+			Published: parseDate(jsonString(jsonPath(item, fieldPath(cfg.Date, "date"))), cfg.DateLayout),
+			Content:   jsonString(jsonPath(item, fieldPath(cfg.Content, "content"))),
+		})
+	}
+	return page, nil
+}
+
+// fieldPath путь поля или имя по умолчанию.
+func fieldPath(path, def string) string {
+	if path == "" {
+		return def
+	}
+	return path
+}
+
+// jsonPath значение по пути вида $.a.b[0].c, [*] в конце означает весь массив.
+// Пустой путь или $ это сам v.
+func jsonPath(v any, path string) any {
+	path = strings.TrimPrefix(strings.TrimSpace(path), "$")
+	path = strings.TrimSuffix(path, "[*]")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+
+	for _, key := range strings.Split(path, ".") {
+		if key == "" {
+			continue
+		}
+		switch node := v.(type) {
+		case map[string]any:
+			v = node[key]
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil
+			}
+			v = node[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+// jsonString скалярное значение строкой.
+func jsonString(v any) string {
+	switch s := v.(type) {
+	case string:
+		return strings.TrimSpace(s)
+	case json.Number:
+		return s.String()
+	case bool:
+		return strconv.FormatBool(s)
+	}
+	return ""
+}
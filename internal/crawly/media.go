@@ -0,0 +1,188 @@
+package crawly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"rss/internal/entity"
+
+	"github.com/mmcdole/gofeed"
+)
+
+var errTooLarge = errors.New("media too large")
+
+// enclosures собирает вложения item: enclosure, картинку и обложку itunes.
+func enclosures(item *gofeed.Item) []entity.Enclosure {
+	var res []entity.Enclosure
+	seen := make(map[string]bool)
+
+	add := func(e entity.Enclosure) {
+		if e.Url == "" || seen[e.Url] {
+			return
+		}
+		seen[e.Url] = true
+		res = append(res, e)
+	}
+
+	var duration int
+	if item.ITunesExt != nil {
+		duration = parseDuration(item.ITunesExt.Duration)
+	}
+
+	for _, enc := range item.Enclosures {
+		if enc == nil {
+			continue
+		}
+		length, _ := strconv.ParseInt(strings.TrimSpace(enc.Length), 10, 64)
+		add(entity.Enclosure{
+			Kind:     entity.EnclosureKindFile,
+			Url:      enc.URL,
+			MimeType: enc.Type,
+			Length:   length,
+			Duration: duration,
+		})
+	}
+	if item.Image != nil {
+		add(entity.Enclosure{Kind: entity.EnclosureKindImage, Url: item.Image.URL})
+	}
+	if item.ITunesExt != nil {
+		add(entity.Enclosure{Kind: entity.EnclosureKindImage, Url: item.ITunesExt.Image})
+	}
+	return res
+}
+
+// parseDuration разбирает itunes:duration в секунды: "SS", "MM:SS" или "HH:MM:SS".
+func parseDuration(s string) int {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0
+	}
+	var total int
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0
+		}
+		total = total*60 + n
+	}
+	return total
+}
+
+// archiver переодически скачивает вложения в хранилище
+// и удаляет вышедшие за лимиты хранения канала.
+func (c *Crawly) archiver() {
+	ticker := time.NewTicker(c.cfg.ArchiveDelay)
+	defer ticker.Stop()
+	for {
+		<-ticker.C
+		ctx := context.TODO()
+
+		jobs, err := c.repo.PendingMedia(ctx, c.cfg.ArchiveLimit)
+		if err != nil {
+			c.log.Err(err).Msg("repo pending media")
+		}
+		for _, job := range jobs {
+			c.archive(ctx, job)
+		}
+
+		expired, err := c.repo.ExpiredMedia(ctx, c.cfg.ArchiveLimit)
+		if err != nil {
+			c.log.Err(err).Msg("repo expired media")
+		}
+		for _, job := range expired {
+			if err := c.store.Delete(ctx, job.BlobKey); err != nil {
+				c.log.Err(err).Str("key", job.BlobKey).Msg("blob delete")
+				continue
+			}
+			if err := c.repo.MarkEvicted(ctx, job.Pk); err != nil {
+				c.log.Err(err).Int("pk", job.Pk).Msg("repo mark evicted")
+			}
+		}
+	}
+}
+
+// archive скачивает вложение во временный файл и кладет в хранилище.
+func (c *Crawly) archive(ctx context.Context, job entity.MediaJob) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.ArchiveTimeout)
+	defer cancel()
+
+	tmp, size, contentType, err := c.download(ctx, job.Url)
+	if err != nil {
+		c.log.Err(err).Str("url", job.Url).Msg("media download")
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if contentType == "" {
+		contentType = job.MimeType
+	}
+	key := fmt.Sprintf("media/%d/%d%s", job.FeedPk, job.Pk, mediaExt(job.Url, contentType))
+
+	if err := c.store.Put(ctx, key, tmp, size, contentType); err != nil {
+		c.log.Err(err).Str("key", key).Msg("blob put")
+		return
+	}
+	if err := c.repo.MarkArchived(ctx, job.Pk, key, size); err != nil {
+		c.log.Err(err).Int("pk", job.Pk).Msg("repo mark archived")
+	}
+}
+
+func (c *Crawly) download(ctx context.Context, url string) (*os.File, int64, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	resp, err := c.mediaClient.Do(req)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, "", fmt.Errorf("status %s", resp.Status)
+	}
+	if resp.ContentLength > c.cfg.ArchiveMaxSize {
+		return nil, 0, "", errTooLarge
+	}
+
+	tmp, err := os.CreateTemp("", "media-*")
+	if err != nil {
+		return nil, 0, "", err
+	}
+	// читаем на байт больше лимита, чтобы понять что он превышен
+	size, err := io.Copy(tmp, io.LimitReader(resp.Body, c.cfg.ArchiveMaxSize+1))
+	if err == nil && size > c.cfg.ArchiveMaxSize {
+		err = errTooLarge
+	}
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, 0, "", err
+	}
+	return tmp, size, resp.Header.Get("Content-Type"), nil
+}
+
+// mediaExt расширение файла из url или по mime типу.
+func mediaExt(rawUrl, contentType string) string {
+	ext := path.Ext(strings.SplitN(rawUrl, "?", 2)[0])
+	if ext != "" && len(ext) <= 6 {
+		return ext
+	}
+	if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package crawly
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// serveMetrics отдает глубину очередей и счетчики в текстовом формате prometheus.
+func (c *Crawly) serveMetrics() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", c.metrics)
+	mux.HandleFunc("GET /processors", c.processors)
+
+	if err := http.ListenAndServe(c.cfg.MetricsPort, mux); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		c.log.Err(err).Msg("metrics listen and serve")
+	}
+}
+
+func (c *Crawly) metrics(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	queues := []struct {
+		stage    string
+		depth    int
+		capacity int
+	}{
+		{"fetch", len(c.fetchQ), cap(c.fetchQ)},
+		{"parse", len(c.parseQ), cap(c.parseQ)},
+		{"persist", len(c.itemsCh), cap(c.itemsCh)},
+	}
+	fmt.Fprintln(w, "# TYPE crawly_queue_depth gauge")
+	for _, q := range queues {
+		fmt.Fprintf(w, "crawly_queue_depth{stage=%q} %d\n", q.stage, q.depth)
+	}
+	fmt.Fprintln(w, "# TYPE crawly_queue_capacity gauge")
+	for _, q := range queues {
+		fmt.Fprintf(w, "crawly_queue_capacity{stage=%q} %d\n", q.stage, q.capacity)
+	}
+	fmt.Fprintln(w, "# TYPE crawly_inflight_feeds gauge")
+	fmt.Fprintf(w, "crawly_inflight_feeds %d\n", c.inflight.len())
+
+	stats := c.Stats()
+	statuses := make([]string, 0, len(stats))
+	for status := range stats {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	fmt.Fprintln(w, "# TYPE crawly_articles_total counter")
+	for _, status := range statuses {
+		fmt.Fprintf(w, "crawly_articles_total{status=%q} %d\n", status, stats[status])
+	}
+
+	procs := c.chains.metrics.Stats()
+	fmt.Fprintln(w, "# TYPE crawly_processor_items_total counter")
+	for _, p := range procs {
+		fmt.Fprintf(w, "crawly_processor_items_total{processor=%q,result=\"ok\"} %d\n", p.Name, p.Processed-p.Rejected-p.Errors)
+		fmt.Fprintf(w, "crawly_processor_items_total{processor=%q,result=\"rejected\"} %d\n", p.Name, p.Rejected)
+		fmt.Fprintf(w, "crawly_processor_items_total{processor=%q,result=\"error\"} %d\n", p.Name, p.Errors)
+	}
+	fmt.Fprintln(w, "# TYPE crawly_processor_seconds_total counter")
+	for _, p := range procs {
+		fmt.Fprintf(w, "crawly_processor_seconds_total{processor=%q} %f\n", p.Name, p.Seconds)
+	}
+}
+
+// processors счетчики процессоров статей вместе с последней ошибкой.
+func (c *Crawly) processors(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.chains.metrics.Stats())
+}
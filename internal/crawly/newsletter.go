@@ -0,0 +1,231 @@
+package crawly
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"rss/internal/entity"
+	"rss/internal/sanitize"
+	"rss/internal/smtpd"
+
+	"golang.org/x/net/html/charset"
+)
+
+// mailer принимает письма рассылок по SMTP.
+// Письмо пишется в базу до ответа 250, при ошибке отправитель повторит его позже.
+func (c *Crawly) mailer() {
+	srv := &smtpd.Server{
+		Addr:     c.cfg.SmtpListen,
+		Domain:   c.cfg.SmtpDomain,
+		MaxSize:  c.cfg.MailMaxSize,
+		Timeout:  c.cfg.SmtpTimeout,
+		MaxConns: c.cfg.SmtpMaxConns,
+		Handler:  newsletters{c: c},
+		ErrorLog: func(err error) { c.log.Err(err).Msg("smtp") },
+	}
+	c.log.Info().Str("addr", c.cfg.SmtpListen).Msg("starting smtp")
+	err := srv.ListenAndServe()
+	c.log.Err(err).Msg("smtp listen")
+}
+
+// newsletters письма на адреса пользователей в статьи их каналов рассылок.
+type newsletters struct {
+	c *Crawly
+}
+
+// Recipient принимает только выданные адреса, домен не проверяется.
+func (n newsletters) Recipient(addr string) error {
+	feed, err := n.c.repo.InboundFeed(context.TODO(), inboundToken(addr))
+	if err != nil {
+		return err
+	}
+	if feed.Pk == 0 {
+		return smtpd.ErrUnknownRecipient
+	}
+	return nil
+}
+
+func (n newsletters) Deliver(from string, to []string, data []byte) error {
+	ctx := context.TODO()
+
+	article, key, err := parseMail(data)
+	if err != nil {
+		// битое письмо повторять бессмысленно, принимаем и забываем
+		n.c.log.Warn().Err(err).Str("from", from).Msg("newsletter parse")
+		return nil
+	}
+
+	var batch []entity.Article
+	for _, addr := range to {
+		token := inboundToken(addr)
+		feed, err := n.c.repo.InboundFeed(ctx, token)
+		if err != nil {
+			return err
+		}
+		if feed.Pk == 0 {
+			continue
+		}
+		a := article
+		a.FeedPk = feed.Pk
+		// одно письмо разным пользователям это разные статьи
+		a.SourceUrl = fmt.Sprintf("newsletter:%s/%s", token, key)
+		batch = append(batch, n.c.process(feed, []entity.Article{a})...)
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+
+	results := n.c.repo.AddArticle(ctx, batch)
+	n.c.stats.add(countResults(results))
+	for _, res := range results {
+		// без записи в базу 250 потеряет письмо, пусть отправитель повторит
+		if res.Status == entity.ArticleFailed && !res.Invalid {
+			return fmt.Errorf("newsletter %s: %s", res.SourceUrl, res.Reason)
+		}
+	}
+	n.c.log.Debug().Str("from", from).Int("recipients", len(batch)).Msg("newsletter")
+	return nil
+}
+
+// inboundToken локальная часть адреса.
+func inboundToken(addr string) string {
+	local, _, _ := strings.Cut(addr, "@")
+	return strings.ToLower(strings.TrimSpace(local))
+}
+
+// parseMail письмо в статью без канала, key уникален для письма.
+// Отпечатки статьи считает process.
+func parseMail(data []byte) (entity.Article, string, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return entity.Article{}, "", err
+	}
+	dec := &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+
+	subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	article := entity.Article{Title: strings.TrimSpace(subject), Published: time.Now()}
+	if date, err := msg.Header.Date(); err == nil {
+		article.Published = date
+	}
+	parser := mail.AddressParser{WordDecoder: dec}
+	if from, err := parser.Parse(msg.Header.Get("From")); err == nil {
+		article.Authors = []entity.Author{{Name: truncate(from.Name), Email: truncate(from.Address)}}
+	}
+
+	body, err := mailBody(textproto.MIMEHeader(msg.Header), msg.Body)
+	if err != nil {
+		return entity.Article{}, "", err
+	}
+	article.Content = sanitize.HTML(body)
+
+	id := msg.Header.Get("Message-Id")
+	if id == "" {
+		id = string(data)
+	}
+	sum := sha256.Sum256([]byte(id))
+	return article, hex.EncodeToString(sum[:16]), nil
+}
+
+// mailBody html письма, из multipart/alternative берется html, без него текст.
+func mailBody(header textproto.MIMEHeader, body io.Reader) (string, error) {
+	text, isHtml, err := mailPart(header, body)
+	if err != nil {
+		return "", err
+	}
+	if !isHtml {
+		text = plainHtml(text)
+	}
+	return text, nil
+}
+
+// mailPart лучшая текстовая часть и html ли она.
+func mailPart(header textproto.MIMEHeader, body io.Reader) (string, bool, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	body = transferDecode(header.Get("Content-Transfer-Encoding"), body)
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		var plain string
+		var found bool
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", false, err
+			}
+			text, isHtml, err := mailPart(part.Header, part)
+			if err != nil {
+				continue
+			}
+			if isHtml {
+				return text, true, nil
+			}
+			if !found && text != "" {
+				plain, found = text, true
+			}
+		}
+		return plain, false, nil
+	}
+	if mediaType != "text/html" && mediaType != "text/plain" {
+		// вложения не нужны
+		return "", false, nil
+	}
+
+	r, err := charset.NewReaderLabel(params["charset"], body)
+	if err != nil {
+		r = body
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", false, err
+	}
+	return string(b), mediaType == "text/html", nil
+}
+
+// transferDecode снимает base64 и quoted-printable.
+// multipart.Reader сам снимает quoted-printable и убирает заголовок.
+func transferDecode(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
+
+// plainHtml текст письма в абзацы html.
+func plainHtml(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	var b strings.Builder
+	for _, para := range strings.Split(text, "\n\n") {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+		lines := strings.Split(html.EscapeString(para), "\n")
+		b.WriteString("<p>" + strings.Join(lines, "<br/>") + "</p>\n")
+	}
+	return b.String()
+}
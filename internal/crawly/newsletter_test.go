@@ -0,0 +1,110 @@
+package crawly
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMail(t *testing.T) {
+	tests := []struct {
+		name    string
+		mail    string
+		title   string
+		content []string
+	}{
+		{
+			name:    "plain text paragraphs",
+			mail:    "Subject: Weekly\r\n\r\nfirst line\r\nsecond <b>line</b>\r\n\r\nnext paragraph\r\n",
+			title:   "Weekly",
+			content: []string{"<p>first line<br/>second &lt;b&gt;line&lt;/b&gt;</p>", "<p>next paragraph</p>"},
+		},
+		{
+			name:    "encoded subject",
+			mail:    "Subject: =?UTF-8?B?0J/RgNC40LLQtdGC?=\r\n\r\nbody\r\n",
+			title:   "Привет",
+			content: []string{"<p>body</p>"},
+		},
+		{
+			name:    "koi8-r subject and body",
+			mail:    "Subject: =?KOI8-R?Q?=F0=D2=C9=D7=C5=D4?=\r\nContent-Type: text/plain; charset=koi8-r\r\n\r\n\xf0\xd2\xc9\xd7\xc5\xd4\r\n",
+			title:   "Привет",
+			content: []string{"<p>Привет</p>"},
+		},
+		{
+			name:    "quoted-printable html",
+			mail:    "Subject: qp\r\nContent-Type: text/html; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n<p>caf=C3=A9 long=\r\n line</p>\r\n",
+			title:   "qp",
+			content: []string{"<p>café long line</p>"},
+		},
+		{
+			name:    "base64 windows-1251",
+			mail:    "Subject: b64\r\nContent-Type: text/plain; charset=windows-1251\r\nContent-Transfer-Encoding: base64\r\n\r\n7/Du4uXw6uA=\r\n",
+			title:   "b64",
+			content: []string{"<p>проверка</p>"},
+		},
+		{
+			name: "alternative prefers html",
+			mail: "Subject: alt\r\nContent-Type: multipart/alternative; boundary=b\r\n\r\n" +
+				"--b\r\nContent-Type: text/plain\r\n\r\nplain version\r\n" +
+				"--b\r\nContent-Type: text/html; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n<p>html =3D version</p><script>alert(1)</script>\r\n" +
+				"--b--\r\n",
+			title:   "alt",
+			content: []string{"<p>html = version</p>"},
+		},
+		{
+			name: "mixed falls back to text",
+			mail: "Subject: mixed\r\nContent-Type: multipart/mixed; boundary=m\r\n\r\n" +
+				"--m\r\nContent-Type: application/pdf\r\nContent-Transfer-Encoding: base64\r\n\r\nJVBERi0=\r\n" +
+				"--m\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nonly text\r\n" +
+				"--m--\r\n",
+			title:   "mixed",
+			content: []string{"<p>only text</p>"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, key, err := parseMail([]byte(tt.mail))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a.Title != tt.title {
+				t.Errorf("title %q, want %q", a.Title, tt.title)
+			}
+			for _, want := range tt.content {
+				if !strings.Contains(a.Content, want) {
+					t.Errorf("content missing %q:\n%s", want, a.Content)
+				}
+			}
+			if strings.Contains(a.Content, "script") || strings.Contains(a.Content, "plain version") {
+				t.Errorf("content has dropped parts:\n%s", a.Content)
+			}
+			if len(key) != 32 {
+				t.Errorf("key %q", key)
+			}
+		})
+	}
+}
+
+func TestParseMailHeaders(t *testing.T) {
+	mail := "Message-Id: <1@example.com>\r\nDate: Mon, 19 Oct 2026 08:00:00 +0300\r\n" +
+		"From: =?UTF-8?Q?=D0=98=D0=B2=D0=B0=D0=BD?= <news@example.com>\r\nSubject: s\r\n\r\nbody\r\n"
+	a, key, err := parseMail([]byte(mail))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.Published.Equal(time.Date(2026, 10, 19, 5, 0, 0, 0, time.UTC)) {
+		t.Errorf("published %v", a.Published)
+	}
+	if len(a.Authors) != 1 || a.Authors[0].Name != "Иван" || a.Authors[0].Email != "news@example.com" {
+		t.Errorf("authors %+v", a.Authors)
+	}
+	// ключ по Message-Id, повтор письма с другим телом тот же
+	_, again, err := parseMail([]byte(strings.Replace(mail, "body", "other", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != again {
+		t.Errorf("keys differ for one Message-Id: %s %s", key, again)
+	}
+}
@@ -0,0 +1,72 @@
+package crawly
+
+import (
+	"sync"
+
+	"rss/internal/entity"
+)
+
+// task канал в конвейере, jobPk у обновлений по запросу из api.
+type task struct {
+	feed  entity.Feed
+	jobPk int
+	// backfill задача проходит и страницы истории канала
+	backfill bool
+	// page страница истории, пустая у самого канала
+	page string
+	// depth сколько страниц истории уже пройдено
+	depth int
+	// paged номер страницы WordPress ?paged=N
+	paged int
+	// items разобрано на предыдущих страницах
+	items int
+}
+
+// url адрес, который нужно скачать.
+func (t task) url() string {
+	if t.page != "" {
+		return t.page
+	}
+	return t.feed.FeedUrl
+}
+
+// fetched скачанный канал, ждет разбора.
+type fetched struct {
+	task
+	body []byte
+}
+
+// inflight множество каналов в работе,
+// не дает медленному циклу поставить канал в очередь дважды.
+type inflight struct {
+	mu    sync.Mutex
+	feeds map[int]struct{}
+}
+
+func newInflight() *inflight {
+	return &inflight{feeds: make(map[int]struct{})}
+}
+
+// add отмечает канал в работе, false если он уже в работе.
+func (f *inflight) add(pk int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.feeds[pk]; ok {
+		return false
+	}
+	f.feeds[pk] = struct{}{}
+	return true
+}
+
+func (f *inflight) done(pk int) {
+	f.mu.Lock()
+	delete(f.feeds, pk)
+	f.mu.Unlock()
+}
+
+func (f *inflight) len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.feeds)
+}
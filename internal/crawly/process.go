@@ -0,0 +1,74 @@
+package crawly
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"rss/internal/entity"
+	"rss/internal/processor"
+)
+
+// chains цепочки процессоров каналов, пересобираются при смене настроек.
+type chains struct {
+	mu      sync.Mutex
+	feeds   map[int]cachedChain
+	metrics *processor.Metrics
+}
+
+type cachedChain struct {
+	key   string
+	chain *processor.Chain
+}
+
+func newChains() *chains {
+	return &chains{feeds: make(map[int]cachedChain), metrics: processor.NewMetrics()}
+}
+
+// get цепочка канала, битые настройки дают пустую цепочку и ошибку.
+func (c *chains) get(feed entity.Feed) (*processor.Chain, error) {
+	if len(feed.Processors) == 0 {
+		return nil, nil
+	}
+	b, _ := json.Marshal(feed.Processors)
+	key := string(b)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.feeds[feed.Pk]; ok && cached.key == key {
+		return cached.chain, nil
+	}
+	chain, err := processor.New(feed.Processors, c.metrics)
+	// запоминаем и ошибку, чтобы не собирать битую цепочку на каждый item
+	c.feeds[feed.Pk] = cachedChain{key: key, chain: chain}
+	return chain, err
+}
+
+// process прогоняет статьи канала по его цепочке процессоров до записи,
+// отброшенные убираются, отпечатки считаются по итоговому контенту.
+func (c *Crawly) process(feed entity.Feed, articles []entity.Article) []entity.Article {
+	chain, err := c.chains.get(feed)
+	if err != nil {
+		c.log.Err(err).Int("feed", feed.Pk).Msg("processor chain")
+	}
+	return runChain(context.TODO(), chain, articles, func(a entity.Article, err error) {
+		c.log.Warn().Err(err).Str("url", a.SourceUrl).Msg("processor")
+	})
+}
+
+// runChain onErr получает ошибки процессоров, статья с ошибкой не теряется.
+func runChain(ctx context.Context, chain *processor.Chain, articles []entity.Article, onErr func(entity.Article, error)) []entity.Article {
+	kept := make([]entity.Article, 0, len(articles))
+	for _, a := range articles {
+		keep, err := chain.Run(ctx, &a)
+		if err != nil {
+			onErr(a, err)
+		}
+		if !keep {
+			continue
+		}
+		fingerprint(&a)
+		kept = append(kept, a)
+	}
+	return kept
+}
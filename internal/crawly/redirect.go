@@ -0,0 +1,90 @@
+package crawly
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"rss/internal/entity"
+)
+
+// лимит редиректов как у http.Client по умолчанию
+const maxRedirects = 10
+
+// response скачанный канал и куда он в итоге привел.
+type response struct {
+	status   int
+	header   http.Header
+	body     []byte
+	finalUrl string
+	// permanent все редиректы цепочки были 301 или 308
+	permanent bool
+}
+
+type redirectTraceKey struct{}
+
+// redirectTrace статусы редиректов одного запроса.
+type redirectTrace struct {
+	statuses []int
+}
+
+func (t *redirectTrace) permanent() bool {
+	if len(t.statuses) == 0 {
+		return false
+	}
+	for _, status := range t.statuses {
+		if status != http.StatusMovedPermanently && status != http.StatusPermanentRedirect {
+			return false
+		}
+	}
+	return true
+}
+
+// checkRedirect записывает статус каждого редиректа в redirectTrace из контекста запроса.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return errors.New("stopped after 10 redirects")
+	}
+	if trace, ok := req.Context().Value(redirectTraceKey{}).(*redirectTrace); ok && req.Response != nil {
+		trace.statuses = append(trace.statuses, req.Response.StatusCode)
+	}
+	return nil
+}
+
+// trackRedirect считает подряд идущие постоянные редиректы на один адрес,
+// после RedirectThreshold переносит канал на новый адрес.
+func (c *Crawly) trackRedirect(feed entity.Feed, resp response) {
+	ctx := context.TODO()
+
+	if !resp.permanent || resp.finalUrl == feed.FeedUrl {
+		if err := c.repo.ResetRedirect(ctx, feed.Pk); err != nil {
+			c.log.Err(err).Int("feed", feed.Pk).Msg("repo reset redirect")
+		}
+		return
+	}
+
+	count, err := c.repo.RecordRedirect(ctx, feed.Pk, resp.finalUrl)
+	if err != nil {
+		c.log.Err(err).Int("feed", feed.Pk).Msg("repo record redirect")
+		return
+	}
+	if count < c.cfg.RedirectThreshold {
+		return
+	}
+
+	targetPk, err := c.repo.MoveFeed(ctx, feed.Pk, resp.finalUrl)
+	if err != nil {
+		c.log.Err(err).Int("feed", feed.Pk).Str("target", resp.finalUrl).Msg("repo move feed")
+		return
+	}
+	c.log.Info().Int("feed", feed.Pk).Int("target", targetPk).Str("url", resp.finalUrl).Msg("feed moved")
+}
+
+// markGone отмечает канал удаленным после 410, подписчики получают уведомление.
+func (c *Crawly) markGone(feed entity.Feed) {
+	if err := c.repo.MarkGone(context.TODO(), feed.Pk); err != nil {
+		c.log.Err(err).Int("feed", feed.Pk).Msg("repo mark gone")
+		return
+	}
+	c.log.Info().Int("feed", feed.Pk).Str("url", feed.FeedUrl).Msg("feed gone")
+}
@@ -0,0 +1,81 @@
+package crawly
+
+import (
+	"context"
+	"time"
+)
+
+// refresher ставит в конвейер внеочередные обновления каналов из api.
+// Задачи приходят через LISTEN/NOTIFY, опрос по RefreshPoll страхует от потерянных уведомлений.
+func (c *Crawly) refresher() {
+	wake := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	go c.listenRefresh(notify)
+
+	ticker := time.NewTicker(c.cfg.RefreshPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-wake:
+		}
+		c.claimRefresh(context.TODO())
+	}
+}
+
+// listenRefresh держит LISTEN, переподключается после ошибок соединения.
+func (c *Crawly) listenRefresh(notify func()) {
+	for {
+		err := c.repo.ListenRefresh(context.TODO(), notify)
+		c.log.Err(err).Msg("listen refresh")
+		time.Sleep(c.cfg.RefreshPoll)
+	}
+}
+
+func (c *Crawly) claimRefresh(ctx context.Context) {
+	jobs, err := c.repo.ClaimRefresh(ctx, c.cfg.RefreshBatch)
+	if err != nil {
+		c.log.Err(err).Msg("repo claim refresh")
+		return
+	}
+	for _, job := range jobs {
+		t := task{feed: job.Feed, jobPk: job.Pk, backfill: job.Backfill}
+		if !c.inflight.add(t.feed.Pk) {
+			// канал уже качается по расписанию, задача подождет
+			c.releaseRefresh(ctx, job.Pk)
+			continue
+		}
+		select {
+		case c.fetchQ <- t:
+		default:
+			c.inflight.done(t.feed.Pk)
+			c.releaseRefresh(ctx, job.Pk)
+		}
+	}
+}
+
+func (c *Crawly) releaseRefresh(ctx context.Context, pk int) {
+	if err := c.repo.ReleaseRefresh(ctx, pk); err != nil {
+		c.log.Err(err).Int("job", pk).Msg("repo release refresh")
+	}
+}
+
+// finish снимает канал с работы и закрывает задачу обновления, если она есть.
+func (c *Crawly) finish(t task, items int, err error) {
+	c.inflight.done(t.feed.Pk)
+	if t.jobPk == 0 {
+		return
+	}
+	var errMsg string
+	if err != nil {
+		errMsg = err.Error()
+	}
+	if err := c.repo.FinishRefresh(context.TODO(), t.jobPk, items, errMsg); err != nil {
+		c.log.Err(err).Int("job", t.jobPk).Msg("repo finish refresh")
+	}
+}
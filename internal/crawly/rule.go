@@ -0,0 +1,93 @@
+package crawly
+
+import (
+	"context"
+	"time"
+
+	"rss/internal/entity"
+	"rss/internal/rule"
+)
+
+// ключ advisory lock применения правил, общий для всех инстансов crawly
+const ruleLockKey = 30_002
+
+// ruler переодически применяет включенные правила подписчиков к новым статьям
+// и оповещает по сохраненным поискам. Статья обрабатывается один раз, после записи в базу,
+// правки статьи правила и оповещения не перезапускают.
+func (c *Crawly) ruler() {
+	ticker := time.NewTicker(c.cfg.RuleDelay)
+	defer ticker.Stop()
+	for {
+		<-ticker.C
+		ctx := context.TODO()
+
+		// иначе два инстанса применят правило и оповестят дважды
+		var alerts []entity.SearchAlert
+		_, err := c.repo.WithLock(ctx, ruleLockKey, func(ctx context.Context) error {
+			var err error
+			alerts, err = c.applyRules(ctx)
+			return err
+		})
+		if err != nil {
+			c.log.Err(err).Msg("rules")
+		}
+		// статьи уже отмечены, оповещения отправляются без lock и не повторяются
+		c.alertAll(ctx, alerts)
+	}
+}
+
+// applyRules применяет правила к пакету новых статей и отмечает их,
+// возвращает оповещения сохраненных поисков для отправки.
+func (c *Crawly) applyRules(ctx context.Context) ([]entity.SearchAlert, error) {
+	articles, err := c.repo.Unruled(ctx, c.cfg.RuleBatch)
+	if err != nil || len(articles) == 0 {
+		return nil, err
+	}
+
+	pks := make([]int, 0, len(articles))
+	feeds := make(map[int]bool)
+	var feedPks []int
+	for _, a := range articles {
+		pks = append(pks, a.Pk)
+		if !feeds[a.FeedPk] {
+			feeds[a.FeedPk] = true
+			feedPks = append(feedPks, a.FeedPk)
+		}
+	}
+	rules, err := c.repo.FeedRules(ctx, feedPks)
+	if err != nil {
+		return nil, err
+	}
+
+	matchers := make(map[int]*rule.Matcher)
+	var hits []entity.RuleHit
+	for i := range articles {
+		a := &articles[i]
+		for _, r := range rules[a.FeedPk] {
+			m, ok := matchers[r.Pk]
+			if !ok {
+				if m, err = rule.Compile(r.Condition); err != nil {
+					// правила проверяются при сохранении, сюда попадает только сломанное вручную
+					c.log.Err(err).Int("rule", r.Pk).Msg("compile rule")
+				}
+				matchers[r.Pk] = m
+			}
+			if m != nil && m.Match(a) {
+				hits = append(hits, entity.RuleHit{Rule: r, Article: entity.ArticleRef{
+					Pk: a.Pk, Title: a.Title, SourceUrl: a.SourceUrl, FeedPk: a.FeedPk, Published: a.Published,
+				}})
+			}
+		}
+	}
+
+	alerts, err := c.repo.SearchAlerts(ctx, pks)
+	if err != nil {
+		return nil, err
+	}
+
+	c.log.Debug().Int("len", len(articles)).Int("hits", len(hits)).Int("alerts", len(alerts)).Msg("rules applied")
+	if err := c.repo.ApplyRules(ctx, hits, pks); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
@@ -0,0 +1,97 @@
+package crawly
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"rss/internal/entity"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// htmlSource собирает статьи со страницы без канала по CSS селекторам канала.
+// Селекторы title, link, date и content ищутся внутри item,
+// без link берется первая ссылка item.
+type htmlSource struct{}
+
+func (htmlSource) Parse(feed entity.Feed, pageUrl string, body []byte) (Page, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return Page{}, err
+	}
+	base, _ := url.Parse(pageUrl)
+	cfg := feed.Source
+
+	page := Page{}
+	page.Generator, _ = doc.Find(`meta[name="generator"]`).Attr("content")
+
+	doc.Find(cfg.Item).Each(func(_ int, item *goquery.Selection) {
+		link := scrapeLink(find(item, cfg.Link), base)
+		if link == "" {
+			return
+		}
+		article := entity.Article{
+			Title:     strings.TrimSpace(find(item, cfg.Title).Text()),
+			SourceUrl: link,
+		}
+
+		date := find(item, cfg.Date)
+		if v, ok := date.Attr("datetime"); ok {
+			article.Published = parseDate(v, cfg.DateLayout)
+		} else {
+			article.Published = parseDate(date.Text(), cfg.DateLayout)
+		}
+
+		if cfg.Content != "" {
+			content := item.Find(cfg.Content).First()
+			absolutizeHtml(content, base)
+			article.Content, _ = content.Html()
+			article.Content = strings.TrimSpace(article.Content)
+		}
+		page.Articles = append(page.Articles, article)
+	})
+	return page, nil
+}
+
+// find первый элемент по селектору внутри item, без селектора сам item.
+func find(item *goquery.Selection, selector string) *goquery.Selection {
+	if selector == "" {
+		return item
+	}
+	return item.Find(selector).First()
+}
+
+// scrapeLink href элемента или первой ссылки внутри него.
+func scrapeLink(s *goquery.Selection, base *url.URL) string {
+	href, ok := s.Attr("href")
+	if !ok {
+		href, ok = s.Find("a[href]").First().Attr("href")
+	}
+	if !ok {
+		return ""
+	}
+	return resolveRef(base, href)
+}
+
+// absolutizeHtml переписывает href и src внутри элемента в абсолютные url.
+func absolutizeHtml(s *goquery.Selection, base *url.URL) {
+	for _, attr := range []string{"href", "src"} {
+		s.Find("[" + attr + "]").Each(func(_ int, el *goquery.Selection) {
+			v, _ := el.Attr(attr)
+			el.SetAttr(attr, resolveRef(base, v))
+		})
+	}
+}
+
+// resolveRef разрешает ссылку от base, битые ссылки пустые.
+func resolveRef(base *url.URL, ref string) string {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ""
+	}
+	if base == nil {
+		return u.String()
+	}
+	return base.ResolveReference(u).String()
+}
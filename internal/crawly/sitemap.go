@@ -0,0 +1,62 @@
+package crawly
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+
+	"rss/internal/entity"
+)
+
+// sitemapSource читает news sitemap: url, заголовок и дату публикации.
+// Текста в sitemap нет, его можно получить через fetch_full_content.
+type sitemapSource struct{}
+
+type sitemapUrlset struct {
+	Urls []struct {
+		Loc     string `xml:"loc"`
+		Lastmod string `xml:"lastmod"`
+		News    struct {
+			Title           string `xml:"title"`
+			PublicationDate string `xml:"publication_date"`
+			Keywords        string `xml:"keywords"`
+		} `xml:"news"`
+	} `xml:"url"`
+}
+
+func (sitemapSource) Parse(feed entity.Feed, _ string, body []byte) (Page, error) {
+	var set sitemapUrlset
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	dec.Strict = false
+	if err := dec.Decode(&set); err != nil {
+		return Page{}, err
+	}
+
+	page := Page{}
+	for _, u := range set.Urls {
+		loc := strings.TrimSpace(u.Loc)
+		if loc == "" {
+			continue
+		}
+		article := entity.Article{
+			Title:     strings.TrimSpace(u.News.Title),
+			SourceUrl: loc,
+		}
+		if article.Title == "" {
+			article.Title = loc
+		}
+		date := u.News.PublicationDate
+		if date == "" {
+			date = u.Lastmod
+		}
+		article.Published = parseDate(date, feed.Source.DateLayout)
+
+		for _, kw := range strings.Split(u.News.Keywords, ",") {
+			if kw = truncate(strings.TrimSpace(kw)); kw != "" {
+				article.Categories = append(article.Categories, kw)
+			}
+		}
+		page.Articles = append(page.Articles, article)
+	}
+	return page, nil
+}
@@ -0,0 +1,94 @@
+package crawly
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"rss/internal/entity"
+	"rss/internal/processor"
+)
+
+// snapshot сохраняет сырой ответ канала, если включен SnapshotKeep.
+func (c *Crawly) snapshot(t task, resp response) {
+	if c.cfg.SnapshotKeep <= 0 {
+		return
+	}
+	s := entity.Snapshot{
+		FeedPk:  t.feed.Pk,
+		Url:     t.url(),
+		Status:  resp.status,
+		Headers: resp.header,
+		Body:    resp.body,
+	}
+	if err := c.repo.SaveSnapshot(context.TODO(), s, c.cfg.SnapshotKeep); err != nil {
+		c.log.Err(err).Int("feed", t.feed.Pk).Msg("repo save snapshot")
+	}
+}
+
+// ReplayResult разбор одного сохраненного ответа.
+type ReplayResult struct {
+	Source   string           `json:"source"`
+	FeedPk   int              `json:"feed_pk,omitempty"`
+	Error    string           `json:"error,omitempty"`
+	Articles []entity.Article `json:"articles"`
+}
+
+// Replay заново разбирает и нормализует сохраненные ответы без сети и без записи в базу,
+// результат по строке JSON на ответ пишется в w. Возвращает количество ответов с ошибкой разбора.
+func Replay(snapshots []entity.Snapshot, w io.Writer) (int, error) {
+	sources := newSources()
+	enc := json.NewEncoder(w)
+
+	var failed int
+	for _, s := range snapshots {
+		res := ReplayResult{Source: s.Url, FeedPk: s.FeedPk, Articles: []entity.Article{}}
+		if s.Pk != 0 {
+			res.Source = fmt.Sprintf("snapshot %d %s", s.Pk, s.Url)
+		}
+		page, err := parseBody(sources, s.Feed, s.Url, s.Body)
+		if err != nil {
+			res.Error = err.Error()
+			failed++
+		} else {
+			chain, err := processor.New(s.Feed.Processors, nil)
+			if err != nil {
+				res.Error = err.Error()
+			}
+			res.Articles = runChain(context.TODO(), chain, page.Articles, func(a entity.Article, err error) {
+				res.Error = err.Error()
+			})
+		}
+		if err := enc.Encode(res); err != nil {
+			return failed, err
+		}
+	}
+	return failed, nil
+}
+
+// LoadFixtures читает каталог файлов с телами каналов, по снимку на файл.
+func LoadFixtures(dir string) ([]entity.Snapshot, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	var snapshots []entity.Snapshot
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, entity.Snapshot{Url: path, Body: body})
+	}
+	return snapshots, nil
+}
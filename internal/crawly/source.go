@@ -0,0 +1,114 @@
+package crawly
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"rss/internal/entity"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Source разбирает скачанный ответ канала в статьи, канал выбирает Source по Kind.
+// Источник не должен вызываться конкурентно, у каждого воркера parser свой набор.
+type Source interface {
+	Parse(feed entity.Feed, pageUrl string, body []byte) (Page, error)
+}
+
+// Page разобранная страница канала.
+type Page struct {
+	Articles []entity.Article
+	// Generator движок сайта, если известен, например WordPress
+	Generator string
+}
+
+// newSources набор источников для одного воркера.
+func newSources() map[string]Source {
+	return map[string]Source{
+		entity.FeedKindRss:     &rssSource{fp: gofeed.NewParser()},
+		entity.FeedKindHtml:    htmlSource{},
+		entity.FeedKindJson:    jsonSource{},
+		entity.FeedKindSitemap: sitemapSource{},
+	}
+}
+
+// parseBody разбирает ответ источником канала, отпечатки считаются после процессоров.
+func parseBody(sources map[string]Source, feed entity.Feed, pageUrl string, body []byte) (Page, error) {
+	kind := feed.Kind
+	if kind == "" {
+		kind = entity.FeedKindRss
+	}
+	src, ok := sources[kind]
+	if !ok {
+		return Page{}, fmt.Errorf("unknown feed kind %q", kind)
+	}
+	page, err := src.Parse(feed, pageUrl, body)
+	if err != nil {
+		return page, err
+	}
+	for i := range page.Articles {
+		page.Articles[i].FeedPk = feed.Pk
+	}
+	return page, nil
+}
+
+// rssSource rss, atom и json feed через gofeed.
+type rssSource struct {
+	fp *gofeed.Parser
+}
+
+func (s *rssSource) Parse(feed entity.Feed, _ string, body []byte) (Page, error) {
+	parsed, err := s.fp.Parse(bytes.NewReader(body))
+	if err != nil {
+		return Page{}, err
+	}
+	page := Page{Generator: parsed.Generator}
+	for _, item := range parsed.Items {
+		page.Articles = append(page.Articles, normalize(feed.Pk, item))
+	}
+	return page, nil
+}
+
+// форматы дат страниц без rss, после layout из настроек канала
+var dateLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"02.01.2006",
+}
+
+// parseDate разбирает дату по layout канала или известным форматам,
+// без даты время получения.
+func parseDate(v, layout string) time.Time {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return time.Now()
+	}
+	if layout != "" {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t
+		}
+	}
+	for _, l := range dateLayouts {
+		if t, err := time.Parse(l, v); err == nil {
+			return t
+		}
+	}
+	// unix время, в секундах или миллисекундах
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if n > 1e12 {
+			return time.UnixMilli(n)
+		}
+		return time.Unix(n, 0)
+	}
+	return time.Now()
+}
@@ -0,0 +1,54 @@
+package crawly
+
+import (
+	"sync/atomic"
+
+	"rss/internal/entity"
+)
+
+// stats счетчики результатов записи статей с запуска crawly.
+type stats struct {
+	inserted  atomic.Int64
+	updated   atomic.Int64
+	unchanged atomic.Int64
+	failed    atomic.Int64
+}
+
+// flushCounts результаты одного flush.
+type flushCounts struct {
+	inserted, updated, unchanged, failed int
+}
+
+func countResults(results []entity.ArticleResult) flushCounts {
+	var n flushCounts
+	for _, res := range results {
+		switch res.Status {
+		case entity.ArticleInserted:
+			n.inserted++
+		case entity.ArticleUpdated:
+			n.updated++
+		case entity.ArticleUnchanged:
+			n.unchanged++
+		case entity.ArticleFailed:
+			n.failed++
+		}
+	}
+	return n
+}
+
+func (s *stats) add(n flushCounts) {
+	s.inserted.Add(int64(n.inserted))
+	s.updated.Add(int64(n.updated))
+	s.unchanged.Add(int64(n.unchanged))
+	s.failed.Add(int64(n.failed))
+}
+
+// Stats возвращает счетчики результатов записи статей с запуска.
+func (c *Crawly) Stats() map[string]int64 {
+	return map[string]int64{
+		entity.ArticleInserted:  c.stats.inserted.Load(),
+		entity.ArticleUpdated:   c.stats.updated.Load(),
+		entity.ArticleUnchanged: c.stats.unchanged.Load(),
+		entity.ArticleFailed:    c.stats.failed.Load(),
+	}
+}
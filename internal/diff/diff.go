@@ -0,0 +1,106 @@
+package diff
+
+import (
+	"strings"
+	"unicode"
+
+	"rss/internal/entity"
+	"rss/internal/htmltext"
+)
+
+const (
+	OpEqual  = "equal"
+	OpInsert = "insert"
+	OpDelete = "delete"
+)
+
+// лимит таблицы LCS, дальше разница отдается заменой целиком
+const maxCells = 4_000_000
+
+// Text возвращает пословную разницу текстов, html теги отбрасываются.
+func Text(a, b string) []entity.DiffOp {
+	return Words(words(htmltext.Strip(a)), words(htmltext.Strip(b)))
+}
+
+// Words разница двух последовательностей слов по LCS.
+// Общие начало и конец отрезаются до построения таблицы.
+func Words(a, b []string) []entity.DiffOp {
+	var prefix, suffix int
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := &builder{}
+	ops.add(OpEqual, a[:prefix]...)
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(midA)*len(midB) > maxCells {
+		ops.add(OpDelete, midA...)
+		ops.add(OpInsert, midB...)
+	} else {
+		lcs(ops, midA, midB)
+	}
+
+	ops.add(OpEqual, a[len(a)-suffix:]...)
+	return ops.ops
+}
+
+// lcs строит таблицу длин общей подпоследовательности и проходит ее от начала.
+func lcs(ops *builder, a, b []string) {
+	n, m := len(a), len(b)
+	table := make([][]int32, n+1)
+	for i := range table {
+		table[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				table[i][j] = table[i+1][j+1] + 1
+			} else {
+				table[i][j] = max(table[i+1][j], table[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops.add(OpEqual, a[i])
+			i++
+			j++
+		case table[i+1][j] >= table[i][j+1]:
+			ops.add(OpDelete, a[i])
+			i++
+		default:
+			ops.add(OpInsert, b[j])
+			j++
+		}
+	}
+	ops.add(OpDelete, a[i:]...)
+	ops.add(OpInsert, b[j:]...)
+}
+
+// builder склеивает подряд идущие слова с одной операцией.
+type builder struct {
+	ops []entity.DiffOp
+}
+
+func (b *builder) add(op string, words ...string) {
+	if len(words) == 0 {
+		return
+	}
+	text := strings.Join(words, " ")
+	if last := len(b.ops) - 1; last >= 0 && b.ops[last].Op == op {
+		b.ops[last].Text += " " + text
+		return
+	}
+	b.ops = append(b.ops, entity.DiffOp{Op: op, Text: text})
+}
+
+func words(s string) []string {
+	return strings.FieldsFunc(s, unicode.IsSpace)
+}
@@ -0,0 +1,161 @@
+// Package digest считает расписание и собирает письма с непрочитанными статьями.
+package digest
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	htmltemplate "html/template"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+	// в образе alpine нет базы часовых поясов
+	_ "time/tzdata"
+	"unicode/utf8"
+
+	"rss/internal/entity"
+	"rss/internal/htmltext"
+	"rss/internal/sendmail"
+)
+
+// длина отрывка текста статьи в письме
+const snippetLen = 240
+
+var ErrSettings = errors.New("frequency must be daily or weekly, hour 0..23, weekday 0..6 and timezone known")
+
+//go:embed templates
+var templatesFS embed.FS
+
+var (
+	htmlTmpl = htmltemplate.Must(htmltemplate.New("digest.html").Funcs(htmltemplate.FuncMap{"snippet": snippet}).
+			ParseFS(templatesFS, "templates/digest.html"))
+	textTmpl = texttemplate.Must(texttemplate.New("digest.txt").Funcs(texttemplate.FuncMap{"snippet": snippet}).
+			ParseFS(templatesFS, "templates/digest.txt"))
+)
+
+// Validate проверяет расписание и пояс.
+func Validate(d entity.Digest) error {
+	if d.Frequency != entity.DigestDaily && d.Frequency != entity.DigestWeekly {
+		return ErrSettings
+	}
+	if d.Hour < 0 || d.Hour > 23 || d.Weekday < 0 || d.Weekday > 6 {
+		return ErrSettings
+	}
+	if _, err := time.LoadLocation(d.Timezone); err != nil {
+		return ErrSettings
+	}
+	return nil
+}
+
+// Next ближайшее время письма строго после after: начало часа Hour
+// в поясе пользователя, у еженедельного в день Weekday.
+// Дни перебираются по календарю: час, пропущенный переводом часов, сдвигается
+// на время после перевода только в этот день, а не во все следующие.
+func Next(d entity.Digest, after time.Time) time.Time {
+	loc, err := time.LoadLocation(d.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := after.In(loc)
+	for day := 0; ; day++ {
+		next := time.Date(local.Year(), local.Month(), local.Day()+day, d.Hour, 0, 0, 0, loc)
+		if d.Frequency == entity.DigestWeekly && int(next.Weekday()) != d.Weekday {
+			continue
+		}
+		if next.After(after) {
+			return next
+		}
+	}
+}
+
+// Period начало периода письма по времени записи статей: статьи, записанные
+// после прошлого письма, попадают в следующее, даже если опубликованы раньше.
+func Period(d entity.Digest, now time.Time) time.Time {
+	if d.LastSent != nil {
+		return *d.LastSent
+	}
+	if d.Frequency == entity.DigestWeekly {
+		return now.AddDate(0, 0, -7)
+	}
+	return now.AddDate(0, 0, -1)
+}
+
+// Group статьи одного канала.
+type Group struct {
+	Title    string
+	Articles []entity.StreamItem
+}
+
+// Letter данные шаблонов письма.
+type Letter struct {
+	Frequency string
+	Since     time.Time
+	// Total непрочитанных за период, в письме первые из них, More не поместились
+	Total  int
+	More   int
+	Groups []Group
+	loc    *time.Location
+}
+
+// Date время в поясе пользователя.
+func (l Letter) Date(t time.Time) string {
+	return t.In(l.loc).Format("02.01.2006 15:04")
+}
+
+// Build раскладывает статьи по каналам в порядке подписок, каналы без статей пропускаются.
+func Build(d entity.Digest, subs []entity.Subscription, items []entity.StreamItem, total int, since time.Time) Letter {
+	loc, err := time.LoadLocation(d.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	byFeed := make(map[int][]entity.StreamItem)
+	for _, it := range items {
+		byFeed[it.FeedPk] = append(byFeed[it.FeedPk], it)
+	}
+	l := Letter{Frequency: d.Frequency, Since: since, Total: total, More: max(total-len(items), 0), loc: loc}
+	for _, s := range subs {
+		if articles := byFeed[s.FeedPk]; len(articles) > 0 {
+			l.Groups = append(l.Groups, Group{Title: s.Title, Articles: articles})
+		}
+	}
+	return l
+}
+
+// Render собирает письмо из html и текстового шаблонов.
+func Render(to string, l Letter) (sendmail.Message, error) {
+	var html, text bytes.Buffer
+	if err := htmlTmpl.Execute(&html, l); err != nil {
+		return sendmail.Message{}, err
+	}
+	if err := textTmpl.Execute(&text, l); err != nil {
+		return sendmail.Message{}, err
+	}
+	subject := "Daily digest"
+	if l.Frequency == entity.DigestWeekly {
+		subject = "Weekly digest"
+	}
+	return sendmail.Message{
+		To:      []string{to},
+		Subject: subject + ": " + plural(l.Total) + " unread",
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+// snippet начало текста статьи без html.
+func snippet(content string) string {
+	s := strings.Join(strings.Fields(htmltext.Strip(content)), " ")
+	if utf8.RuneCountInString(s) <= snippetLen {
+		return s
+	}
+	r := []rune(s)
+	return strings.TrimSpace(string(r[:snippetLen])) + "…"
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return "1 article"
+	}
+	return strconv.Itoa(n) + " articles"
+}
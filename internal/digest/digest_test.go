@@ -0,0 +1,107 @@
+package digest
+
+import (
+	"testing"
+	"time"
+
+	"rss/internal/entity"
+)
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name   string
+		digest entity.Digest
+		after  string
+		want   string
+	}{
+		{
+			"daily later today",
+			entity.Digest{Frequency: entity.DigestDaily, Timezone: "Europe/Moscow", Hour: 8},
+			"2026-10-19T03:00:00Z", "2026-10-19T08:00:00+03:00",
+		},
+		{
+			"daily exactly at hour goes to tomorrow",
+			entity.Digest{Frequency: entity.DigestDaily, Timezone: "Europe/Moscow", Hour: 8},
+			"2026-10-19T05:00:00Z", "2026-10-20T08:00:00+03:00",
+		},
+		{
+			"daily across month and year",
+			entity.Digest{Frequency: entity.DigestDaily, Timezone: "UTC", Hour: 6},
+			"2026-12-31T07:00:00Z", "2027-01-01T06:00:00Z",
+		},
+		{
+			"spring forward keeps the hour",
+			entity.Digest{Frequency: entity.DigestDaily, Timezone: "Europe/Berlin", Hour: 8},
+			"2026-03-28T08:00:00Z", "2026-03-29T08:00:00+02:00",
+		},
+		{
+			"spring forward skipped hour moves within the day",
+			entity.Digest{Frequency: entity.DigestDaily, Timezone: "Europe/Berlin", Hour: 2},
+			"2026-03-28T12:00:00Z", "2026-03-29T03:00:00+02:00",
+		},
+		{
+			"day after skipped hour is back to the hour",
+			entity.Digest{Frequency: entity.DigestDaily, Timezone: "Europe/Berlin", Hour: 2},
+			"2026-03-29T01:30:00Z", "2026-03-30T02:00:00+02:00",
+		},
+		{
+			"fall back keeps the hour",
+			entity.Digest{Frequency: entity.DigestDaily, Timezone: "America/New_York", Hour: 8},
+			"2026-10-31T13:00:00Z", "2026-11-01T08:00:00-05:00",
+		},
+		{
+			"weekly later this week",
+			entity.Digest{Frequency: entity.DigestWeekly, Timezone: "UTC", Hour: 9, Weekday: int(time.Friday)},
+			"2026-10-19T12:00:00Z", "2026-10-23T09:00:00Z",
+		},
+		{
+			"weekly wraps to next week",
+			entity.Digest{Frequency: entity.DigestWeekly, Timezone: "UTC", Hour: 9, Weekday: int(time.Monday)},
+			"2026-10-24T12:00:00Z", "2026-10-26T09:00:00Z",
+		},
+		{
+			"weekly same day after hour",
+			entity.Digest{Frequency: entity.DigestWeekly, Timezone: "UTC", Hour: 9, Weekday: int(time.Monday)},
+			"2026-10-19T09:00:00Z", "2026-10-26T09:00:00Z",
+		},
+		{
+			"weekly sunday in user timezone",
+			entity.Digest{Frequency: entity.DigestWeekly, Timezone: "Asia/Tokyo", Hour: 7, Weekday: int(time.Sunday)},
+			"2026-10-24T21:00:00Z", "2026-10-25T07:00:00+09:00",
+		},
+		{
+			"weekly across dst",
+			entity.Digest{Frequency: entity.DigestWeekly, Timezone: "Europe/Berlin", Hour: 8, Weekday: int(time.Monday)},
+			"2026-10-19T07:00:00Z", "2026-10-26T08:00:00+01:00",
+		},
+		{
+			"unknown timezone falls back to utc",
+			entity.Digest{Frequency: entity.DigestDaily, Timezone: "Nowhere/City", Hour: 8},
+			"2026-10-19T09:00:00Z", "2026-10-20T08:00:00Z",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after, _ := time.Parse(time.RFC3339, tt.after)
+			want, _ := time.Parse(time.RFC3339, tt.want)
+			got := Next(tt.digest, after)
+			if !got.Equal(want) {
+				t.Errorf("Next = %s, want %s", got, want)
+			}
+			if tt.digest.Frequency == entity.DigestWeekly && int(got.Weekday()) != tt.digest.Weekday {
+				t.Errorf("weekday = %s, want %s", got.Weekday(), time.Weekday(tt.digest.Weekday))
+			}
+		})
+	}
+}
+
+func TestPeriod(t *testing.T) {
+	now := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	last := now.Add(-30 * time.Hour)
+	if got := Period(entity.Digest{Frequency: entity.DigestDaily, LastSent: &last}, now); !got.Equal(last) {
+		t.Errorf("with last_sent = %s, want %s", got, last)
+	}
+	if got := Period(entity.Digest{Frequency: entity.DigestWeekly}, now); !got.Equal(now.AddDate(0, 0, -7)) {
+		t.Errorf("first weekly = %s", got)
+	}
+}
@@ -5,15 +5,517 @@ import (
 )
 
 type Feed struct {
-	Pk      int    `json:"pk"`
-	FeedUrl string `json:"feed_url"`
+	Pk         int               `json:"pk"`
+	FeedUrl    string            `json:"feed_url"`
+	Kind       string            `json:"kind"`
+	Source     SourceConfig      `json:"-"`
+	Processors []ProcessorConfig `json:"-"`
+}
+
+// ProcessorConfig шаг цепочки процессоров статей канала.
+type ProcessorConfig struct {
+	Name   string            `json:"name"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// виды источников канала
+const (
+	FeedKindRss     = "rss"
+	FeedKindHtml    = "html"
+	FeedKindJson    = "json"
+	FeedKindSitemap = "sitemap"
+	// FeedKindNewsletter канал писем на адрес пользователя, не скачивается
+	FeedKindNewsletter = "newsletter"
+)
+
+// Inbound адрес пользователя для рассылок, письма на него становятся статьями канала FeedPk.
+type Inbound struct {
+	Pk      int       `json:"pk"`
+	Address string    `json:"address"`
+	Token   string    `json:"-"`
+	FeedPk  int       `json:"feed_pk"`
+	Title   string    `json:"title"`
+	Created time.Time `json:"created"`
+}
+
+// SourceConfig разметка источника без rss.
+// Для html это CSS селекторы внутри Item, для json пути вида $.data.items[*] и author.name.
+type SourceConfig struct {
+	Item       string `json:"item,omitempty"`
+	Title      string `json:"title,omitempty"`
+	Link       string `json:"link,omitempty"`
+	Date       string `json:"date,omitempty"`
+	DateLayout string `json:"date_layout,omitempty"`
+	Content    string `json:"content,omitempty"`
+}
+
+// Snapshot сырой ответ канала, Body без сжатия.
+type Snapshot struct {
+	Pk      int                 `json:"pk"`
+	FeedPk  int                 `json:"feed_pk"`
+	Feed    Feed                `json:"-"`
+	Url     string              `json:"url"`
+	Status  int                 `json:"status"`
+	Headers map[string][]string `json:"headers"`
+	Body    []byte              `json:"-"`
+	Created time.Time           `json:"created"`
+}
+
+const (
+	NotificationFeedGone  = "feed_gone"
+	NotificationFeedMoved = "feed_moved"
+	// NotificationRule статья совпала с правилом с действием notify
+	NotificationRule = "rule"
+)
+
+// Notification уведомление пользователя, например о переезде или удалении канала.
+type Notification struct {
+	Pk      int       `json:"pk"`
+	FeedPk  int       `json:"feed_pk,omitempty"`
+	Kind    string    `json:"kind"`
+	Message string    `json:"message"`
+	Created time.Time `json:"created"`
+}
+
+// MediaSettings настройки архивирования медиа канала.
+type MediaSettings struct {
+	FeedPk        int  `json:"feed_pk"`
+	Archive       bool `json:"archive_media"`
+	RetentionDays int  `json:"retention_days"`
+	MaxCount      int  `json:"max_count"`
+}
+
+const (
+	EnclosureKindFile  = "enclosure"
+	EnclosureKindImage = "image"
+)
+
+// Enclosure вложение статьи (подкаст, видео, картинка).
+type Enclosure struct {
+	Pk       int    `json:"pk"`
+	Kind     string `json:"kind"`
+	Url      string `json:"url"`
+	MimeType string `json:"mime_type"`
+	Length   int64  `json:"length"`
+	Duration int    `json:"duration"`
+	Archived bool   `json:"archived"`
+}
+
+// ExtractJob статья, для которой нужно извлечь полный текст.
+type ExtractJob struct {
+	Pk        int
+	SourceUrl string
+}
+
+// MediaJob вложение, которое нужно скачать в хранилище или удалить из него.
+type MediaJob struct {
+	Pk       int
+	FeedPk   int
+	Url      string
+	MimeType string
+	BlobKey  string
 }
 
 type Article struct {
+	Pk      int    `json:"pk"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	// FullContent основной контент страницы статьи,
+	// заполняется для каналов с fetch_full_content.
+	FullContent string      `json:"full_content,omitempty"`
+	SourceUrl   string      `json:"source_url"`
+	Published   time.Time   `json:"published"`
+	FeedPk      int         `json:"feed_pk"`
+	Enclosures  []Enclosure `json:"enclosures"`
+	Authors     []Author    `json:"authors"`
+	Categories  []string    `json:"categories"`
+	// ContentHash хэш заголовка и контента, по нему ловятся правки без смены даты.
+	ContentHash string `json:"-"`
+	// Simhash отпечаток для поиска почти одинаковых статей с разных каналов.
+	Simhash   uint64       `json:"-"`
+	ClusterPk int          `json:"cluster_pk,omitempty"`
+	Sources   []ArticleRef `json:"sources,omitempty"`
+}
+
+// ArticleRef краткая ссылка на статью, другой источник того же сюжета.
+type ArticleRef struct {
 	Pk        int       `json:"pk"`
 	Title     string    `json:"title"`
-	Content   string    `json:"content"`
 	SourceUrl string    `json:"source_url"`
+	FeedPk    int       `json:"feed_pk"`
 	Published time.Time `json:"published"`
+}
+
+// Fingerprint отпечаток статьи для кластеризации.
+type Fingerprint struct {
+	Pk        int
+	Simhash   uint64
+	ClusterPk int
+}
+
+// Author автор статьи.
+type Author struct {
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+}
+
+// CategoryCount категория канала и количество статей в ней.
+type CategoryCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// ArticleFilter фильтр списка статей, пустые поля не фильтруют.
+type ArticleFilter struct {
+	FeedPk int
+	// FolderPk каналы папки и ее подпапок
+	FolderPk int
+	Author   string
+	Category string
+	Query    string
+	// Tag метка, поставленная правилом пользователя
+	Tag string
+	// Collapse одна статья на кластер дублей, не фильтрует.
+	Collapse bool
+}
+
+// IsZero true если фильтр ничего не отсекает.
+func (f ArticleFilter) IsZero() bool {
+	return f.FeedPk == 0 && f.FolderPk == 0 && f.Author == "" && f.Category == "" && f.Query == "" && f.Tag == ""
+}
+
+// Revision версия статьи, отличающаяся хэшем контента.
+type Revision struct {
+	Pk          int       `json:"pk"`
+	ArticlePk   int       `json:"article_pk"`
+	ContentHash string    `json:"content_hash"`
+	Title       string    `json:"title"`
+	Content     string    `json:"content,omitempty"`
+	Published   time.Time `json:"published"`
+	Recorded    time.Time `json:"recorded"`
+}
+
+// DiffOp кусок разницы: equal, insert или delete.
+type DiffOp struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// RevisionDiff разница между двумя версиями статьи.
+type RevisionDiff struct {
+	From    int      `json:"from"`
+	To      int      `json:"to"`
+	Title   []DiffOp `json:"title"`
+	Content []DiffOp `json:"content"`
+}
+
+const (
+	ArticleInserted  = "inserted"
+	ArticleUpdated   = "updated"
+	ArticleUnchanged = "unchanged"
+	ArticleFailed    = "failed"
+)
+
+// ArticleResult результат записи статьи, Reason только у failed.
+type ArticleResult struct {
+	SourceUrl string `json:"source_url"`
+	Status    string `json:"status"`
+	Reason    string `json:"reason,omitempty"`
+	// Invalid статья не прошла проверку до записи, повтор ничего не изменит
+	Invalid bool `json:"-"`
+}
+
+// DeadLetter статья, которую не удалось записать, ждет разбора и повтора.
+type DeadLetter struct {
+	Pk        int       `json:"pk"`
+	SourceUrl string    `json:"source_url"`
 	FeedPk    int       `json:"feed_pk"`
+	Reason    string    `json:"reason"`
+	Attempts  int       `json:"attempts"`
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+	Article   Article   `json:"article"`
+}
+
+// BulkResult счетчики массовой записи статей через COPY.
+type BulkResult struct {
+	Staged    int `json:"staged"`
+	Inserted  int `json:"inserted"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Failed    int `json:"failed"`
+}
+
+const (
+	RefreshQueued  = "queued"
+	RefreshRunning = "running"
+	RefreshDone    = "done"
+	RefreshFailed  = "failed"
+)
+
+// RefreshJob задача внеочередного обновления канала.
+// Items количество item в ответе канала, переданных на запись.
+type RefreshJob struct {
+	Pk       int        `json:"pk"`
+	FeedPk   int        `json:"feed_pk"`
+	Feed     Feed       `json:"-"`
+	Status   string     `json:"status"`
+	Backfill bool       `json:"backfill"`
+	Items    int        `json:"items"`
+	Error    string     `json:"error,omitempty"`
+	Created  time.Time  `json:"created"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+// Account пользователь сторонних клиентов.
+type Account struct {
+	PersonPk string `json:"person_pk"`
+	Login    string `json:"login"`
+}
+
+// Session сессия веб интерфейса.
+type Session struct {
+	Account
+	Csrf    string
+	Expires time.Time
+}
+
+// Subscription канал в подписках пользователя с настройками подписки.
+type Subscription struct {
+	FeedPk  int    `json:"feed_pk"`
+	FeedUrl string `json:"feed_url"`
+	Kind    string `json:"kind"`
+	// Title свое название подписки, иначе название рассылки или url
+	Title      string     `json:"title"`
+	FolderPk   int        `json:"folder_pk,omitempty"`
+	Pinned     bool       `json:"pinned"`
+	Priority   int        `json:"priority"`
+	MutedUntil *time.Time `json:"muted_until,omitempty"`
+	// Notify уведомления о переезде и удалении канала
+	Notify bool      `json:"notify"`
+	Viewed time.Time `json:"viewed"`
+}
+
+// SubscriptionPatch изменение настроек подписки, nil поля не меняются.
+type SubscriptionPatch struct {
+	// Title пустой возвращает название по умолчанию
+	Title    *string
+	Pinned   *bool
+	Priority *int
+	// MutedUntil нулевое время снимает откладывание
+	MutedUntil *time.Time
+	Notify     *bool
+	// History сколько истории показать заново: none, all или число дней
+	History *string
+	// Viewed вычисляется из History
+	Viewed *time.Time
+}
+
+// Folder папка подписок, ParentPk 0 у папок верхнего уровня.
+type Folder struct {
+	Pk       int    `json:"pk"`
+	ParentPk int    `json:"parent_pk,omitempty"`
+	Title    string `json:"title"`
+	// непрочитанные вместе с подпапками
+	Unread int   `json:"unread"`
+	Feeds  []int `json:"feeds"`
+}
+
+// StreamFilter выборка статей из подписок с учетом прочитанного и избранного.
+type StreamFilter struct {
+	FeedPk int
+	// FolderPk каналы папки и ее подпапок
+	FolderPk int
+	Starred  bool
+	// Tag метка, поставленная правилом пользователя
+	Tag string
+	// Hidden вместе со скрытыми правилами статьями
+	Hidden bool
+	// Muted вместе со статьями отложенных подписок
+	Muted bool
+	// Unread только непрочитанные, Read только прочитанные
+	Unread bool
+	Read   bool
+	// по дате публикации, нулевые без ограничений
+	Since time.Time
+	Until time.Time
+	// RecordedSince по времени записи статьи, поздно полученные старые статьи тоже попадут
+	RecordedSince time.Time
+	Pks           []int
+	// по pk статьи, нулевые без ограничений
+	AfterPk  int
+	BeforePk int
+	// Oldest сначала старые, ByPk сортировка по pk вместо даты публикации
+	Oldest bool
+	ByPk   bool
+	Limit  int
+	Offset int
+}
+
+// StreamItem статья с состоянием для пользователя.
+type StreamItem struct {
+	Article
+	Read    bool     `json:"read"`
+	Starred bool     `json:"starred"`
+	Hidden  bool     `json:"hidden,omitempty"`
+	Tags    []string `json:"tags"`
+}
+
+// UnreadCount непрочитанные статьи канала.
+type UnreadCount struct {
+	FeedPk int       `json:"feed_pk"`
+	Count  int       `json:"count"`
+	Newest time.Time `json:"newest"`
+}
+
+// Rule правило пользователя, действия применяются к статьям подписок под условие.
+type Rule struct {
+	Pk        int           `json:"pk"`
+	PersonPk  string        `json:"-"`
+	Title     string        `json:"title"`
+	Condition RuleCondition `json:"condition"`
+	Actions   []RuleAction  `json:"actions"`
+	Enabled   bool          `json:"enabled"`
+	Created   time.Time     `json:"created"`
+}
+
+// RuleCondition условие правила: комбинация All, Any, Not
+// или сравнение поля Field статьи со значением Value способом Op.
+type RuleCondition struct {
+	All   []RuleCondition `json:"all,omitempty"`
+	Any   []RuleCondition `json:"any,omitempty"`
+	Not   *RuleCondition  `json:"not,omitempty"`
+	Field string          `json:"field,omitempty"`
+	Op    string          `json:"op,omitempty"`
+	Value string          `json:"value,omitempty"`
+}
+
+// Действия правил.
+const (
+	RuleRead   = "read"
+	RuleStar   = "star"
+	RuleTag    = "tag"
+	RuleHide   = "hide"
+	RuleNotify = "notify"
+)
+
+// RuleAction действие правила, Value метка для tag.
+type RuleAction struct {
+	Type  string `json:"type"`
+	Value string `json:"value,omitempty"`
+}
+
+// RuleHit статья, совпавшая с правилом.
+type RuleHit struct {
+	Rule    Rule
+	Article ArticleRef
+}
+
+// SavedSearch сохраненный поиск по всем каналам, ведет себя как канал:
+// статьи записанные после Viewed непрочитанные.
+type SavedSearch struct {
+	Pk    int    `json:"pk"`
+	Title string `json:"title"`
+	// Query запрос websearch, пустой без ограничения
+	Query string `json:"query"`
+	// Feeds и Categories пустые без ограничения, категории без учета регистра
+	Feeds      []int    `json:"feeds"`
+	Categories []string `json:"categories"`
+	// WindowDays только статьи опубликованные за последние дни, 0 без ограничения
+	WindowDays int `json:"window_days"`
+	// оповещения о новых статьях, пустые выключены
+	AlertUrl   string `json:"alert_url"`
+	AlertEmail string `json:"alert_email"`
+	// AlertEmailConfirmed письма уходят только на подтвержденный кодом адрес
+	AlertEmailConfirmed bool `json:"alert_email_confirmed"`
+	// Unread за последние 30 дней, не больше 1000
+	Unread  int       `json:"unread"`
+	Viewed  time.Time `json:"viewed"`
+	Created time.Time `json:"created"`
+}
+
+// SearchAlert новые статьи сохраненного поиска для оповещения.
+type SearchAlert struct {
+	Search   SavedSearch  `json:"search"`
+	Articles []ArticleRef `json:"articles"`
+}
+
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// Digest настройки письма с непрочитанными статьями: Hour час в поясе Timezone,
+// у еженедельного еще Weekday, 0 воскресенье.
+type Digest struct {
+	PersonPk  string     `json:"-"`
+	Email     string     `json:"email"`
+	Frequency string     `json:"frequency"`
+	Timezone  string     `json:"timezone"`
+	Hour      int        `json:"hour"`
+	Weekday   int        `json:"weekday"`
+	LastSent  *time.Time `json:"last_sent"`
+	NextSend  time.Time  `json:"next_send"`
+}
+
+// Highlight выделение в статье: цитата Exact с контекстом Prefix и Suffix,
+// Start и End смещения в символах по тексту статьи без html, пробелы схлопнуты.
+// Orphaned цитаты нет в текущей версии статьи, смещения остались от прошлой.
+type Highlight struct {
+	Pk          int         `json:"pk"`
+	ArticlePk   int         `json:"article_pk"`
+	Exact       string      `json:"exact"`
+	Prefix      string      `json:"prefix"`
+	Suffix      string      `json:"suffix"`
+	Start       int         `json:"start"`
+	End         int         `json:"end"`
+	Orphaned    bool        `json:"orphaned"`
+	ContentHash string      `json:"-"`
+	Article     *ArticleRef `json:"article,omitempty"`
+	Notes       []Note      `json:"notes,omitempty"`
+	Created     time.Time   `json:"created"`
+	Updated     time.Time   `json:"updated"`
+}
+
+// StaleHighlight выделение, статья которого изменилась после привязки, с текущим контентом.
+type StaleHighlight struct {
+	Highlight
+	Content     string
+	ArticleHash string
+}
+
+// HighlightFilter выделения пользователя, ArticlePk 0 по всем статьям, Limit 0 без ограничения.
+type HighlightFilter struct {
+	ArticlePk int
+	Limit     int
+	Offset    int
+}
+
+// Note заметка пользователя к статье, с HighlightPk к выделению.
+type Note struct {
+	Pk          int         `json:"pk"`
+	ArticlePk   int         `json:"article_pk"`
+	HighlightPk *int        `json:"highlight_pk"`
+	Body        string      `json:"body"`
+	Article     *ArticleRef `json:"article,omitempty"`
+	Created     time.Time   `json:"created"`
+	Updated     time.Time   `json:"updated"`
+}
+
+// ExportFilter выборка статей подписок для книги: явные Pks, канал и/или даты публикации.
+type ExportFilter struct {
+	Pks      []int
+	FeedPk   int
+	Since    time.Time
+	Until    time.Time
+	Title    string
+	Language string
+}
+
+// Annotations выделения и заметки пользователя к одной статье для экспорта.
+type Annotations struct {
+	Article    ArticleRef  `json:"article"`
+	Highlights []Highlight `json:"highlights"`
+	Notes      []Note      `json:"notes"`
 }
@@ -0,0 +1,135 @@
+// Package epub собирает книгу EPUB 3 из статей: оглавление, глава на статью и картинки внутри архива.
+package epub
+
+import (
+	"archive/zip"
+	"embed"
+	"fmt"
+	"hash/crc32"
+	"html"
+	"io"
+	"text/template"
+	"time"
+)
+
+//go:embed templates
+var templatesFS embed.FS
+
+var tmpl = template.Must(template.New("epub").Funcs(template.FuncMap{
+	// x экранирует текст для xml
+	"x":       func(s string) string { return html.EscapeString(xmlText(s)) },
+	"inc":     func(i int) int { return i + 1 },
+	"chapter": chapterName,
+}).ParseFS(templatesFS, "templates/*"))
+
+// Book книга, Identifier уникальный, например urn:uuid.
+type Book struct {
+	Title      string
+	Identifier string
+	Language   string
+	Modified   time.Time
+	Chapters   []Chapter
+	Images     []Image
+}
+
+// Chapter глава, Body xhtml из Fragment.XHTML.
+type Chapter struct {
+	Title     string
+	Feed      string
+	Url       string
+	Published time.Time
+	Body      string
+}
+
+// Image картинка внутри книги, Name путь от OEBPS, на него ссылаются главы.
+type Image struct {
+	Name      string
+	MediaType string
+	Data      []byte
+}
+
+// ImageName путь i-ой картинки книги с расширением по типу.
+func ImageName(i int, mediaType string) string {
+	ext := ".img"
+	switch mediaType {
+	case "image/jpeg":
+		ext = ".jpg"
+	case "image/png":
+		ext = ".png"
+	case "image/gif":
+		ext = ".gif"
+	case "image/webp":
+		ext = ".webp"
+	}
+	return fmt.Sprintf("images/%03d%s", i+1, ext)
+}
+
+func chapterName(i int) string {
+	return fmt.Sprintf("chapter-%03d.xhtml", i+1)
+}
+
+// Write пишет книгу zip архивом: mimetype первым, без сжатия и extra полей, как требует OCF.
+func Write(w io.Writer, b Book) error {
+	z := zip.NewWriter(w)
+	// CreateRaw с готовыми размерами: без времени изменения, которое zip пишет в extra,
+	// и без data descriptor, чтобы тип читался по фиксированному смещению
+	const mediaType = "application/epub+zip"
+	mimetype, err := z.CreateRaw(&zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE([]byte(mediaType)),
+		CompressedSize64:   uint64(len(mediaType)),
+		UncompressedSize64: uint64(len(mediaType)),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mimetype, mediaType); err != nil {
+		return err
+	}
+
+	files := []struct {
+		name string
+		tmpl string
+		data any
+	}{
+		{"META-INF/container.xml", "container.xml", b},
+		{"OEBPS/content.opf", "content.opf", b},
+		{"OEBPS/nav.xhtml", "nav.xhtml", b},
+		{"OEBPS/toc.ncx", "toc.ncx", b},
+		{"OEBPS/style.css", "style.css", b},
+	}
+	for _, f := range files {
+		if err := writeTemplate(z, f.name, f.tmpl, f.data, b.Modified); err != nil {
+			return err
+		}
+	}
+	for i, c := range b.Chapters {
+		data := struct {
+			Language string
+			Chapter  Chapter
+		}{b.Language, c}
+		if err := writeTemplate(z, "OEBPS/"+chapterName(i), "chapter.xhtml", data, b.Modified); err != nil {
+			return err
+		}
+	}
+	for _, img := range b.Images {
+		// картинки уже сжаты
+		f, err := z.CreateHeader(&zip.FileHeader{Name: "OEBPS/" + img.Name, Method: zip.Store, Modified: b.Modified})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(img.Data); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+func writeTemplate(z *zip.Writer, name string, tmplName string, data any, modified time.Time) error {
+	f, err := z.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	return tmpl.ExecuteTemplate(f, tmplName, data)
+}
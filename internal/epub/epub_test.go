@@ -0,0 +1,121 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testBook() Book {
+	return Book{
+		Title:      "Tom & Jerry <weekly>",
+		Identifier: "urn:uuid:00000000-0000-4000-8000-000000000000",
+		Language:   "ru",
+		Modified:   time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+		Chapters: []Chapter{
+			{Title: "Первая \x01<глава>", Feed: "Лента", Url: "https://example.com/1?a=1&b=2", Published: time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC), Body: `<p>one<br/></p>`},
+			{Title: "Second", Body: `<img src="images/001.png" alt=""/>`},
+		},
+		Images: []Image{{Name: ImageName(0, "image/png"), MediaType: "image/png", Data: []byte("\x89PNG")}},
+	}
+}
+
+func TestWriteLayout(t *testing.T) {
+	var b bytes.Buffer
+	if err := Write(&b, testBook()); err != nil {
+		t.Fatal(err)
+	}
+	raw := b.Bytes()
+	// читалки узнают epub по байтам: mimetype первым файлом, без сжатия и extra полей
+	if string(raw[:4]) != "PK\x03\x04" || string(raw[30:38]) != "mimetype" || string(raw[38:58]) != "application/epub+zip" {
+		t.Fatalf("archive does not start with stored mimetype: %q", raw[:58])
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z.File[0].Name != "mimetype" || z.File[0].Method != zip.Store {
+		t.Errorf("first file %s method %d, want stored mimetype", z.File[0].Name, z.File[0].Method)
+	}
+	files := make(map[string]string)
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		files[f.Name] = string(data)
+		if strings.HasSuffix(f.Name, ".xml") || strings.HasSuffix(f.Name, ".xhtml") ||
+			strings.HasSuffix(f.Name, ".opf") || strings.HasSuffix(f.Name, ".ncx") {
+			wellFormed(t, f.Name, string(data))
+		}
+	}
+	for _, name := range []string{
+		"META-INF/container.xml", "OEBPS/content.opf", "OEBPS/nav.xhtml", "OEBPS/toc.ncx", "OEBPS/style.css",
+		"OEBPS/chapter-001.xhtml", "OEBPS/chapter-002.xhtml", "OEBPS/images/001.png",
+	} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("archive has no %s", name)
+		}
+	}
+	if !strings.Contains(files["META-INF/container.xml"], `full-path="OEBPS/content.opf"`) {
+		t.Errorf("container.xml does not point to content.opf")
+	}
+	if files["OEBPS/images/001.png"] != "\x89PNG" {
+		t.Errorf("image data = %q", files["OEBPS/images/001.png"])
+	}
+	if !strings.Contains(files["OEBPS/chapter-001.xhtml"], "Первая &lt;глава&gt;") {
+		t.Errorf("chapter title not escaped:\n%s", files["OEBPS/chapter-001.xhtml"])
+	}
+
+	var opf struct {
+		Title    string `xml:"metadata>title"`
+		Modified string `xml:"metadata>meta"`
+		Items    []struct {
+			Id        string `xml:"id,attr"`
+			Href      string `xml:"href,attr"`
+			MediaType string `xml:"media-type,attr"`
+		} `xml:"manifest>item"`
+		Spine []struct {
+			Idref string `xml:"idref,attr"`
+		} `xml:"spine>itemref"`
+	}
+	if err := xml.Unmarshal([]byte(files["OEBPS/content.opf"]), &opf); err != nil {
+		t.Fatal(err)
+	}
+	if opf.Title != "Tom & Jerry <weekly>" || opf.Modified != "2026-10-19T12:00:00Z" {
+		t.Errorf("metadata title %q modified %q", opf.Title, opf.Modified)
+	}
+	ids := make(map[string]bool)
+	for _, it := range opf.Items {
+		ids[it.Id] = true
+		if _, ok := files["OEBPS/"+it.Href]; !ok {
+			t.Errorf("manifest item %s points to missing %s", it.Id, it.Href)
+		}
+		if it.Href == "images/001.png" && it.MediaType != "image/png" {
+			t.Errorf("image media-type %q", it.MediaType)
+		}
+	}
+	if len(opf.Items) != len(files)-3 {
+		t.Errorf("manifest has %d items, want every file but mimetype, container.xml and content.opf", len(opf.Items))
+	}
+	var spine []string
+	for _, it := range opf.Spine {
+		if !ids[it.Idref] {
+			t.Errorf("spine refers to unknown %s", it.Idref)
+		}
+		spine = append(spine, it.Idref)
+	}
+	if got := strings.Join(spine, ","); got != "nav,chapter-1,chapter-2" {
+		t.Errorf("spine = %s", got)
+	}
+}
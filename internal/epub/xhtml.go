@@ -0,0 +1,156 @@
+package epub
+
+import (
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"rss/internal/sanitize"
+)
+
+// Fragment контент статьи, очищенный санитайзером и разобранный в дерево.
+type Fragment struct {
+	// root держит узлы фрагмента, чтобы у каждого был родитель
+	root *html.Node
+	base *url.URL
+}
+
+// Parse очищает html статьи, относительные ссылки и картинки считаются от base.
+func Parse(content string, base string) (*Fragment, error) {
+	ctx := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(sanitize.HTML(content)), ctx)
+	if err != nil {
+		return nil, err
+	}
+	root := &html.Node{Type: html.DocumentNode}
+	for _, n := range nodes {
+		root.AppendChild(n)
+	}
+	u, _ := url.Parse(base)
+	return &Fragment{root: root, base: u}, nil
+}
+
+// Images абсолютные http адреса картинок по порядку, без повторов.
+func (f *Fragment) Images() []string {
+	var res []string
+	seen := make(map[string]bool)
+	f.walk(func(n *html.Node) {
+		if n.DataAtom != atom.Img {
+			return
+		}
+		if src := f.resolve(attr(n, "src")); src != "" && !seen[src] {
+			seen[src] = true
+			res = append(res, src)
+		}
+	})
+	return res
+}
+
+// XHTML сериализует фрагмент для главы книги. Картинки из images ссылаются на файл в книге,
+// остальные заменяются своим alt, внешние картинки читалки не показывают.
+func (f *Fragment) XHTML(images map[string]string) string {
+	var drop []*html.Node
+	f.walk(func(n *html.Node) {
+		for i := range n.Attr {
+			n.Attr[i].Val = xmlText(n.Attr[i].Val)
+		}
+		switch n.DataAtom {
+		case atom.A:
+			if href := attr(n, "href"); href != "" && !strings.HasPrefix(href, "#") {
+				if abs := f.resolve(href); abs != "" {
+					setAttr(n, "href", abs)
+				}
+			}
+		case atom.Img:
+			if name, ok := images[f.resolve(attr(n, "src"))]; ok {
+				setAttr(n, "src", name)
+				setAttr(n, "alt", attr(n, "alt"))
+				return
+			}
+			drop = append(drop, n)
+		}
+	})
+	for _, n := range drop {
+		if alt := strings.TrimSpace(attr(n, "alt")); alt != "" {
+			n.Parent.InsertBefore(&html.Node{Type: html.TextNode, Data: "[" + alt + "]"}, n)
+		}
+		n.Parent.RemoveChild(n)
+	}
+
+	var b strings.Builder
+	for n := f.root.FirstChild; n != nil; n = n.NextSibling {
+		// void теги html.Render закрывает как <br/>, текст экранирует, что годится и для xml
+		if err := html.Render(&b, n); err != nil {
+			return ""
+		}
+	}
+	return b.String()
+}
+
+// walk обходит элементы фрагмента, текст заодно чистит от недопустимых в xml символов.
+func (f *Fragment) walk(fn func(n *html.Node)) {
+	var rec func(n *html.Node)
+	rec = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			n.Data = xmlText(n.Data)
+		case html.ElementNode:
+			fn(n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			rec(c)
+		}
+	}
+	rec(f.root)
+}
+
+// resolve абсолютный http или https адрес относительно статьи, иначе пусто, mailto остается как есть.
+func (f *Fragment) resolve(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if f.base != nil {
+		u = f.base.ResolveReference(u)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	return u.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func setAttr(n *html.Node, key string, val string) {
+	for i := range n.Attr {
+		if n.Attr[i].Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
+
+// xmlText убирает битый utf-8 и управляющие символы, которых нет в xml 1.0.
+func xmlText(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' || (r >= 0x20 && r != 0xFFFE && r != 0xFFFF && r != utf8.RuneError) {
+			return r
+		}
+		return -1
+	}, s)
+}
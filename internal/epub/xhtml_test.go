@@ -0,0 +1,80 @@
+package epub
+
+import (
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// wellFormed проверяет, что s разбирается строгим xml парсером.
+func wellFormed(t *testing.T, name string, s string) {
+	t.Helper()
+	d := xml.NewDecoder(strings.NewReader(s))
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatalf("%s is not well-formed xml: %v\n%s", name, err, s)
+		}
+	}
+}
+
+func TestImages(t *testing.T) {
+	f, err := Parse(`<p><img src="/a.png"><img src="https://cdn.example.com/b.jpg"></p>
+		<img src="a.png"><img src="/a.png"><img src=""><img src="data:image/png;base64,AAAA"><img src="ftp://example.com/c.gif">`,
+		"https://example.com/post/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://example.com/a.png", "https://cdn.example.com/b.jpg", "https://example.com/post/a.png"}
+	if got := f.Images(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Images = %q, want %q", got, want)
+	}
+}
+
+func TestXHTML(t *testing.T) {
+	f, err := Parse("<p>Text\x01 &amp; <a href=\"/next\">next</a> <a href=\"#note\">note</a><br>"+
+		"<img src=\"/a.png\" alt=\"kept\"><img src=\"/b.png\" alt=\"Chart\"><img src=\"/c.png\"></p>"+
+		"<script>alert(1)</script><hr>",
+		"https://example.com/post/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := f.XHTML(map[string]string{"https://example.com/a.png": "images/001.png"})
+	wellFormed(t, "chapter body", "<div>"+got+"</div>")
+
+	for _, want := range []string{
+		`<a href="https://example.com/next"`,
+		`<a href="#note"`,
+		`<img src="images/001.png" alt="kept"/>`,
+		`[Chart]`,
+		`<br/>`,
+		`<hr/>`,
+		`Text &amp; `,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("XHTML missing %q:\n%s", want, got)
+		}
+	}
+	for _, bad := range []string{"/b.png", "/c.png", "<script", "alert", "\x01"} {
+		if strings.Contains(got, bad) {
+			t.Errorf("XHTML contains %q:\n%s", bad, got)
+		}
+	}
+}
+
+func TestXHTMLInvalidUTF8(t *testing.T) {
+	f, err := Parse("<p title=\"a\xffb\">bro\xffken\x00</p>", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := f.XHTML(nil)
+	wellFormed(t, "chapter body", "<div>"+got+"</div>")
+	if !strings.Contains(got, "broken") {
+		t.Errorf("XHTML = %q, want text without broken bytes", got)
+	}
+}
@@ -0,0 +1,213 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"rss/internal/entity"
+	"rss/internal/htmltext"
+	"rss/internal/sanitize"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func init() {
+	Register("sanitize", newSanitize)
+	Register("rewrite_links", newRewriteLinks)
+	Register("drop", newDrop)
+	Register("tag", newTag)
+}
+
+// sanitize очищает html контента по белому списку.
+type sanitizeProcessor struct{}
+
+func newSanitize(map[string]string) (ArticleProcessor, error) {
+	return sanitizeProcessor{}, nil
+}
+
+func (sanitizeProcessor) Process(_ context.Context, a *entity.Article) error {
+	a.Content = sanitize.HTML(a.Content)
+	return nil
+}
+
+// метки трекинга, которые rewrite_links убирает по умолчанию
+const defaultStripParams = "utm_*,fbclid,gclid,mc_cid,mc_eid"
+
+// rewriteLinks убирает метки трекинга из ссылок и переписывает их по регулярному выражению:
+// strip_params список параметров, * в конце как префикс; pattern и replace как в regexp.ReplaceAllString.
+type rewriteLinks struct {
+	strip   []string
+	pattern *regexp.Regexp
+	replace string
+}
+
+func newRewriteLinks(params map[string]string) (ArticleProcessor, error) {
+	p := rewriteLinks{replace: params["replace"]}
+	strip, ok := params["strip_params"]
+	if !ok {
+		strip = defaultStripParams
+	}
+	for _, s := range strings.Split(strip, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			p.strip = append(p.strip, s)
+		}
+	}
+	if v := params["pattern"]; v != "" {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return nil, err
+		}
+		p.pattern = re
+	}
+	return p, nil
+}
+
+func (p rewriteLinks) Process(_ context.Context, a *entity.Article) error {
+	a.SourceUrl = p.rewrite(a.SourceUrl)
+	if !strings.Contains(a.Content, "href") {
+		return nil
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(a.Content))
+	if err != nil {
+		return err
+	}
+	doc.Find("a[href]").Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		s.SetAttr("href", p.rewrite(href))
+	})
+	content, err := doc.Find("body").Html()
+	if err != nil {
+		return err
+	}
+	a.Content = content
+	return nil
+}
+
+func (p rewriteLinks) rewrite(link string) string {
+	u, err := url.Parse(link)
+	if err == nil && u.RawQuery != "" && len(p.strip) > 0 {
+		q := u.Query()
+		for key := range q {
+			if p.stripped(key) {
+				q.Del(key)
+			}
+		}
+		u.RawQuery = q.Encode()
+		link = u.String()
+	}
+	if p.pattern != nil {
+		link = p.pattern.ReplaceAllString(link, p.replace)
+	}
+	return link
+}
+
+func (p rewriteLinks) stripped(key string) bool {
+	for _, s := range p.strip {
+		if prefix, ok := strings.CutSuffix(s, "*"); ok && strings.HasPrefix(key, prefix) || key == s {
+			return true
+		}
+	}
+	return false
+}
+
+// drop отбрасывает статью, если совпало любое из регулярных выражений title, content, url, author
+// или статья старше older_than.
+type drop struct {
+	title, content, url, author *regexp.Regexp
+	olderThan                   time.Duration
+}
+
+func newDrop(params map[string]string) (ArticleProcessor, error) {
+	var p drop
+	fields := map[string]**regexp.Regexp{"title": &p.title, "content": &p.content, "url": &p.url, "author": &p.author}
+	for key, re := range fields {
+		if v := params[key]; v != "" {
+			compiled, err := regexp.Compile(v)
+			if err != nil {
+				return nil, err
+			}
+			*re = compiled
+		}
+	}
+	if v := params["older_than"]; v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+		p.olderThan = d
+	}
+	if p.title == nil && p.content == nil && p.url == nil && p.author == nil && p.olderThan == 0 {
+		return nil, errors.New("drop needs title, content, url, author or older_than")
+	}
+	return p, nil
+}
+
+func (p drop) Process(_ context.Context, a *entity.Article) error {
+	switch {
+	case p.title != nil && p.title.MatchString(a.Title),
+		p.content != nil && p.content.MatchString(htmltext.Strip(a.Content)),
+		p.url != nil && p.url.MatchString(a.SourceUrl),
+		p.olderThan > 0 && !a.Published.IsZero() && time.Since(a.Published) > p.olderThan:
+		return ErrReject
+	}
+	if p.author != nil {
+		for _, au := range a.Authors {
+			if p.author.MatchString(au.Name) || p.author.MatchString(au.Email) {
+				return ErrReject
+			}
+		}
+	}
+	return nil
+}
+
+// tag добавляет категории category (через запятую), с match только статьям,
+// у которых заголовок или текст совпали с регулярным выражением.
+type tag struct {
+	categories []string
+	match      *regexp.Regexp
+}
+
+func newTag(params map[string]string) (ArticleProcessor, error) {
+	var p tag
+	for _, c := range strings.Split(params["category"], ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			p.categories = append(p.categories, c)
+		}
+	}
+	if len(p.categories) == 0 {
+		return nil, errors.New("tag needs category")
+	}
+	if v := params["match"]; v != "" {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return nil, err
+		}
+		p.match = re
+	}
+	return p, nil
+}
+
+func (p tag) Process(_ context.Context, a *entity.Article) error {
+	if p.match != nil && !p.match.MatchString(a.Title) && !p.match.MatchString(htmltext.Strip(a.Content)) {
+		return nil
+	}
+	for _, c := range p.categories {
+		if !contains(a.Categories, c) {
+			a.Categories = append(a.Categories, c)
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
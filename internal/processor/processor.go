@@ -0,0 +1,184 @@
+package processor
+
+/*
+	Цепочка процессоров статей между разбором и записью.
+	Каждый канал задает свою упорядоченную цепочку в feed.processors,
+	процессор может изменить статью, дополнить ее или отбросить через ErrReject.
+	Ошибка процессора не теряет статью: она записывается в метрики
+	и статья идет дальше по цепочке без его изменений.
+*/
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"rss/internal/entity"
+)
+
+// ErrReject процессор отбросил статью, она не будет записана.
+var ErrReject = errors.New("article rejected")
+
+// ArticleProcessor шаг цепочки, должен быть безопасен для конкурентного вызова.
+type ArticleProcessor interface {
+	// Process меняет или дополняет статью, ErrReject отбрасывает ее.
+	Process(ctx context.Context, a *entity.Article) error
+}
+
+// Factory создает процессор по параметрам из настроек канала.
+type Factory func(params map[string]string) (ArticleProcessor, error)
+
+var registry = map[string]Factory{}
+
+// Register добавляет процессор под именем, вызывается из init.
+func Register(name string, f Factory) {
+	if _, ok := registry[name]; ok {
+		panic("processor: duplicate " + name)
+	}
+	registry[name] = f
+}
+
+// Names имена зарегистрированных процессоров.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type step struct {
+	name string
+	p    ArticleProcessor
+}
+
+// Chain цепочка процессоров канала, nil цепочка ничего не делает.
+type Chain struct {
+	steps   []step
+	metrics *Metrics
+}
+
+// New собирает цепочку по настройкам канала, metrics может быть nil.
+func New(cfgs []entity.ProcessorConfig, metrics *Metrics) (*Chain, error) {
+	c := &Chain{metrics: metrics}
+	for i, cfg := range cfgs {
+		f, ok := registry[cfg.Name]
+		if !ok {
+			return nil, fmt.Errorf("processor %d: unknown %q", i, cfg.Name)
+		}
+		p, err := f(cfg.Params)
+		if err != nil {
+			return nil, fmt.Errorf("processor %d %s: %w", i, cfg.Name, err)
+		}
+		c.steps = append(c.steps, step{name: cfg.Name, p: p})
+	}
+	return c, nil
+}
+
+// Validate проверяет настройки цепочки без метрик.
+func Validate(cfgs []entity.ProcessorConfig) error {
+	_, err := New(cfgs, nil)
+	return err
+}
+
+// Run прогоняет статью по цепочке, false если статью отбросили.
+// Ошибки процессоров возвращаются вместе, статья при этом остается.
+func (c *Chain) Run(ctx context.Context, a *entity.Article) (bool, error) {
+	if c == nil {
+		return true, nil
+	}
+	var errs []error
+	for _, s := range c.steps {
+		start := time.Now()
+		err := s.run(ctx, a)
+		c.metrics.observe(s.name, time.Since(start), err)
+
+		switch {
+		case errors.Is(err, ErrReject):
+			return false, nil
+		case err != nil:
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+		}
+	}
+	return true, errors.Join(errs...)
+}
+
+// run вызывает процессор на копии статьи, при ошибке или панике изменения отбрасываются.
+func (s step) run(ctx context.Context, a *entity.Article) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	// срезы копируются тоже, иначе процессор до ошибки успеет поменять их в исходной статье
+	cp := *a
+	cp.Enclosures = slices.Clone(a.Enclosures)
+	cp.Authors = slices.Clone(a.Authors)
+	cp.Categories = slices.Clone(a.Categories)
+	cp.Sources = slices.Clone(a.Sources)
+	if err := s.p.Process(ctx, &cp); err != nil {
+		return err
+	}
+	*a = cp
+	return nil
+}
+
+// Metrics счетчики процессоров по имени с запуска.
+type Metrics struct {
+	mu    sync.Mutex
+	stats map[string]*Stat
+}
+
+// Stat счетчики одного процессора.
+type Stat struct {
+	Name      string  `json:"name"`
+	Processed int64   `json:"processed"`
+	Rejected  int64   `json:"rejected"`
+	Errors    int64   `json:"errors"`
+	Seconds   float64 `json:"seconds"`
+	LastError string  `json:"last_error,omitempty"`
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{stats: make(map[string]*Stat)}
+}
+
+func (m *Metrics) observe(name string, d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.stats[name]
+	if !ok {
+		s = &Stat{Name: name}
+		m.stats[name] = s
+	}
+	s.Processed++
+	s.Seconds += d.Seconds()
+	switch {
+	case errors.Is(err, ErrReject):
+		s.Rejected++
+	case err != nil:
+		s.Errors++
+		s.LastError = err.Error()
+	}
+}
+
+// Stats копия счетчиков, по имени.
+func (m *Metrics) Stats() []Stat {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := make([]Stat, 0, len(m.stats))
+	for _, s := range m.stats {
+		res = append(res, *s)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
@@ -0,0 +1,159 @@
+package readability
+
+/*
+	Упрощенный алгоритм readability:
+	1) из документа удаляются скрипты, навигация и прочий шум.
+	2) каждый абзац добавляет очки родителю и половину деду,
+	   по длине текста и количеству запятых.
+	3) очки кандидата корректируются по class/id и плотности ссылок.
+	4) html лучшего кандидата с абсолютными ссылками и есть основной контент.
+*/
+import (
+	"errors"
+	"io"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+var ErrNoContent = errors.New("main content not found")
+
+// минимум текста в абзаце, чтобы он считался
+const minParagraphLen = 25
+
+var (
+	unlikely = "script, style, noscript, iframe, form, nav, header, footer, aside, button, input, select, textarea, svg"
+	positive = regexp.MustCompile(`(?i)article|body|content|entry|hentry|main|page|post|text|blog|story`)
+	negative = regexp.MustCompile(`(?i)comment|combx|disqus|foot|footer|menu|meta|nav|promo|related|share|shoutbox|sidebar|sponsor|social|widget|banner|ad-|subscribe`)
+)
+
+// Extract возвращает html основного контента страницы,
+// относительные ссылки и картинки разрешаются от pageUrl.
+func Extract(r io.Reader, pageUrl string) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return "", err
+	}
+	base, _ := url.Parse(pageUrl)
+
+	doc.Find(unlikely).Remove()
+
+	scores := make(map[*html.Node]float64)
+	var order []*goquery.Selection
+
+	doc.Find("p, pre, td, blockquote").Each(func(_ int, p *goquery.Selection) {
+		text := strings.TrimSpace(p.Text())
+		if len([]rune(text)) < minParagraphLen {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(len([]rune(text)))/100, 3)
+
+		parent := p.Parent()
+		if parent.Length() == 0 {
+			return
+		}
+		if _, ok := scores[parent.Get(0)]; !ok {
+			scores[parent.Get(0)] = classWeight(parent)
+			order = append(order, parent)
+		}
+		scores[parent.Get(0)] += score
+
+		grand := parent.Parent()
+		if grand.Length() == 0 {
+			return
+		}
+		if _, ok := scores[grand.Get(0)]; !ok {
+			scores[grand.Get(0)] = classWeight(grand)
+			order = append(order, grand)
+		}
+		scores[grand.Get(0)] += score / 2
+	})
+
+	var best *goquery.Selection
+	var bestScore float64
+	for _, s := range order {
+		score := scores[s.Get(0)] * (1 - linkDensity(s))
+		if best == nil || score > bestScore {
+			best, bestScore = s, score
+		}
+	}
+	if best == nil {
+		// страница без абзацев, пробуем article целиком
+		if best = doc.Find("article").First(); best.Length() == 0 {
+			return "", ErrNoContent
+		}
+	}
+
+	// чистим внутри кандидата блоки-ссылки, например списки "читайте также"
+	best.Find("div, ul, ol, section, table").Each(func(_ int, s *goquery.Selection) {
+		if classWeight(s) < 0 || linkDensity(s) > 0.5 {
+			s.Remove()
+		}
+	})
+	absolutize(best, base)
+
+	out, err := goquery.OuterHtml(best)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(best.Text()) == "" {
+		return "", ErrNoContent
+	}
+	return out, nil
+}
+
+// classWeight очки по class и id элемента.
+func classWeight(s *goquery.Selection) float64 {
+	var weight float64
+	for _, attr := range []string{"class", "id"} {
+		v, ok := s.Attr(attr)
+		if !ok || v == "" {
+			continue
+		}
+		if negative.MatchString(v) {
+			weight -= 25
+		}
+		if positive.MatchString(v) {
+			weight += 25
+		}
+	}
+	if goquery.NodeName(s) == "article" {
+		weight += 25
+	}
+	return weight
+}
+
+// linkDensity доля текста элемента внутри ссылок.
+func linkDensity(s *goquery.Selection) float64 {
+	total := len(strings.TrimSpace(s.Text()))
+	if total == 0 {
+		return 0
+	}
+	var links int
+	s.Find("a").Each(func(_ int, a *goquery.Selection) {
+		links += len(strings.TrimSpace(a.Text()))
+	})
+	return float64(links) / float64(total)
+}
+
+// absolutize переписывает href и src в абсолютные url.
+func absolutize(s *goquery.Selection, base *url.URL) {
+	if base == nil {
+		return
+	}
+	for _, attr := range []string{"href", "src"} {
+		s.Find("[" + attr + "]").Each(func(_ int, el *goquery.Selection) {
+			v, _ := el.Attr(attr)
+			u, err := url.Parse(strings.TrimSpace(v))
+			if err != nil {
+				el.RemoveAttr(attr)
+				return
+			}
+			el.SetAttr(attr, base.ResolveReference(u).String())
+		})
+	}
+}
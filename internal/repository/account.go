@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"rss/internal/entity"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrLoginTaken    = errors.New("login already taken")
+	ErrLoginNotFound = errors.New("login not found")
+	ErrTokenNotFound = errors.New("token not found")
+)
+
+// SetApiPassword задает логин, хэш пароля и ключ Fever для сторонних клиентов.
+// Выданные по старому паролю токены и сессии веб интерфейса отзываются.
+func (r *Repo) SetApiPassword(ctx context.Context, personPk string, login string, hash string, feverKey string) error {
+	const sql = `UPDATE person SET (login, api_password, fever_key) = ($2, $3, $4) WHERE pk = $1;`
+	const sqlTokens = `DELETE FROM api_token WHERE person_pk = $1;`
+	const sqlSessions = `DELETE FROM web_session WHERE person_pk = $1;`
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, sql, personPk, login, hash, feverKey); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, sqlTokens, personPk); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, sqlSessions, personPk)
+		return err
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == UniqueConstrintViolation {
+		return ErrLoginTaken
+	}
+	return err
+}
+
+// Credentials возвращает пользователя и хэш пароля по логину.
+func (r *Repo) Credentials(ctx context.Context, login string) (string, string, error) {
+	const sql = `SELECT pk, api_password FROM person WHERE login = $1 AND api_password IS NOT NULL;`
+
+	var personPk, hash string
+	err := r.db.QueryRow(ctx, sql, login).Scan(&personPk, &hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", "", ErrLoginNotFound
+	}
+	return personPk, hash, err
+}
+
+// CreateToken запоминает хэш выданного клиенту токена.
+func (r *Repo) CreateToken(ctx context.Context, personPk string, tokenHash string) error {
+	const sql = `INSERT INTO api_token (token_hash, person_pk) VALUES ($1, $2);`
+
+	_, err := r.db.Exec(ctx, sql, tokenHash, personPk)
+	return err
+}
+
+// AccountByToken возвращает пользователя по хэшу токена.
+func (r *Repo) AccountByToken(ctx context.Context, tokenHash string) (entity.Account, error) {
+	const sql = `SELECT p.pk, coalesce(p.login, '') FROM api_token AS t 
+	JOIN person AS p ON p.pk = t.person_pk WHERE t.token_hash = $1;`
+
+	var a entity.Account
+	err := r.db.QueryRow(ctx, sql, tokenHash).Scan(&a.PersonPk, &a.Login)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return a, ErrTokenNotFound
+	}
+	return a, err
+}
+
+// AccountByFeverKey возвращает пользователя по ключу Fever.
+func (r *Repo) AccountByFeverKey(ctx context.Context, key string) (entity.Account, error) {
+	const sql = `SELECT pk, login FROM person WHERE fever_key = $1;`
+
+	var a entity.Account
+	err := r.db.QueryRow(ctx, sql, key).Scan(&a.PersonPk, &a.Login)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return a, ErrTokenNotFound
+	}
+	return a, err
+}
+
+// CreateSession запоминает сессию веб интерфейса по хэшу токена,
+// заодно удаляет истекшие.
+func (r *Repo) CreateSession(ctx context.Context, tokenHash string, s entity.Session) error {
+	const sqlExpired = `DELETE FROM web_session WHERE expires < now();`
+	const sql = `INSERT INTO web_session (token_hash, person_pk, csrf, expires) VALUES ($1, $2, $3, $4);`
+
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, sqlExpired); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, sql, tokenHash, s.PersonPk, s.Csrf, s.Expires)
+		return err
+	})
+}
+
+// Session возвращает неистекшую сессию по хэшу токена.
+func (r *Repo) Session(ctx context.Context, tokenHash string) (entity.Session, error) {
+	const sql = `SELECT p.pk, coalesce(p.login, ''), s.csrf, s.expires FROM web_session AS s 
+	JOIN person AS p ON p.pk = s.person_pk WHERE s.token_hash = $1 AND s.expires > now();`
+
+	var s entity.Session
+	err := r.db.QueryRow(ctx, sql, tokenHash).Scan(&s.PersonPk, &s.Login, &s.Csrf, &s.Expires)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return s, ErrTokenNotFound
+	}
+	return s, err
+}
+
+// DeleteSession завершает сессию.
+func (r *Repo) DeleteSession(ctx context.Context, tokenHash string) error {
+	const sql = `DELETE FROM web_session WHERE token_hash = $1;`
+
+	_, err := r.db.Exec(ctx, sql, tokenHash)
+	return err
+}
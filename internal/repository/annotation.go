@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"rss/internal/entity"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrHighlightNotFound = errors.New("highlight not found")
+	ErrNoteNotFound      = errors.New("note not found")
+	ErrNoArticle         = errors.New("article not found")
+)
+
+const highlightColumns = `h.pk, h.article_pk, h.exact, h.prefix, h.suffix, h.start_pos, h.end_pos, h.orphaned,
+	h.content_hash, h.created, h.updated`
+
+const articleRefColumns = `article.pk, coalesce(article.title, ''), article.source_url, article.feed_pk, article.published`
+
+func scanHighlight(row pgx.CollectableRow) (entity.Highlight, error) {
+	h := entity.Highlight{Article: &entity.ArticleRef{}}
+	a := h.Article
+	err := row.Scan(&h.Pk, &h.ArticlePk, &h.Exact, &h.Prefix, &h.Suffix, &h.Start, &h.End, &h.Orphaned,
+		&h.ContentHash, &h.Created, &h.Updated, &a.Pk, &a.Title, &a.SourceUrl, &a.FeedPk, &a.Published)
+	return h, err
+}
+
+const noteColumns = `n.pk, n.article_pk, n.highlight_pk, n.body, n.created, n.updated`
+
+func scanNote(row pgx.CollectableRow) (entity.Note, error) {
+	n := entity.Note{Article: &entity.ArticleRef{}}
+	a := n.Article
+	err := row.Scan(&n.Pk, &n.ArticlePk, &n.HighlightPk, &n.Body, &n.Created, &n.Updated,
+		&a.Pk, &a.Title, &a.SourceUrl, &a.FeedPk, &a.Published)
+	return n, err
+}
+
+// ArticleContent возвращает контент статьи и его хэш для привязки выделений.
+func (r *Repo) ArticleContent(ctx context.Context, articlePk int) (string, string, error) {
+	const sql = `SELECT coalesce(content, ''), content_hash FROM article WHERE pk = $1;`
+
+	var content, hash string
+	err := r.db.QueryRow(ctx, sql, articlePk).Scan(&content, &hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", "", ErrNoArticle
+	}
+	return content, hash, err
+}
+
+// CreateHighlight сохраняет выделение пользователя.
+func (r *Repo) CreateHighlight(ctx context.Context, personPk string, h entity.Highlight) (entity.Highlight, error) {
+	const sql = `INSERT INTO highlight (person_pk, article_pk, exact, prefix, suffix, start_pos, end_pos, content_hash)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING pk, created, updated;`
+
+	err := r.db.QueryRow(ctx, sql, personPk, h.ArticlePk, h.Exact, h.Prefix, h.Suffix, h.Start, h.End, h.ContentHash).
+		Scan(&h.Pk, &h.Created, &h.Updated)
+	return h, err
+}
+
+// Highlight возвращает выделение пользователя.
+func (r *Repo) Highlight(ctx context.Context, personPk string, pk int) (entity.Highlight, error) {
+	const sql = `SELECT ` + highlightColumns + `, ` + articleRefColumns + `
+	FROM highlight AS h JOIN article ON article.pk = h.article_pk
+	WHERE h.person_pk = $1 AND h.pk = $2;`
+
+	rows, err := r.db.Query(ctx, sql, personPk, pk)
+	if err != nil {
+		return entity.Highlight{}, err
+	}
+	h, err := pgx.CollectExactlyOneRow(rows, scanHighlight)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return h, ErrHighlightNotFound
+	}
+	return h, err
+}
+
+// Highlights возвращает выделения пользователя, от новых к старым, в статье по порядку текста.
+func (r *Repo) Highlights(ctx context.Context, personPk string, f entity.HighlightFilter) ([]entity.Highlight, error) {
+	args := queryArgs{personPk}
+	sql := `SELECT ` + highlightColumns + `, ` + articleRefColumns + `
+	FROM highlight AS h JOIN article ON article.pk = h.article_pk
+	WHERE h.person_pk = $1`
+	if f.ArticlePk != 0 {
+		sql += ` AND h.article_pk = ` + args.add(f.ArticlePk) + ` ORDER BY h.start_pos, h.pk`
+	} else {
+		sql += ` ORDER BY h.created DESC, h.pk DESC`
+	}
+	if f.Limit > 0 {
+		sql += ` LIMIT ` + args.add(f.Limit)
+	}
+	if f.Offset > 0 {
+		sql += ` OFFSET ` + args.add(f.Offset)
+	}
+
+	rows, err := r.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	highlights, err := pgx.CollectRows(rows, scanHighlight)
+	if highlights == nil {
+		highlights = []entity.Highlight{}
+	}
+	return highlights, err
+}
+
+// UpdateHighlight заменяет цитату и привязку выделения.
+func (r *Repo) UpdateHighlight(ctx context.Context, personPk string, pk int, h entity.Highlight) error {
+	const sql = `UPDATE highlight SET (exact, prefix, suffix, start_pos, end_pos, content_hash, orphaned, updated) =
+	($3, $4, $5, $6, $7, $8, false, now()) WHERE person_pk = $1 AND pk = $2;`
+
+	tag, err := r.db.Exec(ctx, sql, personPk, pk, h.Exact, h.Prefix, h.Suffix, h.Start, h.End, h.ContentHash)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrHighlightNotFound
+	}
+	return nil
+}
+
+// DeleteHighlight удаляет выделение вместе с его заметками.
+func (r *Repo) DeleteHighlight(ctx context.Context, personPk string, pk int) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM highlight WHERE person_pk = $1 AND pk = $2;`, personPk, pk)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrHighlightNotFound
+	}
+	return nil
+}
+
+// StaleHighlights возвращает выделения, привязанные к другой версии статьи, articlePk 0 по всем статьям.
+func (r *Repo) StaleHighlights(ctx context.Context, personPk string, articlePk int) ([]entity.StaleHighlight, error) {
+	const sql = `SELECT h.pk, h.article_pk, h.exact, h.prefix, h.suffix, h.start_pos, h.end_pos,
+	coalesce(article.content, ''), article.content_hash
+	FROM highlight AS h JOIN article ON article.pk = h.article_pk
+	WHERE h.person_pk = $1 AND ($2 = 0 OR h.article_pk = $2) AND h.content_hash <> article.content_hash;`
+
+	rows, err := r.db.Query(ctx, sql, personPk, articlePk)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.StaleHighlight, error) {
+		var s entity.StaleHighlight
+		err := row.Scan(&s.Pk, &s.ArticlePk, &s.Exact, &s.Prefix, &s.Suffix, &s.Start, &s.End, &s.Content, &s.ArticleHash)
+		return s, err
+	})
+}
+
+// ReanchorHighlights записывает новую привязку выделений после правки статей.
+func (r *Repo) ReanchorHighlights(ctx context.Context, highlights []entity.Highlight) error {
+	const sql = `UPDATE highlight SET (prefix, suffix, start_pos, end_pos, content_hash, orphaned) =
+	($2, $3, $4, $5, $6, $7) WHERE pk = $1;`
+
+	if len(highlights) == 0 {
+		return nil
+	}
+	batch := &pgx.Batch{}
+	for _, h := range highlights {
+		batch.Queue(sql, h.Pk, h.Prefix, h.Suffix, h.Start, h.End, h.ContentHash, h.Orphaned)
+	}
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		return tx.SendBatch(ctx, batch).Close()
+	})
+}
+
+// CreateNote сохраняет заметку, выделение должно быть того же пользователя и статьи.
+func (r *Repo) CreateNote(ctx context.Context, personPk string, n entity.Note) (entity.Note, error) {
+	const sql = `INSERT INTO note (person_pk, article_pk, highlight_pk, body)
+	SELECT $1, $2, $3, $4 WHERE $3::int IS NULL
+	OR EXISTS (SELECT 1 FROM highlight WHERE pk = $3 AND person_pk = $1 AND article_pk = $2)
+	RETURNING pk, created, updated;`
+
+	err := r.db.QueryRow(ctx, sql, personPk, n.ArticlePk, n.HighlightPk, n.Body).Scan(&n.Pk, &n.Created, &n.Updated)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return n, ErrHighlightNotFound
+	}
+	return n, err
+}
+
+// Notes возвращает заметки пользователя по порядку создания, без articlePks все.
+func (r *Repo) Notes(ctx context.Context, personPk string, articlePks []int) ([]entity.Note, error) {
+	const sql = `SELECT ` + noteColumns + `, ` + articleRefColumns + `
+	FROM note AS n JOIN article ON article.pk = n.article_pk
+	WHERE n.person_pk = $1 AND ($2::int[] IS NULL OR n.article_pk = ANY($2))
+	ORDER BY n.created, n.pk;`
+
+	rows, err := r.db.Query(ctx, sql, personPk, articlePks)
+	if err != nil {
+		return nil, err
+	}
+	notes, err := pgx.CollectRows(rows, scanNote)
+	if notes == nil {
+		notes = []entity.Note{}
+	}
+	return notes, err
+}
+
+// UpdateNote меняет текст заметки.
+func (r *Repo) UpdateNote(ctx context.Context, personPk string, pk int, body string) error {
+	const sql = `UPDATE note SET (body, updated) = ($3, now()) WHERE person_pk = $1 AND pk = $2;`
+
+	tag, err := r.db.Exec(ctx, sql, personPk, pk, body)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNoteNotFound
+	}
+	return nil
+}
+
+// DeleteNote удаляет заметку.
+func (r *Repo) DeleteNote(ctx context.Context, personPk string, pk int) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM note WHERE person_pk = $1 AND pk = $2;`, personPk, pk)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNoteNotFound
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"rss/internal/entity"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// лимит выдачи поиска
+const searchLimit = 100
+
+// articleColumns колонки статьи вместе с вложениями, авторами, категориями и другими источниками сюжета
+// из подписок пользователя $1, порядок совпадает со scanArticles.
+const articleColumns = articleFields + `,
+	COALESCE((SELECT json_agg(json_build_object('pk', s.pk, 'title', s.title, 'source_url', s.source_url,
+		'feed_pk', s.feed_pk, 'published', s.published) ORDER BY s.published)
+		FROM article AS s JOIN subscribe AS ss ON ss.feed_pk = s.feed_pk AND ss.person_pk = $1
+		WHERE s.cluster_pk = article.cluster_pk AND s.pk <> article.pk), '[]')`
+
+// articleFields колонки статьи без других источников сюжета,
+// в запросах без пользователя за ними выбирается пустой список источников.
+const articleFields = `article.pk, article.title, article.content, coalesce(article.full_content, ''),
+	article.source_url, article.published, article.feed_pk,
+	COALESCE((SELECT json_agg(json_build_object('pk', e.pk, 'kind', e.kind, 'url', e.url, 'mime_type', e.mime_type,
+		'length', e.length, 'duration', e.duration, 'archived', e.blob_key IS NOT NULL) ORDER BY e.pk)
+		FROM enclosure AS e WHERE e.article_pk = article.pk), '[]'),
+	COALESCE((SELECT json_agg(json_build_object('name', au.name, 'email', au.email) ORDER BY au.name)
+		FROM article_author AS aa JOIN author AS au ON au.pk = aa.author_pk WHERE aa.article_pk = article.pk), '[]'),
+	COALESCE((SELECT json_agg(c.name ORDER BY c.name)
+		FROM article_category AS ac JOIN category AS c ON c.pk = ac.category_pk WHERE ac.article_pk = article.pk), '[]'),
+	coalesce(article.cluster_pk, 0) AS cluster_pk`
+
+// scanArticles читает строки выбранные с articleColumns.
+func scanArticles(rows pgx.Rows) ([]entity.Article, error) {
+	defer rows.Close()
+
+	var entities []entity.Article
+	for rows.Next() {
+		var a entity.Article
+		err := rows.Scan(&a.Pk, &a.Title, &a.Content, &a.FullContent, &a.SourceUrl, &a.Published, &a.FeedPk,
+			&a.Enclosures, &a.Authors, &a.Categories, &a.ClusterPk, &a.Sources)
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, a)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return entities, nil
+}
+
+// queryArgs собирает позиционные аргументы динамического запроса.
+type queryArgs []any
+
+// add добавляет аргумент и возвращает его плейсхолдер.
+func (q *queryArgs) add(v any) string {
+	*q = append(*q, v)
+	return "$" + strconv.Itoa(len(*q))
+}
+
+// articleFilter условия фильтра для пользователя $1, каждое начинается с AND.
+// Отложенные подписки видны только в выборке своего канала, скрытые правилами статьи не видны.
+func articleFilter(f entity.ArticleFilter, args *queryArgs) string {
+	var b strings.Builder
+	if f.FeedPk != 0 {
+		b.WriteString(` AND article.feed_pk = ` + args.add(f.FeedPk))
+	} else {
+		b.WriteString(` AND ` + streamAwake)
+	}
+	b.WriteString(` AND NOT EXISTS (SELECT 1 FROM article_state AS st
+		WHERE st.person_pk = $1 AND st.article_pk = article.pk AND st.hidden)`)
+	if f.Tag != "" {
+		b.WriteString(` AND EXISTS (SELECT 1 FROM article_state AS st
+		WHERE st.person_pk = $1 AND st.article_pk = article.pk AND ` + args.add(f.Tag) + ` = ANY(st.tags))`)
+	}
+	if f.FolderPk != 0 {
+		b.WriteString(` AND ` + folderFeeds(args.add(f.FolderPk)))
+	}
+	if f.Author != "" {
+		b.WriteString(` AND EXISTS (SELECT 1 FROM article_author AS aa JOIN author AS au ON au.pk = aa.author_pk
+		WHERE aa.article_pk = article.pk AND lower(au.name) = lower(` + args.add(f.Author) + `))`)
+	}
+	if f.Category != "" {
+		b.WriteString(` AND EXISTS (SELECT 1 FROM article_category AS ac JOIN category AS c ON c.pk = ac.category_pk
+		WHERE ac.article_pk = article.pk AND lower(c.name) = lower(` + args.add(f.Category) + `))`)
+	}
+	if f.Query != "" {
+		b.WriteString(` AND to_tsvector('simple', coalesce(article.title, '') || ' ' || coalesce(article.content, ''))
+		@@ websearch_to_tsquery('simple', ` + args.add(f.Query) + `)`)
+	}
+	return b.String()
+}
+
+// collapseClusters оставляет из выборки по одной, самой ранней, статье на кластер.
+// Запрос должен выбирать articleColumns, из них берутся pk, published и cluster_pk.
+func collapseClusters(sql string) string {
+	return `SELECT DISTINCT ON (CASE WHEN t.cluster_pk = 0 THEN t.pk ELSE t.cluster_pk END) t.* FROM (` + sql + `) AS t
+	ORDER BY CASE WHEN t.cluster_pk = 0 THEN t.pk ELSE t.cluster_pk END, t.published`
+}
+
+// Search ищет статьи по всем подписанным каналам, не только новые.
+func (r *Repo) Search(ctx context.Context, personPk string, f entity.ArticleFilter) ([]entity.Article, error) {
+	args := queryArgs{personPk}
+	sql := `SELECT ` + articleColumns + ` FROM article
+	JOIN subscribe AS sub ON sub.feed_pk = article.feed_pk AND sub.person_pk = $1 WHERE true` +
+		articleFilter(f, &args)
+	if f.Collapse {
+		sql = collapseClusters(sql)
+	}
+	sql = `SELECT * FROM (` + sql + `) AS found ORDER BY found.published DESC LIMIT ` + strconv.Itoa(searchLimit) + `;`
+
+	rows, err := r.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	entities, err := scanArticles(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(entities) == 0 {
+		return nil, ErrArticleNotFound
+	}
+	return entities, nil
+}
+
+// FeedCategories возвращает категории статей канала из подписок пользователя с количеством статей.
+func (r *Repo) FeedCategories(ctx context.Context, personPk string, feedPk int) ([]entity.CategoryCount, error) {
+	const sqlSubscribed = `SELECT EXISTS (SELECT 1 FROM subscribe WHERE person_pk = $1 AND feed_pk = $2);`
+	const sql = `SELECT c.name, count(*) FROM article_category AS ac
+	JOIN category AS c ON c.pk = ac.category_pk
+	JOIN article ON article.pk = ac.article_pk
+	WHERE article.feed_pk = $1 GROUP BY c.name ORDER BY count(*) DESC, c.name;`
+
+	var subscribed bool
+	if err := r.db.QueryRow(ctx, sqlSubscribed, personPk, feedPk).Scan(&subscribed); err != nil {
+		return nil, err
+	}
+	if !subscribed {
+		return nil, ErrNotSubscribed
+	}
+	rows, err := r.db.Query(ctx, sql, feedPk)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entities := []entity.CategoryCount{}
+	for rows.Next() {
+		var item entity.CategoryCount
+		if err := rows.Scan(&item.Name, &item.Count); err != nil {
+			return nil, err
+		}
+		entities = append(entities, item)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return entities, nil
+}
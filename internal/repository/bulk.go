@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+
+	"rss/internal/entity"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// BulkAddArticle массовая запись статей для больших flush.
+// Пакет копируется через COPY во временные таблицы и сливается
+// в article одним upsert по тем же правилам, что и AddArticle.
+// Результат только счетчиками, при ошибке не записывается ничего,
+// тогда пакет стоит повторить через AddArticle, чтобы изолировать плохие статьи.
+func (r *Repo) BulkAddArticle(ctx context.Context, batch []entity.Article) (entity.BulkResult, error) {
+	var res entity.BulkResult
+	results := make([]entity.ArticleResult, len(batch))
+
+	var articles, enclosures, authors, categories [][]any
+	for i, a := range batch {
+		results[i].SourceUrl = a.SourceUrl
+		if reason := validateArticle(a); reason != "" {
+			results[i].Status, results[i].Reason, results[i].Invalid = entity.ArticleFailed, reason, true
+			res.Failed++
+			continue
+		}
+		articles = append(articles, []any{a.Title, a.Content, a.SourceUrl, a.Published, a.FeedPk, a.ContentHash, int64(a.Simhash)})
+		for _, e := range a.Enclosures {
+			enclosures = append(enclosures, []any{a.SourceUrl, e.Kind, e.Url, e.MimeType, e.Length, e.Duration})
+		}
+		for _, au := range a.Authors {
+			authors = append(authors, []any{a.SourceUrl, au.Name, au.Email})
+		}
+		for _, c := range a.Categories {
+			categories = append(categories, []any{a.SourceUrl, c})
+		}
+	}
+	if len(articles) == 0 {
+		r.settleDeadLetters(ctx, batch, results)
+		return res, nil
+	}
+
+	const sqlStage = `CREATE TEMP TABLE article_stage (
+		title TEXT, content TEXT, source_url TEXT, published TIMESTAMP WITH TIME ZONE,
+		feed_pk INT, content_hash VARCHAR(64), simhash BIGINT
+	) ON COMMIT DROP;
+	CREATE TEMP TABLE enclosure_stage (
+		source_url TEXT, kind VARCHAR(16), url TEXT, mime_type VARCHAR(128), length BIGINT, duration INT
+	) ON COMMIT DROP;
+	CREATE TEMP TABLE author_stage (source_url TEXT, name VARCHAR(256), email VARCHAR(256)) ON COMMIT DROP;
+	CREATE TEMP TABLE category_stage (source_url TEXT, name VARCHAR(256)) ON COMMIT DROP;`
+
+	// DISTINCT ON потому что upsert не может дважды обновить одну строку,
+	// из повторов в пакете берется самая новая версия, с новым контентом статья заново кластеризуется
+	// и попадает в историю отдельной версией, old хэши до upsert
+	const sqlMerge = `WITH old AS (
+		SELECT a.source_url, a.content_hash FROM article AS a
+		JOIN (SELECT DISTINCT source_url FROM article_stage) AS s ON s.source_url = a.source_url
+	), up AS (
+		INSERT INTO article (title, content, source_url, published, feed_pk, content_hash, simhash)
+		SELECT DISTINCT ON (source_url) title, content, source_url, published, feed_pk, content_hash, simhash
+		FROM article_stage ORDER BY source_url, published DESC
+		ON CONFLICT (source_url) DO UPDATE SET (title, content, published, content_hash, simhash, extracted, extract_attempts, cluster_pk) = (EXCLUDED.title, EXCLUDED.content, EXCLUDED.published, EXCLUDED.content_hash, EXCLUDED.simhash, NULL, 0,
+		CASE WHEN article.content_hash = EXCLUDED.content_hash THEN article.cluster_pk END)
+		WHERE article.published < EXCLUDED.published
+		OR (article.content_hash <> EXCLUDED.content_hash AND article.published <= EXCLUDED.published)
+		RETURNING pk, source_url, content_hash, title, content, published, (xmax = 0) AS inserted
+	), rev AS (
+		INSERT INTO article_revision (article_pk, content_hash, title, content, published)
+		SELECT up.pk, up.content_hash, up.title, up.content, up.published
+		FROM up LEFT JOIN old ON old.source_url = up.source_url
+		WHERE up.content_hash <> '' AND up.content_hash IS DISTINCT FROM old.content_hash
+	)
+	SELECT (SELECT count(DISTINCT source_url) FROM article_stage),
+	count(*) FILTER (WHERE inserted), count(*) FILTER (WHERE NOT inserted) FROM up;`
+
+	const sqlEnclosure = `INSERT INTO enclosure (article_pk, kind, url, mime_type, length, duration)
+	SELECT DISTINCT ON (a.pk, e.url) a.pk, e.kind, e.url, e.mime_type, e.length, e.duration
+	FROM enclosure_stage AS e JOIN article AS a ON a.source_url = e.source_url
+	ON CONFLICT (article_pk, url) DO UPDATE SET (kind, mime_type, length, duration) = (EXCLUDED.kind, EXCLUDED.mime_type, EXCLUDED.length, EXCLUDED.duration);`
+
+	const sqlAuthor = `INSERT INTO author (name, email) SELECT DISTINCT name, email FROM author_stage ON CONFLICT DO NOTHING;
+	INSERT INTO article_author (article_pk, author_pk)
+	SELECT a.pk, au.pk FROM author_stage AS s
+	JOIN article AS a ON a.source_url = s.source_url
+	JOIN author AS au ON au.name = s.name AND au.email = s.email
+	ON CONFLICT DO NOTHING;`
+
+	const sqlCategory = `INSERT INTO category (name) SELECT DISTINCT name FROM category_stage ON CONFLICT DO NOTHING;
+	INSERT INTO article_category (article_pk, category_pk)
+	SELECT a.pk, c.pk FROM category_stage AS s
+	JOIN article AS a ON a.source_url = s.source_url
+	JOIN category AS c ON c.name = s.name
+	ON CONFLICT DO NOTHING;`
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, sqlStage); err != nil {
+			return err
+		}
+		copies := []struct {
+			table   string
+			columns []string
+			rows    [][]any
+		}{
+			{"article_stage", []string{"title", "content", "source_url", "published", "feed_pk", "content_hash", "simhash"}, articles},
+			{"enclosure_stage", []string{"source_url", "kind", "url", "mime_type", "length", "duration"}, enclosures},
+			{"author_stage", []string{"source_url", "name", "email"}, authors},
+			{"category_stage", []string{"source_url", "name"}, categories},
+		}
+		for _, c := range copies {
+			if len(c.rows) == 0 {
+				continue
+			}
+			if _, err := tx.CopyFrom(ctx, pgx.Identifier{c.table}, c.columns, pgx.CopyFromRows(c.rows)); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.QueryRow(ctx, sqlMerge).Scan(&res.Staged, &res.Inserted, &res.Updated); err != nil {
+			return err
+		}
+		for _, sql := range []string{sqlEnclosure, sqlAuthor, sqlCategory} {
+			if _, err := tx.Exec(ctx, sql); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return entity.BulkResult{}, err
+	}
+	res.Unchanged = res.Staged - res.Inserted - res.Updated
+
+	r.settleDeadLetters(ctx, batch, results)
+	return res, nil
+}
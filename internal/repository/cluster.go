@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"rss/internal/entity"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// WithLock выполняет fn под advisory lock postgres, если его удалось взять.
+// Так работу делает только один инстанс crawly, false если lock занят.
+func (r *Repo) WithLock(ctx context.Context, key int64, fn func(ctx context.Context) error) (bool, error) {
+	conn, err := r.db.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Release()
+
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1);`, key).Scan(&locked); err != nil {
+		return false, err
+	}
+	if !locked {
+		return false, nil
+	}
+	defer func() {
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1);`, key); err != nil {
+			r.log.Err(err).Int64("key", key).Msg("advisory unlock")
+		}
+	}()
+
+	return true, fn(ctx)
+}
+
+// Unclustered возвращает статьи, еще не разложенные по кластерам.
+func (r *Repo) Unclustered(ctx context.Context, limit int) ([]entity.Fingerprint, error) {
+	const sql = `SELECT pk, simhash, 0 FROM article WHERE cluster_pk IS NULL ORDER BY pk LIMIT $1;`
+
+	return r.fingerprints(ctx, sql, limit)
+}
+
+// ReleaseClusters снимает с кластеров статьи, которые ссылаются на неразложенные pks.
+// Так корень кластера, заново попавший в кластеризацию после правки, не держит бывших соседей.
+func (r *Repo) ReleaseClusters(ctx context.Context, pks []int) error {
+	const sql = `UPDATE article SET cluster_pk = NULL WHERE cluster_pk = ANY($1);`
+
+	_, err := r.db.Exec(ctx, sql, pks)
+	return err
+}
+
+// ClusterCandidates возвращает разложенные статьи опубликованные после since.
+func (r *Repo) ClusterCandidates(ctx context.Context, since time.Time) ([]entity.Fingerprint, error) {
+	const sql = `SELECT pk, simhash, cluster_pk FROM article 
+	WHERE cluster_pk IS NOT NULL AND simhash <> 0 AND published > $1;`
+
+	return r.fingerprints(ctx, sql, since)
+}
+
+// fingerprints читает pk, simhash и cluster_pk.
+func (r *Repo) fingerprints(ctx context.Context, sql string, args ...any) ([]entity.Fingerprint, error) {
+	rows, err := r.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []entity.Fingerprint
+	for rows.Next() {
+		var fp entity.Fingerprint
+		var simhash int64
+		if err := rows.Scan(&fp.Pk, &simhash, &fp.ClusterPk); err != nil {
+			return nil, err
+		}
+		fp.Simhash = uint64(simhash)
+		entities = append(entities, fp)
+	}
+	return entities, rows.Err()
+}
+
+// SetClusters сохраняет кластеры статей одним пакетом.
+func (r *Repo) SetClusters(ctx context.Context, fps []entity.Fingerprint) error {
+	const sql = `UPDATE article SET cluster_pk = $2 WHERE pk = $1;`
+
+	batch := &pgx.Batch{}
+	for _, fp := range fps {
+		batch.Queue(sql, fp.Pk, fp.ClusterPk)
+	}
+	return r.db.SendBatch(ctx, batch).Close()
+}
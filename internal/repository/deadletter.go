@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"rss/internal/entity"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// лимит source_url как в таблице article
+const maxSourceUrlLen = 256
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// validateArticle причина, по которой статью не примет база, или пустая строка.
+func validateArticle(a entity.Article) string {
+	switch {
+	case a.SourceUrl == "":
+		return "empty source_url"
+	case utf8.RuneCountInString(a.SourceUrl) > maxSourceUrlLen:
+		return "source_url longer than 256"
+	case a.FeedPk == 0:
+		return "empty feed_pk"
+	case strings.ContainsRune(a.Title, 0) || strings.ContainsRune(a.Content, 0):
+		// postgres не хранит NUL в text
+		return "title or content contains NUL byte"
+	}
+	return ""
+}
+
+// deadLetterPayload статья для jsonb без NUL, иначе postgres не примет и ее.
+func deadLetterPayload(a entity.Article) ([]byte, error) {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(data, []byte(`\u0000`)) {
+		return data, nil
+	}
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		if data[i] != '\\' {
+			out = append(out, data[i])
+			continue
+		}
+		// экранирование целиком, чтобы не принять за NUL строку \\u0000
+		if bytes.HasPrefix(data[i:], []byte(`\u0000`)) {
+			i += 5
+			continue
+		}
+		out = append(out, data[i:min(i+2, len(data))]...)
+		i++
+	}
+	return out, nil
+}
+
+// settleDeadLetters паркует упавшие статьи и убирает из очереди записанные.
+// Каждый запрос отдельно: ошибка одного не отменяет остальные.
+func (r *Repo) settleDeadLetters(ctx context.Context, batch []entity.Article, results []entity.ArticleResult) {
+	const sqlPark = `INSERT INTO article_dead_letter (source_url, feed_pk, reason, payload, content_hash, simhash) 
+	VALUES ($1, $2, $3, $4, $5, $6) 
+	ON CONFLICT (source_url) DO UPDATE SET (feed_pk, reason, payload, content_hash, simhash, attempts, updated) = 
+	(EXCLUDED.feed_pk, EXCLUDED.reason, EXCLUDED.payload, EXCLUDED.content_hash, EXCLUDED.simhash, article_dead_letter.attempts + 1, now());`
+	const sqlSettle = `DELETE FROM article_dead_letter WHERE source_url = ANY($1);`
+
+	var saved []string
+	for i, res := range results {
+		a := batch[i]
+		if res.Status != entity.ArticleFailed {
+			saved = append(saved, a.SourceUrl)
+			continue
+		}
+		payload, err := deadLetterPayload(a)
+		if err != nil {
+			r.log.Err(err).Str("url", a.SourceUrl).Msg("park dead letter")
+			continue
+		}
+		_, err = r.db.Exec(ctx, sqlPark, a.SourceUrl, a.FeedPk, res.Reason, payload, a.ContentHash, int64(a.Simhash))
+		if err != nil {
+			r.log.Err(err).Str("url", a.SourceUrl).Msg("park dead letter")
+		}
+	}
+	if len(saved) > 0 {
+		if _, err := r.db.Exec(ctx, sqlSettle, saved); err != nil {
+			r.log.Err(err).Msg("settle dead letters")
+		}
+	}
+}
+
+// DeadLetters возвращает очередь упавших статей, новые первыми.
+func (r *Repo) DeadLetters(ctx context.Context, limit int) ([]entity.DeadLetter, error) {
+	const sql = `SELECT pk, source_url, feed_pk, reason, attempts, created, updated, payload, content_hash, simhash 
+	FROM article_dead_letter ORDER BY updated DESC LIMIT $1;`
+
+	rows, err := r.db.Query(ctx, sql, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entities := []entity.DeadLetter{}
+	for rows.Next() {
+		d, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, d)
+	}
+	return entities, rows.Err()
+}
+
+// DeadLetter возвращает упавшую статью.
+func (r *Repo) DeadLetter(ctx context.Context, pk int) (entity.DeadLetter, error) {
+	const sql = `SELECT pk, source_url, feed_pk, reason, attempts, created, updated, payload, content_hash, simhash 
+	FROM article_dead_letter WHERE pk = $1;`
+
+	d, err := scanDeadLetter(r.db.QueryRow(ctx, sql, pk))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return d, ErrDeadLetterNotFound
+	}
+	return d, err
+}
+
+// DeleteDeadLetter убирает статью из очереди без повтора.
+func (r *Repo) DeleteDeadLetter(ctx context.Context, pk int) error {
+	const sql = `DELETE FROM article_dead_letter WHERE pk = $1;`
+
+	tag, err := r.db.Exec(ctx, sql, pk)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+func scanDeadLetter(row pgx.Row) (entity.DeadLetter, error) {
+	var d entity.DeadLetter
+	var simhash int64
+	err := row.Scan(&d.Pk, &d.SourceUrl, &d.FeedPk, &d.Reason, &d.Attempts, &d.Created, &d.Updated,
+		&d.Article, &d.Article.ContentHash, &simhash)
+	d.Article.Simhash = uint64(simhash)
+	return d, err
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"rss/internal/entity"
+)
+
+func TestDeadLetterPayload(t *testing.T) {
+	a := entity.Article{
+		Title:      "nul\x00title",
+		Content:    `kept \u0000 text`,
+		SourceUrl:  "https://test.local/1",
+		Categories: []string{"a\x00b"},
+	}
+	data, err := deadLetterPayload(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got entity.Article
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("payload is not json: %v\n%s", err, data)
+	}
+	if got.Title != "nultitle" || got.Content != `kept \u0000 text` || got.Categories[0] != "ab" {
+		t.Errorf("payload = %+v", got)
+	}
+}
+
+func TestSettleDeadLettersNul(t *testing.T) {
+	repo := testRepo(t)
+	ctx := context.Background()
+	feedPk, _ := testFeed(t, repo, "deadletter")
+
+	base := fmt.Sprintf("https://test.local/deadletter/%d/", time.Now().UnixNano())
+	batch := []entity.Article{
+		{Title: "nul\x00title", SourceUrl: base + "nul", FeedPk: feedPk},
+		{Title: "other", SourceUrl: base + "other", FeedPk: feedPk},
+	}
+	t.Cleanup(func() {
+		repo.db.Exec(ctx, `DELETE FROM article_dead_letter WHERE feed_pk = $1;`, feedPk)
+	})
+	failed := []entity.ArticleResult{
+		{Status: entity.ArticleFailed, Reason: validateArticle(batch[0])},
+		{Status: entity.ArticleFailed, Reason: "db error"},
+	}
+	repo.settleDeadLetters(ctx, batch, failed)
+
+	var parked int
+	err := repo.db.QueryRow(ctx, `SELECT count(*) FROM article_dead_letter WHERE feed_pk = $1;`, feedPk).Scan(&parked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parked != 2 {
+		t.Fatalf("parked %d, want both articles", parked)
+	}
+
+	// повтор записал статьи, очередь пустеет
+	repo.settleDeadLetters(ctx, batch, []entity.ArticleResult{{Status: entity.ArticleInserted}, {Status: entity.ArticleInserted}})
+	err = repo.db.QueryRow(ctx, `SELECT count(*) FROM article_dead_letter WHERE feed_pk = $1;`, feedPk).Scan(&parked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parked != 0 {
+		t.Errorf("%d still parked after replay", parked)
+	}
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"rss/internal/entity"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrDigestNotFound = errors.New("digest is not configured")
+
+const digestColumns = `person_pk::text, email, frequency, timezone, hour, weekday, last_sent, next_send`
+
+func scanDigest(row pgx.CollectableRow) (entity.Digest, error) {
+	var d entity.Digest
+	err := row.Scan(&d.PersonPk, &d.Email, &d.Frequency, &d.Timezone, &d.Hour, &d.Weekday, &d.LastSent, &d.NextSend)
+	return d, err
+}
+
+// SetDigest включает или меняет рассылку пользователя, время последнего письма сохраняется.
+func (r *Repo) SetDigest(ctx context.Context, personPk string, d entity.Digest) error {
+	const sql = `INSERT INTO digest (person_pk, email, frequency, timezone, hour, weekday, next_send)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (person_pk) DO UPDATE SET (email, frequency, timezone, hour, weekday, next_send) =
+	(EXCLUDED.email, EXCLUDED.frequency, EXCLUDED.timezone, EXCLUDED.hour, EXCLUDED.weekday, EXCLUDED.next_send);`
+
+	_, err := r.db.Exec(ctx, sql, personPk, d.Email, d.Frequency, d.Timezone, d.Hour, d.Weekday, d.NextSend)
+	return err
+}
+
+// Digest возвращает настройки рассылки пользователя.
+func (r *Repo) Digest(ctx context.Context, personPk string) (entity.Digest, error) {
+	rows, err := r.db.Query(ctx, `SELECT `+digestColumns+` FROM digest WHERE person_pk = $1;`, personPk)
+	if err != nil {
+		return entity.Digest{}, err
+	}
+	d, err := pgx.CollectExactlyOneRow(rows, scanDigest)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return d, ErrDigestNotFound
+	}
+	return d, err
+}
+
+// DeleteDigest выключает рассылку.
+func (r *Repo) DeleteDigest(ctx context.Context, personPk string) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM digest WHERE person_pk = $1;`, personPk)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDigestNotFound
+	}
+	return nil
+}
+
+// DueDigests возвращает рассылки, время которых наступило к now.
+func (r *Repo) DueDigests(ctx context.Context, now time.Time, limit int) ([]entity.Digest, error) {
+	const sql = `SELECT ` + digestColumns + ` FROM digest WHERE next_send <= $1 ORDER BY next_send LIMIT $2;`
+
+	rows, err := r.db.Query(ctx, sql, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanDigest)
+}
+
+// ClaimDigest переносит рассылку на next, если ее время еще due и письмо никто не забрал.
+// Письмо отправляется только после успешного claim, поэтому не больше одного раза.
+func (r *Repo) ClaimDigest(ctx context.Context, personPk string, due time.Time, next time.Time) (bool, error) {
+	const sql = `UPDATE digest SET (last_sent, next_send) = (now(), $3)
+	WHERE person_pk = $1 AND next_send = $2;`
+
+	tag, err := r.db.Exec(ctx, sql, personPk, due, next)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
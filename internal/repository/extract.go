@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+
+	"rss/internal/entity"
+)
+
+// попыток извлечь полный текст до того как сдаться
+const maxExtractAttempts = 3
+
+// SetFullContent включает или выключает извлечение полного текста для канала.
+func (r *Repo) SetFullContent(ctx context.Context, feedPk int, enabled bool) error {
+	const sql = `UPDATE feed SET fetch_full_content = $2 WHERE pk = $1;`
+
+	tag, err := r.db.Exec(ctx, sql, feedPk, enabled)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFoundFeedPk
+	}
+	return nil
+}
+
+// PendingExtract забирает статьи каналов с fetch_full_content без извлеченного текста.
+// extracted сбрасывается в AddArticle только при обновлении статьи,
+// так что неизмененные статьи повторно не скачиваются.
+func (r *Repo) PendingExtract(ctx context.Context, limit int) ([]entity.ExtractJob, error) {
+	const sql = `UPDATE article SET extract_attempts = extract_attempts + 1 WHERE pk IN (
+		SELECT a.pk FROM article AS a JOIN feed AS f ON f.pk = a.feed_pk
+		WHERE f.fetch_full_content AND a.extracted IS NULL AND a.extract_attempts < $2
+		ORDER BY a.pk DESC LIMIT $1 FOR UPDATE OF a SKIP LOCKED
+	) RETURNING pk, source_url;`
+
+	rows, err := r.db.Query(ctx, sql, limit, maxExtractAttempts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []entity.ExtractJob
+	for rows.Next() {
+		var j entity.ExtractJob
+		if err := rows.Scan(&j.Pk, &j.SourceUrl); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// SaveFullContent сохраняет извлеченный полный текст статьи.
+func (r *Repo) SaveFullContent(ctx context.Context, pk int, content string) error {
+	const sql = `UPDATE article SET full_content = $2, extracted = now() WHERE pk = $1;`
+
+	_, err := r.db.Exec(ctx, sql, pk, content)
+	return err
+}
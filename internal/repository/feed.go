@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"rss/internal/entity"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// лимит feed_url как в таблице feed
+const maxFeedUrlLen = 256
+
+// RecordRedirect запоминает постоянный редирект канала
+// и возвращает сколько раз подряд он вел на этот адрес.
+func (r *Repo) RecordRedirect(ctx context.Context, feedPk int, target string) (int, error) {
+	const sql = `UPDATE feed SET (redirect_url, redirect_count) = 
+	($2, CASE WHEN redirect_url = $2 THEN redirect_count + 1 ELSE 1 END) 
+	WHERE pk = $1 RETURNING redirect_count;`
+
+	if utf8.RuneCountInString(target) > maxFeedUrlLen {
+		return 0, fmt.Errorf("redirect url longer than %d", maxFeedUrlLen)
+	}
+	var count int
+	err := r.db.QueryRow(ctx, sql, feedPk, target).Scan(&count)
+	return count, err
+}
+
+// ResetRedirect сбрасывает счетчик, канал ответил без постоянного редиректа.
+func (r *Repo) ResetRedirect(ctx context.Context, feedPk int) error {
+	const sql = `UPDATE feed SET (redirect_url, redirect_count) = (NULL, 0) WHERE pk = $1 AND redirect_count > 0;`
+
+	_, err := r.db.Exec(ctx, sql, feedPk)
+	return err
+}
+
+// MoveFeed переносит канал на новый адрес и возвращает pk канала по новому адресу.
+// Если канал с таким адресом уже есть, подписки и статьи сливаются в него,
+// а старый канал остается отмеченным gone с moved_to.
+func (r *Repo) MoveFeed(ctx context.Context, feedPk int, target string) (int, error) {
+	const sqlTarget = `SELECT pk FROM feed WHERE feed_url = $1;`
+	const sqlMove = `UPDATE feed SET (feed_url, redirect_url, redirect_count) = ($2, NULL, 0) WHERE pk = $1;`
+	const sqlNotify = `INSERT INTO notification (person_pk, feed_pk, kind, message) 
+	SELECT person_pk, $2, $3, $4 FROM subscribe WHERE feed_pk = $1 AND notify;`
+	const sqlMergeSubscribe = `INSERT INTO subscribe (person_pk, feed_pk, viewed, folder_pk, title, pinned, priority, muted_until, notify) 
+	SELECT person_pk, $2, viewed, folder_pk, title, pinned, priority, muted_until, notify FROM subscribe WHERE feed_pk = $1 
+	ON CONFLICT (person_pk, feed_pk) DO NOTHING;
+	`
+	const sqlDropSubscribe = `DELETE FROM subscribe WHERE feed_pk = $1;`
+	const sqlMergeArticle = `UPDATE article SET feed_pk = $2 WHERE feed_pk = $1;`
+	const sqlRetire = `UPDATE feed SET (gone, moved_to, redirect_url, redirect_count) = (now(), $2, NULL, 0) WHERE pk = $1;`
+
+	message := fmt.Sprintf("feed moved to %s", target)
+	var targetPk int
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, sqlTarget, target).Scan(&targetPk)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// нового адреса еще нет, просто меняем url
+			targetPk = feedPk
+			if _, err := tx.Exec(ctx, sqlMove, feedPk, target); err != nil {
+				return err
+			}
+			_, err = tx.Exec(ctx, sqlNotify, feedPk, feedPk, entity.NotificationFeedMoved, message)
+			return err
+		}
+		if err != nil || targetPk == feedPk {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, sqlNotify, feedPk, targetPk, entity.NotificationFeedMoved, message); err != nil {
+			return err
+		}
+		steps := []struct {
+			sql  string
+			args []any
+		}{
+			{sqlMergeSubscribe, []any{feedPk, targetPk}},
+			{sqlDropSubscribe, []any{feedPk}},
+			{sqlMergeArticle, []any{feedPk, targetPk}},
+			{sqlRetire, []any{feedPk, targetPk}},
+		}
+		for _, s := range steps {
+			if _, err := tx.Exec(ctx, s.sql, s.args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return targetPk, err
+}
+
+// MarkGone отмечает канал удаленным у источника и уведомляет подписчиков.
+func (r *Repo) MarkGone(ctx context.Context, feedPk int) error {
+	const sqlGone = `UPDATE feed SET gone = now() WHERE pk = $1 AND gone IS NULL RETURNING feed_url;`
+	const sqlNotify = `INSERT INTO notification (person_pk, feed_pk, kind, message) 
+	SELECT person_pk, feed_pk, $2, $3 FROM subscribe WHERE feed_pk = $1 AND notify;`
+
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		var feedUrl string
+		err := tx.QueryRow(ctx, sqlGone, feedPk).Scan(&feedUrl)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// уже отмечен
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		message := fmt.Sprintf("feed %s is gone", feedUrl)
+		_, err = tx.Exec(ctx, sqlNotify, feedPk, entity.NotificationFeedGone, message)
+		return err
+	})
+}
+
+// Notifications возвращает непрочитанные уведомления пользователя.
+func (r *Repo) Notifications(ctx context.Context, personPk string) ([]entity.Notification, error) {
+	const sql = `SELECT pk, coalesce(feed_pk, 0), kind, message, created FROM notification 
+	WHERE person_pk = $1 AND NOT seen ORDER BY pk DESC;`
+
+	rows, err := r.db.Query(ctx, sql, personPk)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entities := []entity.Notification{}
+	for rows.Next() {
+		var n entity.Notification
+		if err := rows.Scan(&n.Pk, &n.FeedPk, &n.Kind, &n.Message, &n.Created); err != nil {
+			return nil, err
+		}
+		entities = append(entities, n)
+	}
+	return entities, rows.Err()
+}
+
+// SeenNotifications отмечает уведомления пользователя прочитанными.
+func (r *Repo) SeenNotifications(ctx context.Context, personPk string) error {
+	const sql = `UPDATE notification SET seen = true WHERE person_pk = $1 AND NOT seen;`
+
+	_, err := r.db.Exec(ctx, sql, personPk)
+	return err
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"rss/internal/entity"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrFolderNotFound = errors.New("folder not found")
+	ErrFolderExists   = errors.New("folder with this title already exists")
+	// ErrFolderParent родитель сам вложен, это та же папка или у папки есть подпапки
+	ErrFolderParent  = errors.New("folders nest only one level")
+	ErrNotSubscribed = errors.New("not subscribed to feed")
+)
+
+// folderFeeds условие на подписку sub из папки и ее подпапок.
+func folderFeeds(placeholder string) string {
+	return `sub.folder_pk IN (SELECT fo.pk FROM folder AS fo WHERE fo.pk = ` + placeholder + ` OR fo.parent_pk = ` + placeholder + `)`
+}
+
+// CreateFolder создает папку, с parentPk вложенную в папку верхнего уровня.
+func (r *Repo) CreateFolder(ctx context.Context, personPk string, parentPk int, title string) (entity.Folder, error) {
+	const sql = `INSERT INTO folder (person_pk, parent_pk, title) 
+	SELECT $1, nullif($2, 0), $3 WHERE $2 = 0 OR EXISTS (
+		SELECT 1 FROM folder WHERE pk = $2 AND person_pk = $1 AND parent_pk IS NULL
+	) RETURNING pk;`
+
+	f := entity.Folder{ParentPk: parentPk, Title: title, Feeds: []int{}}
+	err := r.db.QueryRow(ctx, sql, personPk, parentPk, title).Scan(&f.Pk)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return f, ErrFolderParent
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == UniqueConstrintViolation {
+		return f, ErrFolderExists
+	}
+	return f, err
+}
+
+// Folders возвращает папки пользователя с непрочитанными и каналами,
+// подпапки идут сразу за родителем.
+func (r *Repo) Folders(ctx context.Context, personPk string) ([]entity.Folder, error) {
+	sql := `SELECT f.pk, coalesce(f.parent_pk, 0), f.title,
+	(SELECT count(*)` + streamFrom + ` WHERE NOT ` + streamRead + ` AND ` + streamAwake + ` AND ` + streamVisible +
+		` AND ` + folderFeeds("f.pk") + `),
+	coalesce((SELECT array_agg(sub.feed_pk ORDER BY sub.feed_pk) FROM subscribe AS sub 
+		WHERE sub.person_pk = $1 AND sub.folder_pk = f.pk), '{}')
+	FROM folder AS f WHERE f.person_pk = $1
+	ORDER BY coalesce(f.parent_pk, f.pk), f.parent_pk NULLS FIRST, f.title;`
+
+	rows, err := r.db.Query(ctx, sql, personPk)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	folders := []entity.Folder{}
+	for rows.Next() {
+		var f entity.Folder
+		if err := rows.Scan(&f.Pk, &f.ParentPk, &f.Title, &f.Unread, &f.Feeds); err != nil {
+			return nil, err
+		}
+		folders = append(folders, f)
+	}
+	return folders, rows.Err()
+}
+
+// UpdateFolder переименовывает и переносит папку. Вложить можно только
+// в папку верхнего уровня и только папку без подпапок.
+func (r *Repo) UpdateFolder(ctx context.Context, personPk string, pk int, parentPk int, title string) error {
+	const sql = `UPDATE folder SET (parent_pk, title) = (nullif($3, 0), $4) 
+	WHERE pk = $2 AND person_pk = $1 AND ($3 = 0 OR (
+		$3 <> $2
+		AND EXISTS (SELECT 1 FROM folder WHERE pk = $3 AND person_pk = $1 AND parent_pk IS NULL)
+		AND NOT EXISTS (SELECT 1 FROM folder WHERE parent_pk = $2)
+	));`
+
+	tag, err := r.db.Exec(ctx, sql, personPk, pk, parentPk, title)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == UniqueConstrintViolation {
+		return ErrFolderExists
+	}
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		if err := r.folderExists(ctx, personPk, pk); err != nil {
+			return err
+		}
+		return ErrFolderParent
+	}
+	return nil
+}
+
+// DeleteFolder удаляет папку с подпапками, подписки остаются без папки.
+func (r *Repo) DeleteFolder(ctx context.Context, personPk string, pk int) error {
+	const sql = `DELETE FROM folder WHERE pk = $2 AND person_pk = $1;`
+
+	tag, err := r.db.Exec(ctx, sql, personPk, pk)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrFolderNotFound
+	}
+	return nil
+}
+
+// SetFolder кладет подписку в папку, folderPk 0 убирает из папки.
+func (r *Repo) SetFolder(ctx context.Context, personPk string, feedPk int, folderPk int) error {
+	const sql = `UPDATE subscribe SET folder_pk = nullif($3, 0) WHERE person_pk = $1 AND feed_pk = $2;`
+
+	if folderPk != 0 {
+		if err := r.folderExists(ctx, personPk, folderPk); err != nil {
+			return err
+		}
+	}
+	tag, err := r.db.Exec(ctx, sql, personPk, feedPk, folderPk)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotSubscribed
+	}
+	return nil
+}
+
+func (r *Repo) folderExists(ctx context.Context, personPk string, pk int) error {
+	const sql = `SELECT EXISTS (SELECT 1 FROM folder WHERE pk = $2 AND person_pk = $1);`
+
+	var ok bool
+	if err := r.db.QueryRow(ctx, sql, personPk, pk).Scan(&ok); err != nil {
+		return err
+	}
+	if !ok {
+		return ErrFolderNotFound
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"rss/internal/entity"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrInboundNotFound = errors.New("inbound address not found")
+
+// CreateInbound заводит адрес для рассылок с личным каналом и подписывает на него пользователя.
+func (r *Repo) CreateInbound(ctx context.Context, personPk string, token string, title string) (entity.Inbound, error) {
+	const sqlFeed = `INSERT INTO feed (feed_url, kind) VALUES ('newsletter:' || $1, 'newsletter') RETURNING pk;`
+	const sqlInbound = `INSERT INTO inbound_address (token, person_pk, feed_pk, title) VALUES ($1, $2, $3, $4) RETURNING pk, created;`
+	const sqlSubscribe = `INSERT INTO subscribe (person_pk, feed_pk) VALUES ($1, $2);`
+
+	in := entity.Inbound{Token: token, Title: title}
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, sqlFeed, token).Scan(&in.FeedPk); err != nil {
+			return err
+		}
+		if err := tx.QueryRow(ctx, sqlInbound, token, personPk, in.FeedPk, title).Scan(&in.Pk, &in.Created); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, sqlSubscribe, personPk, in.FeedPk)
+		return err
+	})
+	return in, err
+}
+
+// Inbounds возвращает адреса для рассылок пользователя.
+func (r *Repo) Inbounds(ctx context.Context, personPk string) ([]entity.Inbound, error) {
+	const sql = `SELECT pk, token, feed_pk, title, created FROM inbound_address WHERE person_pk = $1 ORDER BY pk;`
+
+	rows, err := r.db.Query(ctx, sql, personPk)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entities := []entity.Inbound{}
+	for rows.Next() {
+		var in entity.Inbound
+		if err := rows.Scan(&in.Pk, &in.Token, &in.FeedPk, &in.Title, &in.Created); err != nil {
+			return nil, err
+		}
+		entities = append(entities, in)
+	}
+	return entities, rows.Err()
+}
+
+// DeleteInbound удаляет адрес, письма на него больше не принимаются.
+// Канал со статьями и подписка остаются.
+func (r *Repo) DeleteInbound(ctx context.Context, personPk string, pk int) error {
+	const sql = `DELETE FROM inbound_address WHERE pk = $1 AND person_pk = $2;`
+
+	tag, err := r.db.Exec(ctx, sql, pk, personPk)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInboundNotFound
+	}
+	return nil
+}
+
+// InboundFeed возвращает канал адреса для рассылок, с Pk 0 если адреса нет.
+func (r *Repo) InboundFeed(ctx context.Context, token string) (entity.Feed, error) {
+	const sql = `SELECT f.pk, f.feed_url, f.kind, f.processors FROM inbound_address AS i 
+	JOIN feed AS f ON f.pk = i.feed_pk WHERE i.token = $1;`
+
+	var f entity.Feed
+	err := r.db.QueryRow(ctx, sql, token).Scan(&f.Pk, &f.FeedUrl, &f.Kind, &f.Processors)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.Feed{}, nil
+	}
+	return f, err
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"rss/internal/entity"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// попыток скачать вложение до того как сдаться
+const maxArchiveAttempts = 3
+
+var ErrMediaNotFound = errors.New("media not found")
+
+// SetMediaSettings обновляет настройки архивирования медиа канала.
+func (r *Repo) SetMediaSettings(ctx context.Context, s entity.MediaSettings) error {
+	const sql = `UPDATE feed SET (archive_media, media_retention_days, media_max_count) = ($2, $3, $4) WHERE pk = $1;`
+
+	tag, err := r.db.Exec(ctx, sql, s.FeedPk, s.Archive, s.RetentionDays, s.MaxCount)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFoundFeedPk
+	}
+	return nil
+}
+
+// PendingMedia забирает вложения каналов с архивированием, которые еще не скачаны.
+// Увеличение attempts в том же запросе вместе с SKIP LOCKED
+// не дает двум инстансам crawly взять одно и то же вложение.
+func (r *Repo) PendingMedia(ctx context.Context, limit int) ([]entity.MediaJob, error) {
+	const sql = `UPDATE enclosure SET attempts = attempts + 1 FROM article
+	WHERE article.pk = enclosure.article_pk AND enclosure.pk IN (
+		SELECT e.pk FROM enclosure AS e
+		JOIN article AS a ON a.pk = e.article_pk
+		JOIN feed AS f ON f.pk = a.feed_pk
+		WHERE f.archive_media AND e.blob_key IS NULL AND NOT e.evicted AND e.attempts < $2
+		ORDER BY e.pk DESC LIMIT $1 FOR UPDATE OF e SKIP LOCKED
+	) RETURNING enclosure.pk, article.feed_pk, enclosure.url, enclosure.mime_type;`
+
+	rows, err := r.db.Query(ctx, sql, limit, maxArchiveAttempts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []entity.MediaJob
+	for rows.Next() {
+		var j entity.MediaJob
+		if err := rows.Scan(&j.Pk, &j.FeedPk, &j.Url, &j.MimeType); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// MarkArchived запоминает ключ скачанного вложения.
+func (r *Repo) MarkArchived(ctx context.Context, pk int, blobKey string, length int64) error {
+	const sql = `UPDATE enclosure SET blob_key = $2, archived = now(),
+	length = CASE WHEN length = 0 THEN $3 ELSE length END WHERE pk = $1;`
+
+	_, err := r.db.Exec(ctx, sql, pk, blobKey, length)
+	return err
+}
+
+// ExpiredMedia возвращает архивные вложения, вышедшие за лимиты хранения канала.
+func (r *Repo) ExpiredMedia(ctx context.Context, limit int) ([]entity.MediaJob, error) {
+	const sql = `WITH ranked AS (
+		SELECT e.pk, a.feed_pk, e.blob_key, e.archived,
+		row_number() OVER (PARTITION BY a.feed_pk ORDER BY e.archived DESC) AS rn
+		FROM enclosure AS e JOIN article AS a ON a.pk = e.article_pk
+		WHERE e.blob_key IS NOT NULL
+	)
+	SELECT r.pk, r.feed_pk, r.blob_key FROM ranked AS r JOIN feed AS f ON f.pk = r.feed_pk
+	WHERE (f.media_retention_days > 0 AND r.archived < now() - make_interval(days => f.media_retention_days))
+	OR (f.media_max_count > 0 AND r.rn > f.media_max_count)
+	LIMIT $1;`
+
+	rows, err := r.db.Query(ctx, sql, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []entity.MediaJob
+	for rows.Next() {
+		var j entity.MediaJob
+		if err := rows.Scan(&j.Pk, &j.FeedPk, &j.BlobKey); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// MarkEvicted отмечает вложение удаленным из хранилища,
+// повторно оно скачиваться не будет.
+func (r *Repo) MarkEvicted(ctx context.Context, pk int) error {
+	const sql = `UPDATE enclosure SET (blob_key, archived, evicted) = (NULL, NULL, true) WHERE pk = $1;`
+
+	_, err := r.db.Exec(ctx, sql, pk)
+	return err
+}
+
+// Media возвращает архивное вложение с каналов, на которые подписан пользователь.
+func (r *Repo) Media(ctx context.Context, personPk string, pk int) (entity.MediaJob, error) {
+	const sql = `SELECT e.pk, a.feed_pk, e.url, e.mime_type, e.blob_key FROM enclosure AS e
+	JOIN article AS a ON a.pk = e.article_pk
+	JOIN subscribe AS sub ON sub.feed_pk = a.feed_pk AND sub.person_pk = $1
+	WHERE e.pk = $2 AND e.blob_key IS NOT NULL;`
+
+	var j entity.MediaJob
+	err := r.db.QueryRow(ctx, sql, personPk, pk).Scan(&j.Pk, &j.FeedPk, &j.Url, &j.MimeType, &j.BlobKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return j, ErrMediaNotFound
+	}
+	return j, err
+}
@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"rss/internal/entity"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// канал postgres LISTEN/NOTIFY о новых задачах обновления
+const refreshChannel = "feed_refresh"
+
+// задача в running дольше этого считается брошенной упавшим crawly
+const refreshStale = 10 * time.Minute
+
+var ErrRefreshNotFound = errors.New("refresh job not found")
+
+const refreshColumns = `pk, feed_pk, status, backfill, items, error, created, started, finished`
+
+func scanRefresh(row pgx.Row) (entity.RefreshJob, error) {
+	var j entity.RefreshJob
+	err := row.Scan(&j.Pk, &j.FeedPk, &j.Status, &j.Backfill, &j.Items, &j.Error, &j.Created, &j.Started, &j.Finished)
+	return j, err
+}
+
+// EnqueueRefresh ставит задачу обновления канала от пользователя,
+// с backfill crawly пройдет и страницы истории канала.
+// false если на канал уже есть задача в очереди или в работе.
+func (r *Repo) EnqueueRefresh(ctx context.Context, personPk string, feedPk int, backfill bool) (entity.RefreshJob, bool, error) {
+	const sql = `INSERT INTO refresh_job (feed_pk, person_pk, backfill) VALUES ($1, $2, $3)
+	ON CONFLICT DO NOTHING RETURNING ` + refreshColumns + `;`
+
+	return enqueueRefresh(scanRefresh(r.db.QueryRow(ctx, sql, feedPk, personPk, backfill)))
+}
+
+// EnqueueRefreshLimited ставит задачу обновления канала, если на канал нет задачи в очереди
+// или в работе, последняя создана раньше cooldown назад, а пользователь за час поставил меньше perHour.
+// Иначе false, причину видно по LastRefresh. Задачи пользователя ставятся по очереди под блокировкой
+// его строки, поэтому проверка лимита и вставка не разъезжаются.
+func (r *Repo) EnqueueRefreshLimited(ctx context.Context, personPk string, feedPk int, cooldown time.Duration, perHour int) (entity.RefreshJob, bool, error) {
+	const sqlLock = `SELECT 1 FROM person WHERE pk = $1 FOR NO KEY UPDATE;`
+	const sql = `INSERT INTO refresh_job (feed_pk, person_pk)
+	SELECT $1, $2 WHERE NOT EXISTS (
+		SELECT 1 FROM refresh_job WHERE feed_pk = $1 AND (status IN ('queued', 'running') OR created > now() - $3::interval)
+	) AND (SELECT count(*) FROM refresh_job WHERE person_pk = $2 AND created > now() - interval '1 hour') < $4
+	ON CONFLICT DO NOTHING RETURNING ` + refreshColumns + `;`
+
+	var (
+		j       entity.RefreshJob
+		created bool
+	)
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		var one int
+		if err := tx.QueryRow(ctx, sqlLock, personPk).Scan(&one); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNotFoundPerson
+			}
+			return err
+		}
+		var err error
+		j, created, err = enqueueRefresh(scanRefresh(tx.QueryRow(ctx, sql, feedPk, personPk, cooldown, perHour)))
+		return err
+	})
+	return j, created, err
+}
+
+// enqueueRefresh разбирает результат вставки задачи, ошибки внешних ключей как не найденные.
+func enqueueRefresh(j entity.RefreshJob, err error) (entity.RefreshJob, bool, error) {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return j, false, nil
+	}
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == ViolatesForeignKeyConstraint {
+			switch pgErr.ConstraintName {
+			case "refresh_job_feed_pk_fkey":
+				return j, false, ErrNotFoundFeedPk
+			case "refresh_job_person_pk_fkey":
+				return j, false, ErrNotFoundPerson
+			}
+		}
+		return j, false, err
+	}
+	return j, true, nil
+}
+
+// LastRefresh возвращает последнюю задачу обновления канала,
+// если задач не было, то пустую с Pk 0.
+func (r *Repo) LastRefresh(ctx context.Context, feedPk int) (entity.RefreshJob, error) {
+	const sql = `SELECT ` + refreshColumns + ` FROM refresh_job WHERE feed_pk = $1 ORDER BY pk DESC LIMIT 1;`
+
+	j, err := scanRefresh(r.db.QueryRow(ctx, sql, feedPk))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.RefreshJob{}, nil
+	}
+	return j, err
+}
+
+// Refresh возвращает задачу обновления, поставленную пользователем или на канал из его подписок.
+func (r *Repo) Refresh(ctx context.Context, personPk string, pk int) (entity.RefreshJob, error) {
+	const sql = `SELECT ` + refreshColumns + ` FROM refresh_job WHERE pk = $1 AND (person_pk = $2
+	OR EXISTS (SELECT 1 FROM subscribe WHERE person_pk = $2 AND feed_pk = refresh_job.feed_pk));`
+
+	j, err := scanRefresh(r.db.QueryRow(ctx, sql, pk, personPk))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return j, ErrRefreshNotFound
+	}
+	return j, err
+}
+
+// ClaimRefresh забирает задачи в работу, вместе с брошенными упавшим crawly.
+func (r *Repo) ClaimRefresh(ctx context.Context, limit int) ([]entity.RefreshJob, error) {
+	const sql = `UPDATE refresh_job SET status = 'running', started = now() FROM feed 
+	WHERE feed.pk = refresh_job.feed_pk AND refresh_job.pk IN (
+		SELECT pk FROM refresh_job 
+		WHERE status = 'queued' OR (status = 'running' AND started < now() - $2::interval)
+		ORDER BY pk LIMIT $1 FOR UPDATE SKIP LOCKED
+	) RETURNING refresh_job.pk, refresh_job.feed_pk, refresh_job.backfill, feed.feed_url, feed.kind, feed.source_config, feed.processors;`
+
+	rows, err := r.db.Query(ctx, sql, limit, refreshStale)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []entity.RefreshJob
+	for rows.Next() {
+		var j entity.RefreshJob
+		if err := rows.Scan(&j.Pk, &j.FeedPk, &j.Backfill, &j.Feed.FeedUrl, &j.Feed.Kind, &j.Feed.Source, &j.Feed.Processors); err != nil {
+			return nil, err
+		}
+		j.Feed.Pk = j.FeedPk
+		j.Status = entity.RefreshRunning
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// ReleaseRefresh возвращает задачу в очередь, канал сейчас уже в работе.
+func (r *Repo) ReleaseRefresh(ctx context.Context, pk int) error {
+	const sql = `UPDATE refresh_job SET (status, started) = ('queued', NULL) WHERE pk = $1;`
+
+	_, err := r.db.Exec(ctx, sql, pk)
+	return err
+}
+
+// FinishRefresh завершает задачу, с errMsg как failed.
+func (r *Repo) FinishRefresh(ctx context.Context, pk int, items int, errMsg string) error {
+	const sql = `UPDATE refresh_job SET (status, items, error, finished) = 
+	(CASE WHEN $3 = '' THEN 'done' ELSE 'failed' END, $2, $3, now()) WHERE pk = $1;`
+
+	_, err := r.db.Exec(ctx, sql, pk, items, errMsg)
+	return err
+}
+
+// ListenRefresh слушает уведомления о новых задачах и дергает notify,
+// возвращается только с ошибкой соединения или отменой ctx.
+func (r *Repo) ListenRefresh(ctx context.Context, notify func()) error {
+	conn, err := r.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+refreshChannel+";"); err != nil {
+		return err
+	}
+	for {
+		if _, err := conn.Conn().WaitForNotification(ctx); err != nil {
+			return err
+		}
+		notify()
+	}
+}
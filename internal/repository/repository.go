@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
 
 	"rss/internal/entity"
 
@@ -22,6 +23,7 @@ var (
 	ErrArticleNotFound   = errors.New("there are no new articles for you")
 	ErrAlreadySubscribed = errors.New("already subscribed")
 	ErrNotFoundFeedPk    = errors.New("not found feed_pk")
+	ErrNotFoundPerson    = errors.New("not found person")
 )
 
 type Repo struct {
@@ -43,9 +45,11 @@ func New(ctx context.Context, pgString string, log zerolog.Logger) (*Repo, error
 	return repo, nil
 }
 
-// Available возвращает список доступных RSS каналов.
+// Available возвращает список доступных RSS каналов, без удаленных, переехавших
+// и личных каналов рассылок.
 func (r *Repo) Available(ctx context.Context) ([]entity.Feed, error) {
-	const sql = `SELECT pk, feed_url FROM feed ORDER BY pk DESC;`
+	const sql = `SELECT pk, feed_url, kind, source_config, processors FROM feed 
+	WHERE gone IS NULL AND kind <> 'newsletter' ORDER BY pk DESC;`
 
 	rows, err := r.db.Query(ctx, sql)
 	if err != nil {
@@ -56,7 +60,7 @@ func (r *Repo) Available(ctx context.Context) ([]entity.Feed, error) {
 	var entities []entity.Feed
 	for rows.Next() {
 		var item entity.Feed
-		if err := rows.Scan(&item.Pk, &item.FeedUrl); err != nil {
+		if err := rows.Scan(&item.Pk, &item.FeedUrl, &item.Kind, &item.Source, &item.Processors); err != nil {
 			return nil, err
 		}
 		entities = append(entities, item)
@@ -69,11 +73,13 @@ func (r *Repo) Available(ctx context.Context) ([]entity.Feed, error) {
 	return entities, nil
 }
 
-// AddFeed добавляет новый RSS источник.
-func (r *Repo) AddFeed(ctx context.Context, feedUrl string) error {
-	const sql = `INSERT INTO feed(feed_url) VALUES ($1);`
+// AddFeed добавляет новый источник
+// и ставит задачу на его первое скачивание вместе с историей.
+func (r *Repo) AddFeed(ctx context.Context, feed entity.Feed) error {
+	const sql = `WITH f AS (INSERT INTO feed(feed_url, kind, source_config) VALUES ($1, $2, $3) RETURNING pk) 
+	INSERT INTO refresh_job (feed_pk, backfill) SELECT pk, true FROM f;`
 
-	_, err := r.db.Exec(ctx, sql, feedUrl)
+	_, err := r.db.Exec(ctx, sql, feed.FeedUrl, feed.Kind, feed.Source)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == UniqueConstrintViolation {
@@ -86,11 +92,13 @@ func (r *Repo) AddFeed(ctx context.Context, feedUrl string) error {
 }
 
 // Subscribe подписывает пользователя на RSS канал.
-func (r *Repo) Subscribe(ctx context.Context, personPk string, feedPk string) error {
-	// viewed будет по умолчанию transaction_timestamp() - INTERVAL '1 MONTH'
-	const sql = `INSERT INTO subscribe(person_pk, feed_pk) VALUES ($1, $2);`
+// На чужой канал рассылок подписаться нельзя, он как будто не существует.
+// Статьи записанные до viewed сразу прочитаны.
+func (r *Repo) Subscribe(ctx context.Context, personPk string, feedPk string, viewed time.Time) error {
+	const sql = `INSERT INTO subscribe(person_pk, feed_pk, viewed) 
+	SELECT $1, pk, $3 FROM feed WHERE pk = $2 AND kind <> 'newsletter';`
 
-	_, err := r.db.Exec(ctx, sql, personPk, feedPk)
+	tag, err := r.db.Exec(ctx, sql, personPk, feedPk, viewed)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
@@ -110,7 +118,9 @@ func (r *Repo) Subscribe(ctx context.Context, personPk string, feedPk string) er
 		}
 		return err
 	}
-
+	if tag.RowsAffected() == 0 {
+		return ErrNotFoundFeedPk
+	}
 	return nil
 }
 
@@ -125,25 +135,23 @@ func (r *Repo) Unsubscribe(ctx context.Context, personPk string, feedPk string)
 	return nil
 }
 
-// Article возвращает список статей для пользователя.
-func (r *Repo) Article(ctx context.Context, personPk string) ([]entity.Article, error) {
-	const sql = `SELECT pk, title, content, source_url, published, article.feed_pk FROM article 
-	JOIN subscribe as sub ON sub.feed_pk = article.feed_pk AND sub.person_pk = $1 WHERE recorded > sub.viewed;`
+// Article возвращает список новых статей для пользователя.
+func (r *Repo) Article(ctx context.Context, personPk string, f entity.ArticleFilter) ([]entity.Article, error) {
+	args := queryArgs{personPk}
+	sql := `SELECT ` + articleColumns + ` FROM article 
+	JOIN subscribe as sub ON sub.feed_pk = article.feed_pk AND sub.person_pk = $1 WHERE recorded > sub.viewed` +
+		articleFilter(f, &args)
+	if f.Collapse {
+		sql = collapseClusters(sql)
+	}
 
-	rows, err := r.db.Query(ctx, sql, personPk)
+	rows, err := r.db.Query(ctx, sql, args...)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var entities []entity.Article
-	for rows.Next() {
-		var a entity.Article
-		rows.Scan(&a.Pk, &a.Title, &a.Content, &a.SourceUrl, &a.Published, &a.FeedPk)
-		entities = append(entities, a)
-	}
-	if rows.Err() != nil {
-		return nil, rows.Err()
+	entities, err := scanArticles(rows)
+	if err != nil {
+		return nil, err
 	}
 	if len(entities) == 0 {
 		// по сути чтобы не запускать Viewed()
@@ -153,40 +161,135 @@ func (r *Repo) Article(ctx context.Context, personPk string) ([]entity.Article,
 	return entities, nil
 }
 
-// AddArticle добавляет пакет статей.
-func (r *Repo) AddArticle(ctx context.Context, batch []entity.Article) {
+// AddArticle добавляет пакет статей и возвращает результат по каждой статье.
+// Пакет пишется одной транзакцией, если она упала, то каждая статья отдельно,
+// чтобы одна плохая статья не теряла остальные. Упавшие статьи паркуются в article_dead_letter.
+func (r *Repo) AddArticle(ctx context.Context, batch []entity.Article) []entity.ArticleResult {
+	results := make([]entity.ArticleResult, len(batch))
+	valid := make([]int, 0, len(batch))
+	for i, a := range batch {
+		results[i].SourceUrl = a.SourceUrl
+		// заведомо плохие статьи даже не отправляем
+		if reason := validateArticle(a); reason != "" {
+			results[i].Status, results[i].Reason, results[i].Invalid = entity.ArticleFailed, reason, true
+			continue
+		}
+		valid = append(valid, i)
+	}
+
+	if err := r.saveArticles(ctx, batch, valid, results); err != nil {
+		r.log.Err(err).Int("len", len(valid)).Msg("batch failed, isolate articles")
+		for _, i := range valid {
+			if err := r.saveArticles(ctx, batch, []int{i}, results); err != nil {
+				results[i].Status, results[i].Reason = entity.ArticleFailed, err.Error()
+				var pgErr *pgconn.PgError
+				if errors.As(err, &pgErr) {
+					r.log.Err(err).Msg("pg error")
+				}
+				r.log.Err(err).Str("url", batch[i].SourceUrl).Msg("db error")
+			}
+		}
+	}
+
+	r.settleDeadLetters(ctx, batch, results)
+	return results
+}
+
+// saveArticles пишет статьи batch[idx] одной транзакцией,
+// статусы в results проставляются только после commit.
+func (r *Repo) saveArticles(ctx context.Context, batch []entity.Article, idx []int, results []entity.ArticleResult) error {
+	if len(idx) == 0 {
+		return nil
+	}
+	// статья перезаписывается если изменился хэш контента (правка без смены даты),
+	// но не более старой версией, либо по старому правилу если дата новее.
+	// xmax = 0 только у вставленной строки, без строки статья не изменилась.
+	// С новым контентом статья заново попадает в кластеризацию.
+	// Каждая смена хэша пишется в историю отдельной версией, old видит хэш до upsert
+	const sql = `WITH old AS (SELECT content_hash FROM article WHERE source_url = $3), 
+	up AS (INSERT INTO article (title, content, source_url, published, feed_pk, content_hash, simhash) VALUES ($1, $2, $3, $4, $5, $6, $7) 
+	ON CONFLICT (source_url) DO UPDATE SET (title, content, published, content_hash, simhash, extracted, extract_attempts, cluster_pk) = (EXCLUDED.title, EXCLUDED.content, EXCLUDED.published, EXCLUDED.content_hash, EXCLUDED.simhash, NULL, 0,
+		CASE WHEN article.content_hash = EXCLUDED.content_hash THEN article.cluster_pk END) 
+	WHERE article.published < EXCLUDED.published 
+	OR (article.content_hash <> EXCLUDED.content_hash AND article.published <= EXCLUDED.published) 
+	RETURNING pk, content_hash, title, content, published, (xmax = 0) AS inserted), 
+	rev AS (INSERT INTO article_revision (article_pk, content_hash, title, content, published) 
+	SELECT up.pk, up.content_hash, up.title, up.content, up.published FROM up 
+	WHERE up.content_hash <> '' AND up.content_hash IS DISTINCT FROM (SELECT content_hash FROM old)) 
+	SELECT inserted FROM up;`
+	// вложения привязываем к статье по source_url
+	const sqlEnclosure = `INSERT INTO enclosure (article_pk, kind, url, mime_type, length, duration) 
+	SELECT pk, $2, $3, $4, $5, $6 FROM article WHERE source_url = $1 
+	ON CONFLICT (article_pk, url) DO UPDATE SET (kind, mime_type, length, duration) = (EXCLUDED.kind, EXCLUDED.mime_type, EXCLUDED.length, EXCLUDED.duration);`
+
+	// авторы и категории нормализованы в свои таблицы
+	const sqlAuthor = `WITH au AS (INSERT INTO author (name, email) VALUES ($2, $3) 
+	ON CONFLICT (name, email) DO UPDATE SET name = EXCLUDED.name RETURNING pk) 
+	INSERT INTO article_author (article_pk, author_pk) SELECT article.pk, au.pk FROM article, au 
+	WHERE article.source_url = $1 ON CONFLICT DO NOTHING;`
+	const sqlCategory = `WITH c AS (INSERT INTO category (name) VALUES ($2) 
+	ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name RETURNING pk) 
+	INSERT INTO article_category (article_pk, category_pk) SELECT article.pk, c.pk FROM article, c 
+	WHERE article.source_url = $1 ON CONFLICT DO NOTHING;`
+
 	pgBatch := &pgx.Batch{}
-	const sql = `INSERT INTO article (title, content, source_url, published, feed_pk) VALUES ($1, $2, $3, $4, $5) 
-	ON CONFLICT (source_url) DO UPDATE SET (title, content, published) = (EXCLUDED.title, EXCLUDED.content, EXCLUDED.published) 
-	WHERE article.published < EXCLUDED.published;`
-
-	for _, a := range batch {
-		pgBatch.Queue(sql, a.Title, a.Content, a.SourceUrl, a.Published, a.FeedPk)
-	}
-
-	results := r.db.SendBatch(ctx, pgBatch)
-	defer results.Close()
-
-	for _, item := range batch {
-		_, err := results.Exec()
-		if err != nil {
-			// SendBatch при первой ошибке не выполнит последующие insert
-			// хотя CONFLICT по уникальности url обновит article
-			// если article.published < EXCLUDED.published и пойдет дальше
-			var pgErr *pgconn.PgError
-			if errors.As(err, &pgErr) {
-				r.log.Err(err).Msg("pg error")
+	// количество запросов после upsert статьи
+	extra := make([]int, len(idx))
+	for n, i := range idx {
+		a := batch[i]
+		pgBatch.Queue(sql, a.Title, a.Content, a.SourceUrl, a.Published, a.FeedPk, a.ContentHash, int64(a.Simhash))
+		for _, e := range a.Enclosures {
+			pgBatch.Queue(sqlEnclosure, a.SourceUrl, e.Kind, e.Url, e.MimeType, e.Length, e.Duration)
+		}
+		for _, au := range a.Authors {
+			pgBatch.Queue(sqlAuthor, a.SourceUrl, au.Name, au.Email)
+		}
+		for _, c := range a.Categories {
+			pgBatch.Queue(sqlCategory, a.SourceUrl, c)
+		}
+		extra[n] += len(a.Enclosures) + len(a.Authors) + len(a.Categories)
+	}
+
+	statuses := make([]string, len(idx))
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		br := tx.SendBatch(ctx, pgBatch)
+		defer br.Close()
+
+		for n := range idx {
+			var inserted bool
+			err := br.QueryRow().Scan(&inserted)
+			switch {
+			case errors.Is(err, pgx.ErrNoRows):
+				statuses[n] = entity.ArticleUnchanged
+			case err != nil:
+				return err
+			case inserted:
+				statuses[n] = entity.ArticleInserted
+			default:
+				statuses[n] = entity.ArticleUpdated
+			}
+			for k := 0; k < extra[n]; k++ {
+				if _, err := br.Exec(); err != nil {
+					return err
+				}
 			}
-			r.log.Err(err).Str("url", item.SourceUrl).Msg("db error")
-			// мы тут не возвращаем возможные ошибки, только логгируем
-			// всеравно не понятно как действовать, просто игнорируем
 		}
+		return br.Close()
+	})
+	if err != nil {
+		return err
+	}
+
+	for n, i := range idx {
+		results[i].Status, results[i].Reason = statuses[n], ""
 	}
+	return nil
 }
 
 // Viewed обновляет дату последнего просмотра у пользователя.
+// Отложенные подписки не показывались, их статьи остаются новыми.
 func (r *Repo) Viewed(ctx context.Context, personPk string) error {
-	const sql = `UPDATE subscribe SET viewed = now() WHERE subscribe.person_pk = $1;`
+	const sql = `UPDATE subscribe AS sub SET viewed = now() WHERE sub.person_pk = $1 AND ` + streamAwake + `;`
 
 	_, err := r.db.Exec(ctx, sql, personPk)
 	if err != nil {
@@ -194,3 +297,34 @@ func (r *Repo) Viewed(ctx context.Context, personPk string) error {
 	}
 	return nil
 }
+
+// SetSource меняет вид источника канала и его разметку.
+func (r *Repo) SetSource(ctx context.Context, feedPk int, kind string, src entity.SourceConfig) error {
+	const sql = `UPDATE feed SET (kind, source_config) = ($2, $3) WHERE pk = $1;`
+
+	tag, err := r.db.Exec(ctx, sql, feedPk, kind, src)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFoundFeedPk
+	}
+	return nil
+}
+
+// SetProcessors меняет цепочку процессоров статей канала.
+func (r *Repo) SetProcessors(ctx context.Context, feedPk int, cfgs []entity.ProcessorConfig) error {
+	const sql = `UPDATE feed SET processors = $2 WHERE pk = $1;`
+
+	if cfgs == nil {
+		cfgs = []entity.ProcessorConfig{}
+	}
+	tag, err := r.db.Exec(ctx, sql, feedPk, cfgs)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFoundFeedPk
+	}
+	return nil
+}
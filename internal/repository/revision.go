@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"rss/internal/entity"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// revisionFrom версии статей из подписок пользователя $1.
+const revisionFrom = ` FROM article_revision AS rev JOIN article ON article.pk = rev.article_pk
+	JOIN subscribe AS sub ON sub.feed_pk = article.feed_pk AND sub.person_pk = $1`
+
+// Revisions возвращает историю версий статьи без контента, от новых к старым.
+// Статья не из подписок пользователя как статья без версий.
+func (r *Repo) Revisions(ctx context.Context, personPk string, articlePk int) ([]entity.Revision, error) {
+	const sql = `SELECT rev.pk, rev.article_pk, rev.content_hash, coalesce(rev.title, ''), rev.published, rev.recorded` +
+		revisionFrom + ` WHERE rev.article_pk = $2 ORDER BY rev.recorded DESC, rev.pk DESC;`
+
+	rows, err := r.db.Query(ctx, sql, personPk, articlePk)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []entity.Revision
+	for rows.Next() {
+		var rev entity.Revision
+		if err := rows.Scan(&rev.Pk, &rev.ArticlePk, &rev.ContentHash, &rev.Title, &rev.Published, &rev.Recorded); err != nil {
+			return nil, err
+		}
+		entities = append(entities, rev)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	if len(entities) == 0 {
+		return nil, ErrRevisionNotFound
+	}
+	return entities, nil
+}
+
+// Revision возвращает версию статьи вместе с контентом.
+func (r *Repo) Revision(ctx context.Context, personPk string, articlePk int, pk int) (entity.Revision, error) {
+	const sql = `SELECT rev.pk, rev.article_pk, rev.content_hash, coalesce(rev.title, ''), coalesce(rev.content, ''),
+	rev.published, rev.recorded` + revisionFrom + ` WHERE rev.article_pk = $2 AND rev.pk = $3;`
+
+	var rev entity.Revision
+	err := r.db.QueryRow(ctx, sql, personPk, articlePk, pk).Scan(
+		&rev.Pk, &rev.ArticlePk, &rev.ContentHash, &rev.Title, &rev.Content, &rev.Published, &rev.Recorded,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return rev, ErrRevisionNotFound
+	}
+	return rev, err
+}
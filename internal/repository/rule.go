@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"rss/internal/entity"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrRuleNotFound = errors.New("rule not found")
+
+const ruleColumns = `pk, person_pk::text, title, condition, actions, enabled, created`
+
+func scanRule(row pgx.CollectableRow) (entity.Rule, error) {
+	var r entity.Rule
+	err := row.Scan(&r.Pk, &r.PersonPk, &r.Title, &r.Condition, &r.Actions, &r.Enabled, &r.Created)
+	return r, err
+}
+
+// CreateRule создает правило пользователя.
+func (r *Repo) CreateRule(ctx context.Context, personPk string, rule entity.Rule) (entity.Rule, error) {
+	const sql = `INSERT INTO rule (person_pk, title, condition, actions, enabled)
+	VALUES ($1, $2, $3, $4, $5) RETURNING pk, created;`
+
+	rule.PersonPk = personPk
+	err := r.db.QueryRow(ctx, sql, personPk, rule.Title, rule.Condition, rule.Actions, rule.Enabled).
+		Scan(&rule.Pk, &rule.Created)
+	return rule, err
+}
+
+// Rules возвращает правила пользователя в порядке создания.
+func (r *Repo) Rules(ctx context.Context, personPk string) ([]entity.Rule, error) {
+	const sql = `SELECT ` + ruleColumns + ` FROM rule WHERE person_pk = $1 ORDER BY pk;`
+
+	rows, err := r.db.Query(ctx, sql, personPk)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := pgx.CollectRows(rows, scanRule)
+	if rules == nil {
+		rules = []entity.Rule{}
+	}
+	return rules, err
+}
+
+// Rule возвращает правило пользователя.
+func (r *Repo) Rule(ctx context.Context, personPk string, pk int) (entity.Rule, error) {
+	const sql = `SELECT ` + ruleColumns + ` FROM rule WHERE person_pk = $1 AND pk = $2;`
+
+	rows, err := r.db.Query(ctx, sql, personPk, pk)
+	if err != nil {
+		return entity.Rule{}, err
+	}
+	rule, err := pgx.CollectExactlyOneRow(rows, scanRule)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return rule, ErrRuleNotFound
+	}
+	return rule, err
+}
+
+// UpdateRule заменяет правило пользователя целиком.
+func (r *Repo) UpdateRule(ctx context.Context, personPk string, pk int, rule entity.Rule) error {
+	const sql = `UPDATE rule SET (title, condition, actions, enabled) = ($3, $4, $5, $6)
+	WHERE person_pk = $1 AND pk = $2;`
+
+	tag, err := r.db.Exec(ctx, sql, personPk, pk, rule.Title, rule.Condition, rule.Actions, rule.Enabled)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
+
+// DeleteRule удаляет правило, примененные действия остаются.
+func (r *Repo) DeleteRule(ctx context.Context, personPk string, pk int) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM rule WHERE person_pk = $1 AND pk = $2;`, personPk, pk)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
+
+// Unruled возвращает статьи, к которым еще не применялись правила.
+func (r *Repo) Unruled(ctx context.Context, limit int) ([]entity.Article, error) {
+	const sql = `SELECT ` + articleFields + `, '[]'::json FROM article WHERE NOT ruled ORDER BY pk LIMIT $1;`
+
+	rows, err := r.db.Query(ctx, sql, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanArticles(rows)
+}
+
+// FeedRules возвращает включенные правила подписчиков каналов по pk канала.
+func (r *Repo) FeedRules(ctx context.Context, feedPks []int) (map[int][]entity.Rule, error) {
+	const sql = `SELECT sub.feed_pk, rule.pk, rule.person_pk::text, rule.title, rule.condition, rule.actions,
+	rule.enabled, rule.created FROM rule
+	JOIN subscribe AS sub ON sub.person_pk = rule.person_pk
+	WHERE rule.enabled AND sub.feed_pk = ANY($1) ORDER BY rule.pk;`
+
+	rows, err := r.db.Query(ctx, sql, feedPks)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := make(map[int][]entity.Rule)
+	for rows.Next() {
+		var feedPk int
+		var rule entity.Rule
+		err := rows.Scan(&feedPk, &rule.Pk, &rule.PersonPk, &rule.Title, &rule.Condition, &rule.Actions,
+			&rule.Enabled, &rule.Created)
+		if err != nil {
+			return nil, err
+		}
+		rules[feedPk] = append(rules[feedPk], rule)
+	}
+	return rules, rows.Err()
+}
+
+// ApplyRules применяет действия совпавших правил и отмечает статьи ruled обработанными.
+// Действия ставятся только на статьи подписок владельца правила.
+func (r *Repo) ApplyRules(ctx context.Context, hits []entity.RuleHit, ruled []int) error {
+	const sqlState = `INSERT INTO article_state (person_pk, article_pk, read, starred, hidden, tags)
+	SELECT $1, article.pk, $3::boolean, coalesce($4::boolean, false), coalesce($5::boolean, false), $6::text[]
+	FROM article JOIN subscribe AS sub ON sub.feed_pk = article.feed_pk AND sub.person_pk = $1
+	WHERE article.pk = $2
+	ON CONFLICT (person_pk, article_pk) DO UPDATE SET
+	read = coalesce($3::boolean, article_state.read),
+	starred = coalesce($4::boolean, article_state.starred),
+	hidden = coalesce($5::boolean, article_state.hidden),
+	tags = ARRAY(SELECT DISTINCT unnest(article_state.tags || $6::text[])),
+	updated = now();`
+	const sqlNotify = `INSERT INTO notification (person_pk, feed_pk, kind, message)
+	SELECT $1, $2, $3, $4 WHERE EXISTS (SELECT 1 FROM subscribe WHERE person_pk = $1 AND feed_pk = $2);`
+	const sqlRuled = `UPDATE article SET ruled = true WHERE pk = ANY($1);`
+
+	batch := &pgx.Batch{}
+	for _, h := range hits {
+		var read, starred, hidden *bool
+		tags := []string{}
+		notify := false
+		for _, a := range h.Rule.Actions {
+			switch a.Type {
+			case entity.RuleRead:
+				read = ptrTrue()
+			case entity.RuleStar:
+				starred = ptrTrue()
+			case entity.RuleHide:
+				hidden = ptrTrue()
+			case entity.RuleTag:
+				tags = append(tags, strings.TrimSpace(a.Value))
+			case entity.RuleNotify:
+				notify = true
+			}
+		}
+		if read != nil || starred != nil || hidden != nil || len(tags) > 0 {
+			batch.Queue(sqlState, h.Rule.PersonPk, h.Article.Pk, read, starred, hidden, tags)
+		}
+		if notify {
+			message := fmt.Sprintf("%s: %s %s", h.Rule.Title, h.Article.Title, h.Article.SourceUrl)
+			batch.Queue(sqlNotify, h.Rule.PersonPk, h.Article.FeedPk, entity.NotificationRule, message)
+		}
+	}
+	if len(ruled) > 0 {
+		batch.Queue(sqlRuled, ruled)
+	}
+	if batch.Len() == 0 {
+		return nil
+	}
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		return tx.SendBatch(ctx, batch).Close()
+	})
+}
+
+func ptrTrue() *bool {
+	v := true
+	return &v
+}
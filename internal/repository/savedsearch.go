@@ -0,0 +1,238 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"rss/internal/entity"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrSavedSearchNotFound = errors.New("saved search not found")
+	ErrAlertCode           = errors.New("wrong or expired alert confirmation code")
+)
+
+// savedSearchMatch условие на статью article под сохраненный поиск s.
+// Письма рассылок попадают только в поиски владельца входящего адреса.
+const savedSearchMatch = `NOT EXISTS (SELECT 1 FROM feed WHERE feed.pk = article.feed_pk AND feed.kind = 'newsletter'
+		AND NOT EXISTS (SELECT 1 FROM inbound_address AS ia WHERE ia.feed_pk = feed.pk AND ia.person_pk = s.person_pk))
+	AND (s.query = '' OR to_tsvector('simple', coalesce(article.title, '') || ' ' || coalesce(article.content, ''))
+		@@ websearch_to_tsquery('simple', s.query))
+	AND (s.feeds = '{}' OR article.feed_pk = ANY(s.feeds))
+	AND (s.categories = '{}' OR EXISTS (SELECT 1 FROM article_category AS ac JOIN category AS c ON c.pk = ac.category_pk
+		WHERE ac.article_pk = article.pk AND lower(c.name) = ANY(s.categories)))
+	AND (s.window_days = 0 OR article.published >= now() - make_interval(days => s.window_days))`
+
+// savedSearchUnread непрочитанные сохраненного поиска s: записанные после просмотра,
+// но не раньше 30 дней и не больше 1000, иначе счетчик проверяет запрос на всех статьях.
+const savedSearchUnread = `(SELECT count(*) FROM (SELECT 1 FROM article
+	WHERE article.recorded > greatest(s.viewed, now() - interval '30 days') AND ` + savedSearchMatch + `
+	LIMIT 1000) AS unread)`
+
+const savedSearchColumns = `s.pk, s.title, s.query, s.feeds, s.categories, s.window_days, s.alert_url, s.alert_email,
+	s.alert_email_confirmed, s.viewed, s.created`
+
+func scanSavedSearch(row pgx.CollectableRow) (entity.SavedSearch, error) {
+	var s entity.SavedSearch
+	err := row.Scan(&s.Pk, &s.Title, &s.Query, &s.Feeds, &s.Categories, &s.WindowDays, &s.AlertUrl, &s.AlertEmail,
+		&s.AlertEmailConfirmed, &s.Viewed, &s.Created, &s.Unread)
+	return s, err
+}
+
+// CreateSavedSearch сохраняет поиск, статьи до создания прочитанные.
+func (r *Repo) CreateSavedSearch(ctx context.Context, personPk string, s entity.SavedSearch) (entity.SavedSearch, error) {
+	const sql = `INSERT INTO saved_search (person_pk, title, query, feeds, categories, window_days, alert_url, alert_email)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING pk, viewed, created;`
+
+	err := r.db.QueryRow(ctx, sql, personPk, s.Title, s.Query, s.Feeds, s.Categories, s.WindowDays, s.AlertUrl, s.AlertEmail).
+		Scan(&s.Pk, &s.Viewed, &s.Created)
+	return s, err
+}
+
+// SavedSearches возвращает сохраненные поиски пользователя с непрочитанными.
+func (r *Repo) SavedSearches(ctx context.Context, personPk string) ([]entity.SavedSearch, error) {
+	const sql = `SELECT ` + savedSearchColumns + `, ` + savedSearchUnread + `
+	FROM saved_search AS s WHERE s.person_pk = $1 ORDER BY s.pk;`
+
+	rows, err := r.db.Query(ctx, sql, personPk)
+	if err != nil {
+		return nil, err
+	}
+	searches, err := pgx.CollectRows(rows, scanSavedSearch)
+	if searches == nil {
+		searches = []entity.SavedSearch{}
+	}
+	return searches, err
+}
+
+// SavedSearch возвращает сохраненный поиск пользователя с непрочитанными.
+func (r *Repo) SavedSearch(ctx context.Context, personPk string, pk int) (entity.SavedSearch, error) {
+	const sql = `SELECT ` + savedSearchColumns + `, ` + savedSearchUnread + `
+	FROM saved_search AS s WHERE s.person_pk = $1 AND s.pk = $2;`
+
+	rows, err := r.db.Query(ctx, sql, personPk, pk)
+	if err != nil {
+		return entity.SavedSearch{}, err
+	}
+	s, err := pgx.CollectExactlyOneRow(rows, scanSavedSearch)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return s, ErrSavedSearchNotFound
+	}
+	return s, err
+}
+
+// UpdateSavedSearch заменяет условия и оповещения сохраненного поиска,
+// новый alert_email снова ждет подтверждения.
+func (r *Repo) UpdateSavedSearch(ctx context.Context, personPk string, pk int, s entity.SavedSearch) error {
+	const sql = `UPDATE saved_search SET (title, query, feeds, categories, window_days, alert_url, alert_email,
+	alert_email_confirmed, alert_email_code) = ($3, $4, $5, $6, $7, $8, $9,
+	alert_email = $9 AND alert_email_confirmed, CASE WHEN alert_email = $9 THEN alert_email_code ELSE '' END)
+	WHERE person_pk = $1 AND pk = $2;`
+
+	tag, err := r.db.Exec(ctx, sql, personPk, pk, s.Title, s.Query, s.Feeds, s.Categories, s.WindowDays, s.AlertUrl, s.AlertEmail)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSavedSearchNotFound
+	}
+	return nil
+}
+
+// DeleteSavedSearch удаляет сохраненный поиск.
+func (r *Repo) DeleteSavedSearch(ctx context.Context, personPk string, pk int) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM saved_search WHERE person_pk = $1 AND pk = $2;`, personPk, pk)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSavedSearchNotFound
+	}
+	return nil
+}
+
+// SavedSearchArticles возвращает статьи сохраненного поиска по всем каналам, сначала новые.
+// С unread только записанные после последнего просмотра.
+func (r *Repo) SavedSearchArticles(ctx context.Context, personPk string, pk int, unread bool, limit int, offset int) ([]entity.Article, error) {
+	if limit <= 0 || limit > StreamLimit {
+		limit = StreamLimit
+	}
+	sql := `SELECT ` + articleColumns + ` FROM saved_search AS s JOIN article ON ` + savedSearchMatch + `
+	WHERE s.person_pk = $1 AND s.pk = $2 AND (NOT $3 OR article.recorded > s.viewed)
+	ORDER BY article.published DESC, article.pk DESC LIMIT ` + strconv.Itoa(limit) + ` OFFSET ` + strconv.Itoa(max(offset, 0)) + `;`
+
+	rows, err := r.db.Query(ctx, sql, personPk, pk, unread)
+	if err != nil {
+		return nil, err
+	}
+	entities, err := scanArticles(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(entities) == 0 {
+		// пустая выдача или чужой поиск
+		var exists bool
+		err := r.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM saved_search WHERE person_pk = $1 AND pk = $2);`,
+			personPk, pk).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrSavedSearchNotFound
+		}
+		return []entity.Article{}, nil
+	}
+	return entities, nil
+}
+
+// ViewedSavedSearch отмечает статьи сохраненного поиска прочитанными.
+func (r *Repo) ViewedSavedSearch(ctx context.Context, personPk string, pk int) error {
+	tag, err := r.db.Exec(ctx, `UPDATE saved_search SET viewed = now() WHERE person_pk = $1 AND pk = $2;`, personPk, pk)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSavedSearchNotFound
+	}
+	return nil
+}
+
+// SearchAlerts возвращает сохраненные поиски с оповещениями, под которые попали статьи pks.
+func (r *Repo) SearchAlerts(ctx context.Context, pks []int) ([]entity.SearchAlert, error) {
+	const sql = `SELECT ` + savedSearchColumns + `, 0,
+	json_agg(json_build_object('pk', article.pk, 'title', article.title, 'source_url', article.source_url,
+		'feed_pk', article.feed_pk, 'published', article.published) ORDER BY article.pk)
+	FROM saved_search AS s JOIN article ON article.pk = ANY($1) AND ` + savedSearchMatch + `
+	WHERE s.alert_url <> '' OR (s.alert_email <> '' AND s.alert_email_confirmed)
+	GROUP BY s.pk ORDER BY s.pk;`
+
+	rows, err := r.db.Query(ctx, sql, pks)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []entity.SearchAlert
+	for rows.Next() {
+		var a entity.SearchAlert
+		s := &a.Search
+		err := rows.Scan(&s.Pk, &s.Title, &s.Query, &s.Feeds, &s.Categories, &s.WindowDays, &s.AlertUrl, &s.AlertEmail,
+			&s.AlertEmailConfirmed, &s.Viewed, &s.Created, &s.Unread, &a.Articles)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// PendingAlertEmails возвращает поиски, которым еще не отправлен код подтверждения alert_email.
+func (r *Repo) PendingAlertEmails(ctx context.Context, limit int) ([]entity.SavedSearch, error) {
+	const sql = `SELECT ` + savedSearchColumns + `, 0 FROM saved_search AS s
+	WHERE s.alert_email <> '' AND NOT s.alert_email_confirmed AND s.alert_email_code = '' ORDER BY s.pk LIMIT $1;`
+
+	rows, err := r.db.Query(ctx, sql, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanSavedSearch)
+}
+
+// ClaimAlertEmail запоминает хэш кода подтверждения, false если адрес уже сменили или код отправлен.
+func (r *Repo) ClaimAlertEmail(ctx context.Context, pk int, email string, codeHash string) (bool, error) {
+	const sql = `UPDATE saved_search SET alert_email_code = $3
+	WHERE pk = $1 AND alert_email = $2 AND NOT alert_email_confirmed AND alert_email_code = '';`
+
+	tag, err := r.db.Exec(ctx, sql, pk, email, codeHash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ConfirmAlertEmail подтверждает alert_email поиска пользователя по хэшу кода из письма.
+func (r *Repo) ConfirmAlertEmail(ctx context.Context, personPk string, pk int, codeHash string) error {
+	const sql = `UPDATE saved_search SET alert_email_confirmed = true
+	WHERE person_pk = $1 AND pk = $2 AND alert_email <> '' AND alert_email_code = $3;`
+
+	tag, err := r.db.Exec(ctx, sql, personPk, pk, codeHash)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 1 {
+		return nil
+	}
+	var exists bool
+	err = r.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM saved_search WHERE person_pk = $1 AND pk = $2);`,
+		personPk, pk).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrSavedSearchNotFound
+	}
+	return ErrAlertCode
+}
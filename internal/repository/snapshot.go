@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+
+	"rss/internal/entity"
+)
+
+// SaveSnapshot сохраняет сырой ответ канала со сжатым телом
+// и оставляет только keep последних ответов канала.
+func (r *Repo) SaveSnapshot(ctx context.Context, s entity.Snapshot, keep int) error {
+	const sqlInsert = `INSERT INTO feed_snapshot (feed_pk, url, status, headers, body) VALUES ($1, $2, $3, $4, $5);`
+	const sqlTrim = `DELETE FROM feed_snapshot WHERE feed_pk = $1 AND pk NOT IN (
+		SELECT pk FROM feed_snapshot WHERE feed_pk = $1 ORDER BY pk DESC LIMIT $2
+	);`
+
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	if _, err := zw.Write(s.Body); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	headers := s.Headers
+	if headers == nil {
+		headers = map[string][]string{}
+	}
+	if _, err := r.db.Exec(ctx, sqlInsert, s.FeedPk, s.Url, s.Status, headers, body.Bytes()); err != nil {
+		return err
+	}
+	_, err := r.db.Exec(ctx, sqlTrim, s.FeedPk, keep)
+	return err
+}
+
+// Snapshots возвращает последние сохраненные ответы канала, с feedPk 0 всех каналов.
+func (r *Repo) Snapshots(ctx context.Context, feedPk int, limit int) ([]entity.Snapshot, error) {
+	const sql = `SELECT s.pk, s.feed_pk, f.feed_url, f.kind, f.source_config, f.processors, s.url, s.status, s.headers, s.body, s.created 
+	FROM feed_snapshot AS s JOIN feed AS f ON f.pk = s.feed_pk
+	WHERE $1 = 0 OR s.feed_pk = $1 ORDER BY s.pk DESC LIMIT $2;`
+
+	rows, err := r.db.Query(ctx, sql, feedPk, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []entity.Snapshot
+	for rows.Next() {
+		var s entity.Snapshot
+		var body []byte
+		if err := rows.Scan(&s.Pk, &s.FeedPk, &s.Feed.FeedUrl, &s.Feed.Kind, &s.Feed.Source, &s.Feed.Processors, &s.Url, &s.Status, &s.Headers, &body, &s.Created); err != nil {
+			return nil, err
+		}
+		s.Feed.Pk = s.FeedPk
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		s.Body, err = io.ReadAll(zr)
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, s)
+	}
+	return entities, rows.Err()
+}
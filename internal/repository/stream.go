@@ -0,0 +1,280 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"rss/internal/entity"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// лимит статей одного запроса потока
+	StreamLimit = 1000
+	// лимит pk статей, клиенты синхронизируют ими прочитанное целиком
+	StreamIdsLimit = 50000
+)
+
+// streamFrom статьи подписок пользователя $1 с их состоянием.
+const streamFrom = ` FROM article
+	JOIN subscribe AS sub ON sub.feed_pk = article.feed_pk AND sub.person_pk = $1
+	LEFT JOIN article_state AS st ON st.article_pk = article.pk AND st.person_pk = $1`
+
+// streamRead прочитана ли статья: явное состояние или до последнего просмотра канала.
+const streamRead = `coalesce(st.read, article.recorded <= sub.viewed)`
+
+// streamAwake подписка sub не отложена.
+const streamAwake = `(sub.muted_until IS NULL OR sub.muted_until <= now())`
+
+// streamVisible статья не скрыта правилом.
+const streamVisible = `NOT coalesce(st.hidden, false)`
+
+// streamWhere условия фильтра, каждое начинается с AND.
+// Отложенные подписки видны только в выборке своего канала или с Muted,
+// скрытые правилами статьи только с Hidden или по pk.
+func streamWhere(f entity.StreamFilter, args *queryArgs) string {
+	var b strings.Builder
+	if f.FeedPk != 0 {
+		b.WriteString(` AND article.feed_pk = ` + args.add(f.FeedPk))
+	} else if f.Pks == nil && !f.Muted {
+		b.WriteString(` AND ` + streamAwake)
+	}
+	if !f.Hidden && f.Pks == nil {
+		b.WriteString(` AND ` + streamVisible)
+	}
+	if f.Tag != "" {
+		b.WriteString(` AND ` + args.add(f.Tag) + ` = ANY(st.tags)`)
+	}
+	if f.FolderPk != 0 {
+		b.WriteString(` AND ` + folderFeeds(args.add(f.FolderPk)))
+	}
+	if f.Starred {
+		b.WriteString(` AND coalesce(st.starred, false)`)
+	}
+	if f.Unread {
+		b.WriteString(` AND NOT ` + streamRead)
+	}
+	if f.Read {
+		b.WriteString(` AND ` + streamRead)
+	}
+	if !f.Since.IsZero() {
+		b.WriteString(` AND article.published >= ` + args.add(f.Since))
+	}
+	if !f.Until.IsZero() {
+		b.WriteString(` AND article.published <= ` + args.add(f.Until))
+	}
+	if !f.RecordedSince.IsZero() {
+		b.WriteString(` AND article.recorded >= ` + args.add(f.RecordedSince))
+	}
+	if f.AfterPk != 0 {
+		b.WriteString(` AND article.pk > ` + args.add(f.AfterPk))
+	}
+	if f.BeforePk != 0 {
+		b.WriteString(` AND article.pk < ` + args.add(f.BeforePk))
+	}
+	if f.Pks != nil {
+		b.WriteString(` AND article.pk = ANY(` + args.add(f.Pks) + `)`)
+	}
+	return b.String()
+}
+
+// streamOrder сортировка и страница не больше maxLimit.
+func streamOrder(f entity.StreamFilter, maxLimit int) string {
+	dir := "DESC"
+	if f.Oldest {
+		dir = "ASC"
+	}
+	limit := f.Limit
+	if limit <= 0 || limit > maxLimit {
+		limit = maxLimit
+	}
+	order := ` ORDER BY article.published ` + dir + `, article.pk ` + dir
+	if f.ByPk {
+		order = ` ORDER BY article.pk ` + dir
+	}
+	return order +
+		` LIMIT ` + strconv.Itoa(limit) + ` OFFSET ` + strconv.Itoa(max(f.Offset, 0))
+}
+
+// StreamIds возвращает pk статей потока.
+func (r *Repo) StreamIds(ctx context.Context, personPk string, f entity.StreamFilter) ([]int, error) {
+	args := queryArgs{personPk}
+	sql := `SELECT article.pk` + streamFrom + ` WHERE true` + streamWhere(f, &args) + streamOrder(f, StreamIdsLimit) + `;`
+
+	rows, err := r.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int])
+}
+
+// Stream возвращает статьи потока с состоянием.
+func (r *Repo) Stream(ctx context.Context, personPk string, f entity.StreamFilter) ([]entity.StreamItem, error) {
+	args := queryArgs{personPk}
+	sql := `SELECT ` + articleColumns + `, ` + streamRead + `, coalesce(st.starred, false), coalesce(st.hidden, false),
+	coalesce(st.tags, '{}')` + streamFrom +
+		` WHERE true` + streamWhere(f, &args) + streamOrder(f, StreamLimit) + `;`
+
+	rows, err := r.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []entity.StreamItem{}
+	for rows.Next() {
+		var it entity.StreamItem
+		a := &it.Article
+		err := rows.Scan(&a.Pk, &a.Title, &a.Content, &a.FullContent, &a.SourceUrl, &a.Published, &a.FeedPk,
+			&a.Enclosures, &a.Authors, &a.Categories, &a.ClusterPk, &a.Sources, &it.Read, &it.Starred, &it.Hidden, &it.Tags)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+// StreamCount возвращает количество статей потока без учета страницы.
+func (r *Repo) StreamCount(ctx context.Context, personPk string, f entity.StreamFilter) (int, error) {
+	args := queryArgs{personPk}
+	sql := `SELECT count(*)` + streamFrom + ` WHERE true` + streamWhere(f, &args) + `;`
+
+	var n int
+	err := r.db.QueryRow(ctx, sql, args...).Scan(&n)
+	return n, err
+}
+
+// UnreadCounts возвращает количество непрочитанных нескрытых статей по неотложенным каналам подписок.
+func (r *Repo) UnreadCounts(ctx context.Context, personPk string) ([]entity.UnreadCount, error) {
+	const sql = `SELECT article.feed_pk, count(*), max(article.published)` + streamFrom +
+		` WHERE NOT ` + streamRead + ` AND ` + streamAwake + ` AND ` + streamVisible + ` GROUP BY article.feed_pk ORDER BY article.feed_pk;`
+
+	rows, err := r.db.Query(ctx, sql, personPk)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []entity.UnreadCount{}
+	for rows.Next() {
+		var c entity.UnreadCount
+		if err := rows.Scan(&c.FeedPk, &c.Count, &c.Newest); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// SetState отмечает статьи из подписок прочитанными и избранными, nil оставляет как есть.
+func (r *Repo) SetState(ctx context.Context, personPk string, pks []int, read *bool, starred *bool) error {
+	const sql = `INSERT INTO article_state (person_pk, article_pk, read, starred) 
+	SELECT $1, article.pk, $3::boolean, coalesce($4::boolean, false) FROM article 
+	JOIN subscribe AS sub ON sub.feed_pk = article.feed_pk AND sub.person_pk = $1
+	WHERE article.pk = ANY($2)
+	ON CONFLICT (person_pk, article_pk) DO UPDATE SET 
+	read = coalesce($3::boolean, article_state.read), 
+	starred = coalesce($4::boolean, article_state.starred), 
+	updated = now();`
+
+	_, err := r.db.Exec(ctx, sql, personPk, pks, read, starred)
+	return err
+}
+
+// MarkAllRead отмечает прочитанными статьи канала или папки, с нулевыми всех подписок,
+// записанные не позже before. Чужая или удаленная папка ErrFolderNotFound.
+func (r *Repo) MarkAllRead(ctx context.Context, personPk string, feedPk int, folderPk int, before time.Time) error {
+	sqlViewed := `UPDATE subscribe AS sub SET viewed = greatest(sub.viewed, $4) 
+	WHERE sub.person_pk = $1 AND ($2 = 0 OR sub.feed_pk = $2) AND ($3 = 0 OR ` + folderFeeds("$3") + `);`
+	// явно оставленные непрочитанными тоже становятся прочитанными
+	sqlState := `UPDATE article_state AS st SET (read, updated) = (true, now()) FROM article 
+	JOIN subscribe AS sub ON sub.feed_pk = article.feed_pk AND sub.person_pk = $1
+	WHERE article.pk = st.article_pk AND st.person_pk = $1 AND ($2 = 0 OR article.feed_pk = $2) 
+	AND ($3 = 0 OR ` + folderFeeds("$3") + `) AND article.recorded <= $4 AND st.read = false;`
+
+	if folderPk != 0 {
+		if err := r.folderExists(ctx, personPk, folderPk); err != nil {
+			return err
+		}
+	}
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, sqlViewed, personPk, feedPk, folderPk, before); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, sqlState, personPk, feedPk, folderPk, before)
+		return err
+	})
+}
+
+// Subscriptions возвращает каналы подписок пользователя с настройками,
+// сначала закрепленные и по приоритету. Без своего названия
+// у рассылок заголовок адреса, у остальных url.
+func (r *Repo) Subscriptions(ctx context.Context, personPk string) ([]entity.Subscription, error) {
+	const sql = `SELECT f.pk, f.feed_url, f.kind, coalesce(sub.title, nullif(i.title, ''), f.feed_url), coalesce(sub.folder_pk, 0),
+	sub.pinned, sub.priority, sub.muted_until, sub.notify, sub.viewed FROM subscribe AS sub
+	JOIN feed AS f ON f.pk = sub.feed_pk
+	LEFT JOIN inbound_address AS i ON i.feed_pk = f.pk
+	WHERE sub.person_pk = $1 ORDER BY sub.pinned DESC, sub.priority DESC, f.pk;`
+
+	rows, err := r.db.Query(ctx, sql, personPk)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []entity.Subscription{}
+	for rows.Next() {
+		var s entity.Subscription
+		if err := rows.Scan(&s.FeedPk, &s.FeedUrl, &s.Kind, &s.Title, &s.FolderPk,
+			&s.Pinned, &s.Priority, &s.MutedUntil, &s.Notify, &s.Viewed); err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
+
+// UpdateSubscription меняет заданные в патче настройки подписки.
+func (r *Repo) UpdateSubscription(ctx context.Context, personPk string, feedPk int, p entity.SubscriptionPatch) error {
+	args := queryArgs{personPk, feedPk}
+	var sets []string
+	if p.Title != nil {
+		sets = append(sets, `title = nullif(`+args.add(*p.Title)+`, '')`)
+	}
+	if p.Pinned != nil {
+		sets = append(sets, `pinned = `+args.add(*p.Pinned))
+	}
+	if p.Priority != nil {
+		sets = append(sets, `priority = `+args.add(*p.Priority))
+	}
+	if p.MutedUntil != nil {
+		var until any
+		if !p.MutedUntil.IsZero() {
+			until = *p.MutedUntil
+		}
+		sets = append(sets, `muted_until = `+args.add(until)+`::timestamptz`)
+	}
+	if p.Notify != nil {
+		sets = append(sets, `notify = `+args.add(*p.Notify))
+	}
+	if p.Viewed != nil {
+		sets = append(sets, `viewed = `+args.add(*p.Viewed))
+	}
+	if len(sets) == 0 {
+		return nil
+	}
+	sql := `UPDATE subscribe SET ` + strings.Join(sets, ", ") + ` WHERE person_pk = $1 AND feed_pk = $2;`
+
+	tag, err := r.db.Exec(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotSubscribed
+	}
+	return nil
+}
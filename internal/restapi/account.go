@@ -0,0 +1,31 @@
+package restapi
+
+import (
+	"errors"
+	"net/http"
+
+	"rss/internal/repository"
+	"rss/internal/usecase"
+)
+
+// setApiPassword задает логин и пароль для сторонних клиентов.
+func (e *RestApi) setApiPassword(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	login := req.PostFormValue("login")
+	password := req.PostFormValue("password")
+	ctx := req.Context()
+
+	if err := e.uc.SetApiPassword(ctx, personPk, login, password); err != nil {
+		if errors.Is(err, usecase.ErrApiPassword) {
+			e.responseJson(w, err.Error(), 400, nil)
+			return
+		}
+		if errors.Is(err, repository.ErrLoginTaken) {
+			e.responseJson(w, err.Error(), 409, nil)
+			return
+		}
+		e.responseJson(w, "internal server error", 500, nil)
+		return
+	}
+	e.responseJson(w, succes, 200, nil)
+}
@@ -0,0 +1,337 @@
+package restapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"rss/internal/anchor"
+	"rss/internal/entity"
+	"rss/internal/repository"
+	"rss/internal/usecase"
+)
+
+// highlightBody цитата выделения, start подсказка где искать ее в тексте.
+type highlightBody struct {
+	Exact  string `json:"exact"`
+	Prefix string `json:"prefix"`
+	Suffix string `json:"suffix"`
+	Start  *int   `json:"start"`
+}
+
+// noteBody тело заметки, highlight_pk только при создании.
+type noteBody struct {
+	Body        string `json:"body"`
+	HighlightPk *int   `json:"highlight_pk"`
+}
+
+// annotationError ответ на ошибки выделений и заметок.
+func (e *RestApi) annotationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrHighlight), errors.Is(err, usecase.ErrNote):
+		e.responseJson(w, err.Error(), 400, nil)
+	case errors.Is(err, repository.ErrHighlightNotFound), errors.Is(err, repository.ErrNoteNotFound),
+		errors.Is(err, repository.ErrNoArticle):
+		e.responseJson(w, err.Error(), 404, nil)
+	default:
+		e.responseJson(w, "internal server error", 500, nil)
+	}
+}
+
+// decodeHighlight читает цитату из json тела, при ошибке отвечает 400.
+func (e *RestApi) decodeHighlight(w http.ResponseWriter, req *http.Request) (anchor.Quote, int, bool) {
+	var body highlightBody
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<16)).Decode(&body); err != nil {
+		e.responseJson(w, "body must be json object", 400, nil)
+		return anchor.Quote{}, 0, false
+	}
+	start := -1
+	if body.Start != nil {
+		if *body.Start < 0 {
+			e.responseJson(w, "start must be int >= 0", 400, nil)
+			return anchor.Quote{}, 0, false
+		}
+		start = *body.Start
+	}
+	return anchor.Quote{Exact: body.Exact, Prefix: body.Prefix, Suffix: body.Suffix}, start, true
+}
+
+// createHighlight выделяет цитату в статье.
+func (e *RestApi) createHighlight(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	articlePk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	q, start, ok := e.decodeHighlight(w, req)
+	if !ok {
+		return
+	}
+	ctx := req.Context()
+
+	h, err := e.uc.CreateHighlight(ctx, personPk, articlePk, q, start)
+	if err != nil {
+		e.annotationError(w, err)
+		return
+	}
+	e.responseJson(w, "created", 201, h)
+}
+
+// articleHighlights возвращает выделения статьи по порядку текста.
+func (e *RestApi) articleHighlights(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	articlePk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	entities, err := e.uc.Highlights(ctx, personPk, entity.HighlightFilter{ArticlePk: articlePk})
+	if err != nil {
+		e.annotationError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, entities)
+}
+
+// highlights возвращает выделения пользователя по всем статьям от новых, limit, offset.
+func (e *RestApi) highlights(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	query := req.URL.Query()
+	f := entity.HighlightFilter{Limit: 100}
+	var err error
+	if v := query.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit <= 0 {
+			e.responseJson(w, "limit must be int > 0", 400, nil)
+			return
+		}
+	}
+	if v := query.Get("offset"); v != "" {
+		if f.Offset, err = strconv.Atoi(v); err != nil || f.Offset < 0 {
+			e.responseJson(w, "offset must be int >= 0", 400, nil)
+			return
+		}
+	}
+	ctx := req.Context()
+
+	entities, err := e.uc.Highlights(ctx, personPk, f)
+	if err != nil {
+		e.annotationError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, entities)
+}
+
+// highlight возвращает выделение с заметками.
+func (e *RestApi) highlight(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	pk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	h, err := e.uc.Highlight(ctx, personPk, pk)
+	if err != nil {
+		e.annotationError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, h)
+}
+
+// updateHighlight перепривязывает выделение к новой цитате.
+func (e *RestApi) updateHighlight(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	pk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	q, start, ok := e.decodeHighlight(w, req)
+	if !ok {
+		return
+	}
+	ctx := req.Context()
+
+	if err := e.uc.UpdateHighlight(ctx, personPk, pk, q, start); err != nil {
+		e.annotationError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, nil)
+}
+
+// deleteHighlight удаляет выделение вместе с его заметками.
+func (e *RestApi) deleteHighlight(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	pk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	if err := e.uc.DeleteHighlight(ctx, personPk, pk); err != nil {
+		e.annotationError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, nil)
+}
+
+// exportHighlights отдает все выделения и заметки файлом, format markdown (по умолчанию) или json.
+func (e *RestApi) exportHighlights(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = "markdown"
+	}
+	if format != "markdown" && format != "json" {
+		e.responseJson(w, "format must be markdown or json", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	entities, err := e.uc.Annotations(ctx, personPk)
+	if err != nil {
+		e.annotationError(w, err)
+		return
+	}
+	if format == "json" {
+		w.Header().Set("Content-Disposition", `attachment; filename="highlights.json"`)
+		e.plainJson(w, entities)
+		return
+	}
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="highlights.md"`)
+	w.Write([]byte(annotationsMarkdown(entities)))
+}
+
+// createNote добавляет заметку к статье или к выделению в ней.
+func (e *RestApi) createNote(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	articlePk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	var body noteBody
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<16)).Decode(&body); err != nil {
+		e.responseJson(w, "body must be json object", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	n, err := e.uc.CreateNote(ctx, personPk, entity.Note{ArticlePk: articlePk, HighlightPk: body.HighlightPk, Body: body.Body})
+	if err != nil {
+		e.annotationError(w, err)
+		return
+	}
+	e.responseJson(w, "created", 201, n)
+}
+
+// articleNotes возвращает заметки к статье и ее выделениям.
+func (e *RestApi) articleNotes(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	articlePk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	entities, err := e.uc.Notes(ctx, personPk, articlePk)
+	if err != nil {
+		e.annotationError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, entities)
+}
+
+// updateNote меняет текст заметки.
+func (e *RestApi) updateNote(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	pk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	var body noteBody
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<16)).Decode(&body); err != nil {
+		e.responseJson(w, "body must be json object", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	if err := e.uc.UpdateNote(ctx, personPk, pk, body.Body); err != nil {
+		e.annotationError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, nil)
+}
+
+// deleteNote удаляет заметку.
+func (e *RestApi) deleteNote(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	pk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	if err := e.uc.DeleteNote(ctx, personPk, pk); err != nil {
+		e.annotationError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, nil)
+}
+
+// annotationsMarkdown статья заголовком со ссылкой, выделения цитатами
+// с заметками списком под ними, заметки к статье в конце.
+func annotationsMarkdown(entities []entity.Annotations) string {
+	var b strings.Builder
+	b.WriteString("# Highlights\n")
+	for _, a := range entities {
+		title := a.Article.Title
+		if title == "" {
+			title = a.Article.SourceUrl
+		}
+		b.WriteString("\n## [" + markdownEscape(title) + "](<" + a.Article.SourceUrl + ">)\n")
+		for _, h := range a.Highlights {
+			b.WriteString("\n> " + markdownEscape(h.Exact))
+			if h.Orphaned {
+				b.WriteString(" *(not in the current version)*")
+			}
+			b.WriteString("\n")
+			if len(h.Notes) > 0 {
+				b.WriteString("\n")
+			}
+			for _, n := range h.Notes {
+				b.WriteString(markdownItem(n.Body))
+			}
+		}
+		if len(a.Notes) > 0 {
+			b.WriteString("\n### Notes\n\n")
+			for _, n := range a.Notes {
+				b.WriteString(markdownItem(n.Body))
+			}
+		}
+	}
+	return b.String()
+}
+
+// markdownItem пункт списка, строки заметки с отступом внутри пункта.
+func markdownItem(s string) string {
+	return "- " + strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\n", "\n  ") + "\n"
+}
+
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, "*", `\*`, "_", `\_`, "`", "\\`", "<", `\<`)
+
+// markdownEscape экранирует разметку в тексте из статьи.
+func markdownEscape(s string) string {
+	return markdownEscaper.Replace(s)
+}
@@ -0,0 +1,74 @@
+package restapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"rss/internal/repository"
+)
+
+// лимит выдачи очереди по умолчанию
+const deadLetterLimit = 100
+
+// deadLetters возвращает очередь статей, которые не удалось записать.
+func (e *RestApi) deadLetters(w http.ResponseWriter, req *http.Request) {
+	limit := deadLetterLimit
+	if v := req.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			e.responseJson(w, "limit must be int > 0", 400, nil)
+			return
+		}
+		limit = n
+	}
+	ctx := req.Context()
+
+	entities, err := e.uc.DeadLetters(ctx, limit)
+	if err != nil {
+		e.responseJson(w, "internal server error", 500, nil)
+		return
+	}
+	e.responseJson(w, succes, 200, entities)
+}
+
+// replayDeadLetter повторяет запись статьи из очереди.
+func (e *RestApi) replayDeadLetter(w http.ResponseWriter, req *http.Request) {
+	pk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	result, err := e.uc.ReplayDeadLetter(ctx, pk)
+	if err != nil {
+		if errors.Is(err, repository.ErrDeadLetterNotFound) {
+			e.responseJson(w, err.Error(), 404, nil)
+			return
+		}
+		e.responseJson(w, "internal server error", 500, nil)
+		return
+	}
+	e.responseJson(w, succes, 200, result)
+}
+
+// deleteDeadLetter убирает статью из очереди без повтора.
+func (e *RestApi) deleteDeadLetter(w http.ResponseWriter, req *http.Request) {
+	pk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	if err := e.uc.DeleteDeadLetter(ctx, pk); err != nil {
+		if errors.Is(err, repository.ErrDeadLetterNotFound) {
+			e.responseJson(w, err.Error(), 404, nil)
+			return
+		}
+		e.responseJson(w, "internal server error", 500, nil)
+		return
+	}
+	e.responseJson(w, "no content", 204, nil)
+}
@@ -0,0 +1,81 @@
+package restapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"rss/internal/entity"
+	"rss/internal/repository"
+	"rss/internal/usecase"
+)
+
+// digestBody тело запроса настроек рассылки.
+type digestBody struct {
+	Email     string `json:"email"`
+	Frequency string `json:"frequency"`
+	Timezone  string `json:"timezone"`
+	Hour      int    `json:"hour"`
+	Weekday   int    `json:"weekday"`
+}
+
+// digestError ответ на ошибки рассылки.
+func (e *RestApi) digestError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrDigestSettings):
+		e.responseJson(w, err.Error(), 400, nil)
+	case errors.Is(err, repository.ErrDigestNotFound):
+		e.responseJson(w, err.Error(), 404, nil)
+	default:
+		e.responseJson(w, "internal server error", 500, nil)
+	}
+}
+
+// setDigest включает или меняет рассылку непрочитанных.
+func (e *RestApi) setDigest(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	var body digestBody
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<12)).Decode(&body); err != nil {
+		e.responseJson(w, "body must be json object", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	d, err := e.uc.SetDigest(ctx, personPk, entity.Digest{
+		Email:     body.Email,
+		Frequency: body.Frequency,
+		Timezone:  body.Timezone,
+		Hour:      body.Hour,
+		Weekday:   body.Weekday,
+	})
+	if err != nil {
+		e.digestError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, d)
+}
+
+// digest возвращает настройки рассылки со временем следующего письма.
+func (e *RestApi) digest(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	ctx := req.Context()
+
+	d, err := e.uc.Digest(ctx, personPk)
+	if err != nil {
+		e.digestError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, d)
+}
+
+// deleteDigest выключает рассылку.
+func (e *RestApi) deleteDigest(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	ctx := req.Context()
+
+	if err := e.uc.DeleteDigest(ctx, personPk); err != nil {
+		e.digestError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, nil)
+}
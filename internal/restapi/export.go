@@ -0,0 +1,98 @@
+package restapi
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"rss/internal/entity"
+	"rss/internal/epub"
+	"rss/internal/usecase"
+)
+
+// exportEpub отдает книгу EPUB из статей подписок: query articles=1,2,3,
+// feed_pk, since и until (дата 2006-01-02 или RFC 3339), title, lang.
+func (e *RestApi) exportEpub(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	query := req.URL.Query()
+	f := entity.ExportFilter{Title: strings.TrimSpace(query.Get("title")), Language: strings.TrimSpace(query.Get("lang"))}
+	if v := query.Get("articles"); v != "" {
+		for _, id := range strings.Split(v, ",") {
+			pk, err := strconv.Atoi(strings.TrimSpace(id))
+			if err != nil {
+				e.responseJson(w, "articles must be comma separated ints", 400, nil)
+				return
+			}
+			f.Pks = append(f.Pks, pk)
+		}
+	}
+	if v := query.Get("feed_pk"); v != "" {
+		pk, err := strconv.Atoi(v)
+		if err != nil {
+			e.responseJson(w, "feed_pk must be int", 400, nil)
+			return
+		}
+		f.FeedPk = pk
+	}
+	var ok bool
+	if f.Since, ok = parseExportDate(query.Get("since"), false); !ok {
+		e.responseJson(w, "since must be date 2006-01-02 or RFC 3339", 400, nil)
+		return
+	}
+	if f.Until, ok = parseExportDate(query.Get("until"), true); !ok {
+		e.responseJson(w, "until must be date 2006-01-02 or RFC 3339", 400, nil)
+		return
+	}
+	// картинки качаются дольше обычного WriteTimeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(e.cfg.ExportWriteTimeout)); err != nil {
+		e.log.Err(err).Msg("export write deadline")
+	}
+	ctx := req.Context()
+
+	// книга пишется прямо в ответ, после начала ошибку можно только залогировать
+	started := false
+	err := e.uc.ExportEpub(ctx, personPk, f, func(book epub.Book) error {
+		name := strings.NewReplacer("/", "-", `\`, "-", "\"", "'").Replace(book.Title) + ".epub"
+		w.Header().Set("Content-Type", "application/epub+zip")
+		disposition := mime.FormatMediaType("attachment", map[string]string{"filename": name})
+		if disposition == "" {
+			disposition = `attachment; filename="articles.epub"`
+		}
+		w.Header().Set("Content-Disposition", disposition)
+		started = true
+		return epub.Write(w, book)
+	})
+	switch {
+	case err == nil:
+	case started:
+		e.log.Err(err).Msg("write epub")
+	case errors.Is(err, usecase.ErrExport):
+		e.responseJson(w, err.Error(), 400, nil)
+	case errors.Is(err, usecase.ErrExportBusy):
+		w.Header().Set("Retry-After", "30")
+		e.responseJson(w, err.Error(), 503, nil)
+	default:
+		e.responseJson(w, "internal server error", 500, nil)
+	}
+}
+
+// parseExportDate дата без времени у until включает весь день.
+func parseExportDate(v string, end bool) (time.Time, bool) {
+	if v == "" {
+		return time.Time{}, true
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, true
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if end {
+		t = t.AddDate(0, 0, 1).Add(-time.Microsecond)
+	}
+	return t, true
+}
@@ -0,0 +1,311 @@
+package restapi
+
+/*
+	Совместимость с Fever API для клиентов без Google Reader API (Unread, ReadKit).
+	Клиент шлет api_key = md5(login:password) с логином и паролем из PUT /account/api_password,
+	запросы задаются параметрами ?api&items&since_id=... и т.д.
+	Группы это папки, подпапка с названием <папка>/<подпапка>, группа 0 это все подписки.
+*/
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"rss/internal/entity"
+	"rss/internal/repository"
+	"rss/internal/usecase"
+)
+
+const (
+	feverVersion = 3
+	// статей на запрос items по протоколу
+	feverPage = 50
+	// прозрачный gif 1x1, своих иконок у каналов нет
+	feverFavicon = "image/gif;base64,R0lGODlhAQABAIAAAAAAAP///yH5BAEAAAAALAAAAAABAAEAAAIBRAA7"
+)
+
+type feverFeed struct {
+	Id                int    `json:"id"`
+	FaviconId         int    `json:"favicon_id"`
+	Title             string `json:"title"`
+	Url               string `json:"url"`
+	SiteUrl           string `json:"site_url"`
+	IsSpark           int    `json:"is_spark"`
+	LastUpdatedOnTime int64  `json:"last_updated_on_time"`
+}
+
+type feverItem struct {
+	Id            int    `json:"id"`
+	FeedId        int    `json:"feed_id"`
+	Title         string `json:"title"`
+	Author        string `json:"author"`
+	Html          string `json:"html"`
+	Url           string `json:"url"`
+	IsSaved       int    `json:"is_saved"`
+	IsRead        int    `json:"is_read"`
+	CreatedOnTime int64  `json:"created_on_time"`
+}
+
+// fever единственная ручка Fever API, ответ собирается из запрошенных частей.
+func (e *RestApi) fever(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	body := map[string]any{"api_version": feverVersion, "auth": 0}
+
+	account, err := e.uc.FeverAuthenticate(ctx, req.FormValue("api_key"))
+	if err != nil {
+		if !errors.Is(err, usecase.ErrBadCredentials) {
+			e.log.Err(err).Msg("fever authenticate")
+		}
+		e.plainJson(w, body)
+		return
+	}
+	personPk := account.PersonPk
+	body["auth"] = 1
+	body["last_refreshed_on_time"] = time.Now().Unix()
+
+	if req.Form.Has("mark") {
+		if err := e.feverMark(req, personPk); err != nil {
+			if errors.Is(err, errFeverParam) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			e.plainError(w, err)
+			return
+		}
+	}
+	if req.Form.Has("groups") || req.Form.Has("feeds") {
+		groups, feedsGroups, err := e.feverGroups(req, personPk)
+		if err != nil {
+			e.plainError(w, err)
+			return
+		}
+		if req.Form.Has("groups") {
+			body["groups"] = groups
+		}
+		body["feeds_groups"] = feedsGroups
+	}
+	if req.Form.Has("feeds") {
+		subs, err := e.uc.Subscriptions(ctx, personPk)
+		if err != nil {
+			e.plainError(w, err)
+			return
+		}
+		feeds := make([]feverFeed, 0, len(subs))
+		for _, s := range subs {
+			url := s.FeedUrl
+			if s.Kind == entity.FeedKindNewsletter {
+				url = ""
+			}
+			feeds = append(feeds, feverFeed{Id: s.FeedPk, FaviconId: 1, Title: s.Title, Url: url, SiteUrl: url})
+		}
+		body["feeds"] = feeds
+	}
+	if req.Form.Has("favicons") {
+		body["favicons"] = []map[string]any{{"id": 1, "data": feverFavicon}}
+	}
+	if req.Form.Has("items") {
+		items, total, err := e.feverItems(req, personPk)
+		if err != nil {
+			if errors.Is(err, errFeverParam) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			e.plainError(w, err)
+			return
+		}
+		body["items"] = items
+		body["total_items"] = total
+	}
+	if req.Form.Has("links") {
+		body["links"] = []any{}
+	}
+	if req.Form.Has("unread_item_ids") {
+		ids, err := e.feverIds(req, personPk, entity.StreamFilter{Unread: true})
+		if err != nil {
+			e.plainError(w, err)
+			return
+		}
+		body["unread_item_ids"] = ids
+	}
+	if req.Form.Has("saved_item_ids") {
+		ids, err := e.feverIds(req, personPk, entity.StreamFilter{Starred: true})
+		if err != nil {
+			e.plainError(w, err)
+			return
+		}
+		body["saved_item_ids"] = ids
+	}
+	e.plainJson(w, body)
+}
+
+var errFeverParam = errors.New("bad fever parameter")
+
+type feverGroup struct {
+	Id    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+type feverFeedsGroup struct {
+	GroupId int    `json:"group_id"`
+	FeedIds string `json:"feed_ids"`
+}
+
+// feverGroups папки и каналы в них, у каждой папки только ее собственные каналы.
+func (e *RestApi) feverGroups(req *http.Request, personPk string) ([]feverGroup, []feverFeedsGroup, error) {
+	l, folders, err := e.greaderLabels(req.Context(), personPk)
+	if err != nil {
+		return nil, nil, err
+	}
+	groups := make([]feverGroup, 0, len(folders))
+	feedsGroups := make([]feverFeedsGroup, 0, len(folders))
+	for _, f := range folders {
+		groups = append(groups, feverGroup{Id: f.Pk, Title: l.names[f.Pk]})
+		ids := make([]string, len(f.Feeds))
+		for i, pk := range f.Feeds {
+			ids[i] = strconv.Itoa(pk)
+		}
+		feedsGroups = append(feedsGroups, feverFeedsGroup{GroupId: f.Pk, FeedIds: strings.Join(ids, ",")})
+	}
+	return groups, feedsGroups, nil
+}
+
+// feverItems статьи по since_id, max_id или with_ids, по умолчанию с начала.
+func (e *RestApi) feverItems(req *http.Request, personPk string) ([]feverItem, int, error) {
+	ctx := req.Context()
+	f := entity.StreamFilter{Limit: feverPage, ByPk: true, Oldest: true}
+	switch {
+	case req.FormValue("with_ids") != "":
+		for _, id := range strings.Split(req.FormValue("with_ids"), ",") {
+			pk, err := strconv.Atoi(strings.TrimSpace(id))
+			if err != nil {
+				return nil, 0, errFeverParam
+			}
+			f.Pks = append(f.Pks, pk)
+		}
+		if len(f.Pks) > feverPage {
+			f.Pks = f.Pks[:feverPage]
+		}
+	case req.FormValue("max_id") != "":
+		pk, err := strconv.Atoi(req.FormValue("max_id"))
+		if err != nil {
+			return nil, 0, errFeverParam
+		}
+		f.BeforePk = pk
+		f.Oldest = false
+	case req.FormValue("since_id") != "":
+		pk, err := strconv.Atoi(req.FormValue("since_id"))
+		if err != nil {
+			return nil, 0, errFeverParam
+		}
+		f.AfterPk = pk
+	}
+
+	total, err := e.uc.StreamCount(ctx, personPk, entity.StreamFilter{})
+	if err != nil {
+		return nil, 0, err
+	}
+	stream, err := e.uc.Stream(ctx, personPk, f)
+	if err != nil {
+		return nil, 0, err
+	}
+	items := make([]feverItem, 0, len(stream))
+	for _, it := range stream {
+		content := it.FullContent
+		if content == "" {
+			content = it.Content
+		}
+		var author string
+		if len(it.Authors) > 0 {
+			author = it.Authors[0].Name
+		}
+		items = append(items, feverItem{
+			Id:            it.Pk,
+			FeedId:        it.FeedPk,
+			Title:         it.Title,
+			Author:        author,
+			Html:          content,
+			Url:           it.SourceUrl,
+			IsSaved:       feverBool(it.Starred),
+			IsRead:        feverBool(it.Read),
+			CreatedOnTime: it.Published.Unix(),
+		})
+	}
+	return items, total, nil
+}
+
+// feverIds pk статей через запятую, как того требует протокол.
+func (e *RestApi) feverIds(req *http.Request, personPk string, f entity.StreamFilter) (string, error) {
+	f.ByPk = true
+	pks, err := e.uc.StreamIds(req.Context(), personPk, f)
+	if err != nil {
+		return "", err
+	}
+	ids := make([]string, len(pks))
+	for i, pk := range pks {
+		ids[i] = strconv.Itoa(pk)
+	}
+	return strings.Join(ids, ","), nil
+}
+
+// feverMark mark=item as=read|unread|saved|unsaved,
+// mark=feed|group as=read до before, группа 0 это все подписки, -1 (Sparks) не поддерживается.
+func (e *RestApi) feverMark(req *http.Request, personPk string) error {
+	ctx := req.Context()
+	id, err := strconv.Atoi(req.FormValue("id"))
+	if err != nil {
+		return errFeverParam
+	}
+	as := req.FormValue("as")
+
+	switch req.FormValue("mark") {
+	case "item":
+		var read, starred *bool
+		yes, no := true, false
+		switch as {
+		case "read":
+			read = &yes
+		case "unread":
+			read = &no
+		case "saved":
+			starred = &yes
+		case "unsaved":
+			starred = &no
+		default:
+			return errFeverParam
+		}
+		return e.uc.SetState(ctx, personPk, []int{id}, read, starred)
+	case "feed", "group":
+		if as != "read" {
+			return errFeverParam
+		}
+		var before time.Time
+		if v := req.FormValue("before"); v != "" {
+			sec, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return errFeverParam
+			}
+			before = time.Unix(sec, 0)
+		}
+		if req.FormValue("mark") == "group" {
+			if id < 0 {
+				return nil
+			}
+			err := e.uc.MarkAllRead(ctx, personPk, 0, id, before)
+			if errors.Is(err, repository.ErrFolderNotFound) {
+				return errFeverParam
+			}
+			return err
+		}
+		return e.uc.MarkAllRead(ctx, personPk, id, 0, before)
+	}
+	return errFeverParam
+}
+
+func feverBool(v bool) int {
+	if v {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,146 @@
+package restapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"rss/internal/repository"
+	"rss/internal/usecase"
+)
+
+// folderError ответ на ошибки папок.
+func (e *RestApi) folderError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrFolderTitle), errors.Is(err, repository.ErrFolderParent):
+		e.responseJson(w, err.Error(), 400, nil)
+	case errors.Is(err, repository.ErrFolderNotFound), errors.Is(err, repository.ErrNotSubscribed):
+		e.responseJson(w, err.Error(), 404, nil)
+	case errors.Is(err, repository.ErrFolderExists):
+		e.responseJson(w, err.Error(), 409, nil)
+	default:
+		e.responseJson(w, "internal server error", 500, nil)
+	}
+}
+
+// parentPk необязательный parent_pk формы, 0 верхний уровень.
+func parentPk(req *http.Request) (int, bool) {
+	v := req.PostFormValue("parent_pk")
+	if v == "" {
+		return 0, true
+	}
+	pk, err := strconv.Atoi(v)
+	return pk, err == nil
+}
+
+// createFolder создает папку подписок.
+func (e *RestApi) createFolder(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	parent, ok := parentPk(req)
+	if !ok {
+		e.responseJson(w, "parent_pk must be int", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	folder, err := e.uc.CreateFolder(ctx, personPk, parent, req.PostFormValue("title"))
+	if err != nil {
+		e.folderError(w, err)
+		return
+	}
+	e.responseJson(w, "created", 201, folder)
+}
+
+// folders возвращает папки с непрочитанными и каналами.
+func (e *RestApi) folders(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	ctx := req.Context()
+
+	entities, err := e.uc.Folders(ctx, personPk)
+	if err != nil {
+		e.responseJson(w, "internal server error", 500, nil)
+		return
+	}
+	e.responseJson(w, succes, 200, entities)
+}
+
+// updateFolder переименовывает и переносит папку.
+func (e *RestApi) updateFolder(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	pk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	parent, ok := parentPk(req)
+	if !ok {
+		e.responseJson(w, "parent_pk must be int", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	if err := e.uc.UpdateFolder(ctx, personPk, pk, parent, req.PostFormValue("title")); err != nil {
+		e.folderError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, nil)
+}
+
+// deleteFolder удаляет папку с подпапками.
+func (e *RestApi) deleteFolder(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	pk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	if err := e.uc.DeleteFolder(ctx, personPk, pk); err != nil {
+		e.folderError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, nil)
+}
+
+// readFolder отмечает прочитанными все статьи папки и подпапок.
+func (e *RestApi) readFolder(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	pk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	if err := e.uc.MarkAllRead(ctx, personPk, 0, pk, time.Time{}); err != nil {
+		e.folderError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, nil)
+}
+
+// setFolder кладет подписку в папку, без folder_pk убирает из папки.
+func (e *RestApi) setFolder(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	feedPk, err := strconv.Atoi(req.PathValue("feed_pk"))
+	if err != nil {
+		e.responseJson(w, "required feed_pk (int)", 400, nil)
+		return
+	}
+	var folderPk int
+	if v := req.PostFormValue("folder_pk"); v != "" {
+		if folderPk, err = strconv.Atoi(v); err != nil {
+			e.responseJson(w, "folder_pk must be int", 400, nil)
+			return
+		}
+	}
+	ctx := req.Context()
+
+	if err := e.uc.SetFolder(ctx, personPk, feedPk, folderPk); err != nil {
+		e.folderError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, nil)
+}
@@ -0,0 +1,660 @@
+package restapi
+
+/*
+	Совместимость с Google Reader API для сторонних клиентов (Reeder, NetNewsWire, FeedMe, FocusReader).
+	Клиент получает токен через ClientLogin по логину и паролю из PUT /account/api_password
+	и шлет его в заголовке Authorization: GoogleLogin auth=<токен>.
+	Потоки: reading-list, starred, read, feed/<pk> и label/<папка>, подпапка как label/<папка>/<подпапка>.
+	Ответы в формате Google Reader, без общего Response.
+*/
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"rss/internal/entity"
+	"rss/internal/repository"
+	"rss/internal/usecase"
+)
+
+const (
+	streamReadingList = "user/-/state/com.google/reading-list"
+	streamStarred     = "user/-/state/com.google/starred"
+	streamRead        = "user/-/state/com.google/read"
+	streamKeptUnread  = "user/-/state/com.google/kept-unread"
+	streamLabel       = "user/-/label/"
+	itemIdPrefix      = "tag:google.com,2005:reader/item/"
+	// статей на страницу потока по умолчанию
+	greaderPage = 20
+)
+
+// greaderSession пользователь и токен запроса Google Reader API.
+type greaderSession struct {
+	account entity.Account
+	token   string
+}
+
+type greaderSessionKey struct{}
+
+func sessionFrom(ctx context.Context) greaderSession {
+	s, _ := ctx.Value(greaderSessionKey{}).(greaderSession)
+	return s
+}
+
+// greaderAuthMiddleware допускает только клиентов с токеном ClientLogin.
+func (e *RestApi) greaderAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		_, token, _ := strings.Cut(req.Header.Get("Authorization"), "auth=")
+		account, err := e.uc.Authenticate(req.Context(), strings.TrimSpace(token))
+		if err != nil {
+			if !errors.Is(err, usecase.ErrBadCredentials) {
+				e.log.Err(err).Msg("greader authenticate")
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		ctx := context.WithValue(req.Context(), greaderSessionKey{}, greaderSession{account: account, token: token})
+		next(w, req.WithContext(ctx))
+	}
+}
+
+// greaderEditMiddleware проверяет T токен у изменяющих запросов, если клиент его прислал.
+func (e *RestApi) greaderEditMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		t := req.FormValue("T")
+		if t != "" && t != editToken(sessionFrom(req.Context()).token) {
+			w.Header().Set("X-Reader-Google-Bad-Token", "true")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, req)
+	}
+}
+
+// editToken T токен производный от токена клиента, хранить его не нужно.
+func editToken(token string) string {
+	sum := sha256.Sum256([]byte("T:" + token))
+	return hex.EncodeToString(sum[:])[:57]
+}
+
+// clientLogin выдает токен по логину и паролю, неудачные попытки ограничены как у веб входа.
+func (e *RestApi) clientLogin(w http.ResponseWriter, req *http.Request) {
+	login := req.FormValue("Email")
+	keys := loginKeys(req, login)
+	if !e.logins.allowed(keys) {
+		http.Error(w, "Error=TooManyRequests", http.StatusTooManyRequests)
+		return
+	}
+	token, err := e.uc.Login(req.Context(), login, req.FormValue("Passwd"))
+	if err != nil {
+		if !errors.Is(err, usecase.ErrBadCredentials) {
+			e.log.Err(err).Msg("greader login")
+		} else {
+			e.logins.fail(keys)
+		}
+		http.Error(w, "Error=BadAuthentication", http.StatusUnauthorized)
+		return
+	}
+	e.logins.reset(keys[1])
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "SID=%s\nLSID=%s\nAuth=%s\n", token, token, token)
+}
+
+// greaderToken выдает T токен для изменяющих запросов.
+func (e *RestApi) greaderToken(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, editToken(sessionFrom(req.Context()).token))
+}
+
+func (e *RestApi) greaderUserInfo(w http.ResponseWriter, req *http.Request) {
+	account := sessionFrom(req.Context()).account
+	e.plainJson(w, map[string]string{
+		"userId":        account.PersonPk,
+		"userProfileId": account.PersonPk,
+		"userName":      account.Login,
+		"userEmail":     account.Login,
+	})
+}
+
+type greaderCategory struct {
+	Id    string `json:"id"`
+	Label string `json:"label"`
+}
+
+type greaderSubscription struct {
+	Id         string            `json:"id"`
+	Title      string            `json:"title"`
+	Categories []greaderCategory `json:"categories"`
+	Url        string   `json:"url"`
+	HtmlUrl    string   `json:"htmlUrl"`
+	IconUrl    string   `json:"iconUrl"`
+}
+
+// labels ярлыки Google Reader из папок: pk папки по имени и имя по pk.
+type labels struct {
+	pks   map[string]int
+	names map[int]string
+}
+
+func (e *RestApi) greaderLabels(ctx context.Context, personPk string) (labels, []entity.Folder, error) {
+	folders, err := e.uc.Folders(ctx, personPk)
+	if err != nil {
+		return labels{}, nil, err
+	}
+	l := labels{pks: make(map[string]int, len(folders)), names: make(map[int]string, len(folders))}
+	// родитель всегда идет раньше подпапок
+	for _, f := range folders {
+		name := f.Title
+		if f.ParentPk != 0 {
+			name = l.names[f.ParentPk] + "/" + f.Title
+		}
+		l.pks[name] = f.Pk
+		l.names[f.Pk] = name
+	}
+	return l, folders, nil
+}
+
+// category ярлык папки, false если подписка не в папке.
+func (l labels) category(folderPk int) (greaderCategory, bool) {
+	name, ok := l.names[folderPk]
+	if !ok {
+		return greaderCategory{}, false
+	}
+	return greaderCategory{Id: streamLabel + name, Label: name}, true
+}
+
+// greaderSubscriptions список каналов подписок.
+func (e *RestApi) greaderSubscriptions(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	personPk := sessionFrom(ctx).account.PersonPk
+	subs, err := e.uc.Subscriptions(ctx, personPk)
+	if err != nil {
+		e.plainError(w, err)
+		return
+	}
+	l, _, err := e.greaderLabels(ctx, personPk)
+	if err != nil {
+		e.plainError(w, err)
+		return
+	}
+	list := make([]greaderSubscription, 0, len(subs))
+	for _, s := range subs {
+		url := s.FeedUrl
+		if s.Kind == entity.FeedKindNewsletter {
+			// адрес рассылки это токен, клиенту он не нужен
+			url = ""
+		}
+		categories := []greaderCategory{}
+		if c, ok := l.category(s.FolderPk); ok {
+			categories = append(categories, c)
+		}
+		list = append(list, greaderSubscription{
+			Id:         feedStreamId(s.FeedPk),
+			Title:      s.Title,
+			Categories: categories,
+			Url:        url,
+			HtmlUrl:    url,
+		})
+	}
+	e.plainJson(w, map[string]any{"subscriptions": list})
+}
+
+// greaderTags избранное и папки.
+func (e *RestApi) greaderTags(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	l, folders, err := e.greaderLabels(ctx, sessionFrom(ctx).account.PersonPk)
+	if err != nil {
+		e.plainError(w, err)
+		return
+	}
+	tags := []map[string]string{{"id": streamStarred}}
+	for _, f := range folders {
+		tags = append(tags, map[string]string{"id": streamLabel + l.names[f.Pk], "type": "folder"})
+	}
+	e.plainJson(w, map[string]any{"tags": tags})
+}
+
+type greaderUnread struct {
+	Id                      string `json:"id"`
+	Count                   int    `json:"count"`
+	NewestItemTimestampUsec string `json:"newestItemTimestampUsec"`
+}
+
+// greaderUnreadCount непрочитанные по каналам, папкам и всего.
+func (e *RestApi) greaderUnreadCount(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	personPk := sessionFrom(ctx).account.PersonPk
+	counts, err := e.uc.UnreadCounts(ctx, personPk)
+	if err != nil {
+		e.plainError(w, err)
+		return
+	}
+	l, folders, err := e.greaderLabels(ctx, personPk)
+	if err != nil {
+		e.plainError(w, err)
+		return
+	}
+	var total int
+	var newest time.Time
+	list := make([]greaderUnread, 0, len(counts)+1)
+	for _, c := range counts {
+		list = append(list, greaderUnread{Id: feedStreamId(c.FeedPk), Count: c.Count, NewestItemTimestampUsec: usec(c.Newest)})
+		total += c.Count
+		if c.Newest.After(newest) {
+			newest = c.Newest
+		}
+	}
+	for _, f := range folders {
+		list = append(list, greaderUnread{Id: streamLabel + l.names[f.Pk], Count: f.Unread, NewestItemTimestampUsec: usec(newest)})
+	}
+	list = append(list, greaderUnread{Id: streamReadingList, Count: total, NewestItemTimestampUsec: usec(newest)})
+	e.plainJson(w, map[string]any{"max": total, "unreadcounts": list})
+}
+
+// streamFilter собирает фильтр из параметров потока s, xt, it, ot, nt, r, n, c.
+// n не больше maxLimit, который применит репозиторий, иначе continuation потеряется.
+// false если поток не поддерживается или такой папки нет, тогда он пустой.
+func streamFilter(req *http.Request, stream string, l labels, maxLimit int) (entity.StreamFilter, bool, error) {
+	f := entity.StreamFilter{Limit: greaderPage}
+	ok := applyStream(&f, stream, false, l)
+
+	if xt := req.FormValue("xt"); xt != "" {
+		if normalizeStream(xt) == streamRead {
+			f.Unread = true
+		}
+	}
+	if it := req.FormValue("it"); it != "" {
+		ok = applyStream(&f, it, true, l) && ok
+	}
+	if f.Read && f.Unread {
+		ok = false
+	}
+	if v := req.FormValue("ot"); v != "" {
+		sec, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return f, false, errors.New("ot must be unix seconds")
+		}
+		f.Since = time.Unix(sec, 0)
+	}
+	if v := req.FormValue("nt"); v != "" {
+		sec, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return f, false, errors.New("nt must be unix seconds")
+		}
+		f.Until = time.Unix(sec, 0)
+	}
+	f.Oldest = req.FormValue("r") == "o"
+	f.Limit = maxLimit
+	if v := req.FormValue("n"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return f, false, errors.New("n must be positive int")
+		}
+		f.Limit = min(n, maxLimit)
+	}
+	if v := req.FormValue("c"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return f, false, errors.New("bad continuation")
+		}
+		f.Offset = offset
+	}
+	return f, ok, nil
+}
+
+// applyStream сужает фильтр потоком, include для параметра it.
+func applyStream(f *entity.StreamFilter, stream string, include bool, l labels) bool {
+	switch s := normalizeStream(stream); {
+	case s == "" || s == streamReadingList:
+		return true
+	case s == streamStarred:
+		f.Starred = true
+		return true
+	case s == streamRead:
+		f.Read = true
+		return true
+	case strings.HasPrefix(s, "feed/") && !include:
+		pk, err := strconv.Atoi(strings.TrimPrefix(s, "feed/"))
+		if err != nil {
+			return false
+		}
+		f.FeedPk = pk
+		return true
+	case strings.HasPrefix(s, streamLabel):
+		pk, ok := l.pks[strings.TrimPrefix(s, streamLabel)]
+		f.FolderPk = pk
+		return ok
+	}
+	return false
+}
+
+// normalizeStream приводит user/<id>/ к user/-/.
+func normalizeStream(stream string) string {
+	if rest, ok := strings.CutPrefix(stream, "user/"); ok {
+		if _, tail, ok := strings.Cut(rest, "/"); ok {
+			return "user/-/" + tail
+		}
+	}
+	return stream
+}
+
+// continuation смещение следующей страницы, пусто если страница последняя.
+func continuation(f entity.StreamFilter, n int) string {
+	if n < f.Limit {
+		return ""
+	}
+	return strconv.Itoa(f.Offset + n)
+}
+
+type greaderItemRef struct {
+	Id              string   `json:"id"`
+	DirectStreamIds []string `json:"directStreamIds"`
+}
+
+// greaderStreamIds pk статей потока.
+func (e *RestApi) greaderStreamIds(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	personPk := sessionFrom(ctx).account.PersonPk
+	l, _, err := e.greaderLabels(ctx, personPk)
+	if err != nil {
+		e.plainError(w, err)
+		return
+	}
+	f, ok, err := streamFilter(req, req.FormValue("s"), l, repository.StreamIdsLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	refs := []greaderItemRef{}
+	if ok {
+		pks, err := e.uc.StreamIds(ctx, personPk, f)
+		if err != nil {
+			e.plainError(w, err)
+			return
+		}
+		for _, pk := range pks {
+			refs = append(refs, greaderItemRef{Id: strconv.Itoa(pk), DirectStreamIds: []string{}})
+		}
+	}
+	body := map[string]any{"itemRefs": refs}
+	if c := continuation(f, len(refs)); c != "" {
+		body["continuation"] = c
+	}
+	e.plainJson(w, body)
+}
+
+// greaderStreamContents статьи потока из пути или параметра s.
+func (e *RestApi) greaderStreamContents(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	stream := req.PathValue("stream")
+	if stream == "" {
+		stream = req.FormValue("s")
+	}
+	if stream == "" {
+		stream = streamReadingList
+	}
+	personPk := sessionFrom(ctx).account.PersonPk
+	l, _, err := e.greaderLabels(ctx, personPk)
+	if err != nil {
+		e.plainError(w, err)
+		return
+	}
+	f, ok, err := streamFilter(req, stream, l, repository.StreamLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	items := []entity.StreamItem{}
+	if ok {
+		items, err = e.uc.Stream(ctx, personPk, f)
+		if err != nil {
+			e.plainError(w, err)
+			return
+		}
+	}
+	e.writeItems(w, req, stream, items, continuation(f, len(items)))
+}
+
+// greaderItemsContents статьи по списку id из параметров i.
+func (e *RestApi) greaderItemsContents(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	pks, err := itemPks(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	items := []entity.StreamItem{}
+	if len(pks) > 0 {
+		f := entity.StreamFilter{Pks: pks, Limit: len(pks)}
+		items, err = e.uc.Stream(ctx, sessionFrom(ctx).account.PersonPk, f)
+		if err != nil {
+			e.plainError(w, err)
+			return
+		}
+	}
+	e.writeItems(w, req, streamReadingList, items, "")
+}
+
+// itemPks разбирает id статей: длинная форма с hex или десятичное число.
+func itemPks(req *http.Request) ([]int, error) {
+	if err := req.ParseForm(); err != nil {
+		return nil, err
+	}
+	pks := make([]int, 0, len(req.Form["i"]))
+	for _, id := range req.Form["i"] {
+		var pk int64
+		var err error
+		if hex, ok := strings.CutPrefix(id, itemIdPrefix); ok {
+			var u uint64
+			u, err = strconv.ParseUint(hex, 16, 64)
+			pk = int64(u)
+		} else {
+			pk, err = strconv.ParseInt(id, 10, 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad item id %q", id)
+		}
+		pks = append(pks, int(pk))
+	}
+	return pks, nil
+}
+
+type greaderLink struct {
+	Href string `json:"href"`
+	Type string `json:"type,omitempty"`
+}
+
+type greaderContent struct {
+	Direction string `json:"direction"`
+	Content   string `json:"content"`
+}
+
+type greaderOrigin struct {
+	StreamId string `json:"streamId"`
+	Title    string `json:"title"`
+	HtmlUrl  string `json:"htmlUrl"`
+}
+
+type greaderItem struct {
+	Id            string         `json:"id"`
+	CrawlTimeMsec string         `json:"crawlTimeMsec"`
+	TimestampUsec string         `json:"timestampUsec"`
+	Published     int64          `json:"published"`
+	Updated       int64          `json:"updated"`
+	Title         string         `json:"title"`
+	Author        string         `json:"author,omitempty"`
+	Canonical     []greaderLink  `json:"canonical"`
+	Alternate     []greaderLink  `json:"alternate"`
+	Categories    []string       `json:"categories"`
+	Summary       greaderContent `json:"summary"`
+	Origin        greaderOrigin  `json:"origin"`
+}
+
+// writeItems отдает статьи, заголовки каналов и папки берутся из подписок.
+func (e *RestApi) writeItems(w http.ResponseWriter, req *http.Request, stream string, items []entity.StreamItem, cont string) {
+	ctx := req.Context()
+	personPk := sessionFrom(ctx).account.PersonPk
+	subs, err := e.uc.Subscriptions(ctx, personPk)
+	if err != nil {
+		e.plainError(w, err)
+		return
+	}
+	l, _, err := e.greaderLabels(ctx, personPk)
+	if err != nil {
+		e.plainError(w, err)
+		return
+	}
+	titles := make(map[int]string, len(subs))
+	folders := make(map[int]int, len(subs))
+	for _, s := range subs {
+		titles[s.FeedPk] = s.Title
+		folders[s.FeedPk] = s.FolderPk
+	}
+
+	list := make([]greaderItem, 0, len(items))
+	for _, it := range items {
+		content := it.FullContent
+		if content == "" {
+			content = it.Content
+		}
+		categories := []string{streamReadingList}
+		if it.Read {
+			categories = append(categories, streamRead)
+		}
+		if it.Starred {
+			categories = append(categories, streamStarred)
+		}
+		if c, ok := l.category(folders[it.FeedPk]); ok {
+			categories = append(categories, c.Id)
+		}
+		var author string
+		if len(it.Authors) > 0 {
+			author = it.Authors[0].Name
+		}
+		list = append(list, greaderItem{
+			Id:            fmt.Sprintf("%s%016x", itemIdPrefix, it.Pk),
+			CrawlTimeMsec: strconv.FormatInt(it.Published.UnixMilli(), 10),
+			TimestampUsec: usec(it.Published),
+			Published:     it.Published.Unix(),
+			Updated:       it.Published.Unix(),
+			Title:         it.Title,
+			Author:        author,
+			Canonical:     []greaderLink{{Href: it.SourceUrl}},
+			Alternate:     []greaderLink{{Href: it.SourceUrl, Type: "text/html"}},
+			Categories:    categories,
+			Summary:       greaderContent{Direction: "ltr", Content: content},
+			Origin:        greaderOrigin{StreamId: feedStreamId(it.FeedPk), Title: titles[it.FeedPk]},
+		})
+	}
+	body := map[string]any{
+		"id":      stream,
+		"updated": time.Now().Unix(),
+		"items":   list,
+	}
+	if cont != "" {
+		body["continuation"] = cont
+	}
+	e.plainJson(w, body)
+}
+
+// greaderEditTag ставит и снимает прочитанное и избранное, остальные теги игнорируются.
+func (e *RestApi) greaderEditTag(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	pks, err := itemPks(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var read, starred *bool
+	set := func(tags []string, v bool) {
+		for _, tag := range tags {
+			switch normalizeStream(tag) {
+			case streamRead:
+				read = &v
+			case streamKeptUnread:
+				unread := !v
+				read = &unread
+			case streamStarred:
+				starred = &v
+			}
+		}
+	}
+	set(req.Form["r"], false)
+	set(req.Form["a"], true)
+
+	if err := e.uc.SetState(ctx, sessionFrom(ctx).account.PersonPk, pks, read, starred); err != nil {
+		e.plainError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, "OK")
+}
+
+// greaderMarkAllRead отмечает прочитанным поток до ts в микросекундах.
+func (e *RestApi) greaderMarkAllRead(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	personPk := sessionFrom(ctx).account.PersonPk
+	var feedPk, folderPk int
+	switch s := normalizeStream(req.FormValue("s")); {
+	case s == "" || s == streamReadingList:
+	case strings.HasPrefix(s, "feed/"):
+		pk, err := strconv.Atoi(strings.TrimPrefix(s, "feed/"))
+		if err != nil {
+			http.Error(w, "bad stream", http.StatusBadRequest)
+			return
+		}
+		feedPk = pk
+	case strings.HasPrefix(s, streamLabel):
+		l, _, err := e.greaderLabels(ctx, personPk)
+		if err != nil {
+			e.plainError(w, err)
+			return
+		}
+		pk, ok := l.pks[strings.TrimPrefix(s, streamLabel)]
+		if !ok {
+			http.Error(w, "unknown label", http.StatusBadRequest)
+			return
+		}
+		folderPk = pk
+	default:
+		http.Error(w, "unsupported stream", http.StatusBadRequest)
+		return
+	}
+	var before time.Time
+	if v := req.FormValue("ts"); v != "" {
+		ts, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "ts must be unix microseconds", http.StatusBadRequest)
+			return
+		}
+		before = time.UnixMicro(ts)
+	}
+
+	if err := e.uc.MarkAllRead(ctx, personPk, feedPk, folderPk, before); err != nil {
+		if errors.Is(err, repository.ErrFolderNotFound) {
+			http.Error(w, "unknown label", http.StatusBadRequest)
+			return
+		}
+		e.plainError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, "OK")
+}
+
+func feedStreamId(feedPk int) string {
+	return "feed/" + strconv.Itoa(feedPk)
+}
+
+func usec(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixMicro(), 10)
+}
@@ -3,8 +3,11 @@ package restapi
 import (
 	"errors"
 	"net/http"
+	"strconv"
 
+	"rss/internal/entity"
 	"rss/internal/repository"
+	"rss/internal/usecase"
 )
 
 // available возвращает список доступных RSS каналов.
@@ -28,14 +31,19 @@ func (e *RestApi) addFeed(w http.ResponseWriter, req *http.Request) {
 		e.responseJson(w, "required feed_url (url)", 400, nil)
 		return
 	}
+	kind, src := sourceForm(req)
 	ctx := req.Context()
 
-	if err := e.uc.AddFeed(ctx, feedUrl); err != nil {
+	if err := e.uc.AddFeed(ctx, entity.Feed{FeedUrl: feedUrl, Kind: kind, Source: src}); err != nil {
 		if errors.Is(err, repository.ErrFeedExists) {
 			// такой url уже существует
 			e.responseJson(w, msgAlreadyExists, 400, nil)
 			return
 		}
+		if errors.Is(err, usecase.ErrSourceConfig) {
+			e.responseJson(w, err.Error(), 400, nil)
+			return
+		}
 		e.responseJson(w, "internal server error", 500, nil)
 		return
 	}
@@ -53,8 +61,10 @@ func (e *RestApi) subscribe(w http.ResponseWriter, req *http.Request) {
 
 	ctx := req.Context()
 
-	if err := e.uc.Subscribe(ctx, personPk, feedPk); err != nil {
+	if err := e.uc.Subscribe(ctx, personPk, feedPk, req.PostFormValue("history")); err != nil {
 		switch {
+		case errors.Is(err, usecase.ErrSubscriptionSettings):
+			e.responseJson(w, err.Error(), 400, nil)
 		case errors.Is(err, repository.ErrAlreadySubscribed):
 			// подписка на данный канал у данного юзера уже существует
 			e.responseJson(w, "no content", 204, nil)
@@ -90,9 +100,13 @@ func (e *RestApi) unsubscribe(w http.ResponseWriter, req *http.Request) {
 // article возвращает список статей для пользователя.
 func (e *RestApi) article(w http.ResponseWriter, req *http.Request) {
 	personPk := req.Header.Get("X-Auth-ID")
+	filter, ok := e.articleFilter(w, req)
+	if !ok {
+		return
+	}
 	ctx := req.Context()
 
-	entities, err := e.uc.Article(ctx, personPk)
+	entities, err := e.uc.Article(ctx, personPk, filter)
 	if err != nil {
 		if errors.Is(err, repository.ErrArticleNotFound) {
 			// для юзера нет новых статей
@@ -104,3 +118,109 @@ func (e *RestApi) article(w http.ResponseWriter, req *http.Request) {
 	}
 	e.responseJson(w, succes, 200, entities)
 }
+
+// search ищет статьи по подписанным каналам: q, author, category, tag, feed_pk.
+func (e *RestApi) search(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	filter, ok := e.articleFilter(w, req)
+	if !ok {
+		return
+	}
+	if filter.IsZero() {
+		e.responseJson(w, "required q, author, category, tag, feed_pk or folder_pk", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	entities, err := e.uc.Search(ctx, personPk, filter)
+	if err != nil {
+		if errors.Is(err, repository.ErrArticleNotFound) {
+			e.responseJson(w, "articles not found", 404, nil)
+			return
+		}
+		e.responseJson(w, "internal server error", 500, nil)
+		return
+	}
+	e.responseJson(w, succes, 200, entities)
+}
+
+// feedCategories возвращает категории статей канала из подписок.
+func (e *RestApi) feedCategories(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	feedPk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	categories, err := e.uc.FeedCategories(ctx, personPk, feedPk)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotSubscribed) {
+			e.responseJson(w, "feed not found", 404, nil)
+			return
+		}
+		e.responseJson(w, "internal server error", 500, nil)
+		return
+	}
+	e.responseJson(w, succes, 200, categories)
+}
+
+// articleFilter читает фильтр статей из query, при ошибке отвечает 400.
+func (e *RestApi) articleFilter(w http.ResponseWriter, req *http.Request) (entity.ArticleFilter, bool) {
+	query := req.URL.Query()
+	filter := entity.ArticleFilter{
+		Author:   query.Get("author"),
+		Category: query.Get("category"),
+		Query:    query.Get("q"),
+		Tag:      query.Get("tag"),
+	}
+	switch query.Get("collapse") {
+	case "":
+	case "clusters":
+		filter.Collapse = true
+	default:
+		e.responseJson(w, "collapse must be clusters", 400, nil)
+		return filter, false
+	}
+	if feedPk := query.Get("feed_pk"); feedPk != "" {
+		if !IsInt(feedPk) {
+			e.responseJson(w, "feed_pk must be int", 400, nil)
+			return filter, false
+		}
+		filter.FeedPk, _ = strconv.Atoi(feedPk)
+	}
+	if folderPk := query.Get("folder_pk"); folderPk != "" {
+		if !IsInt(folderPk) {
+			e.responseJson(w, "folder_pk must be int", 400, nil)
+			return filter, false
+		}
+		filter.FolderPk, _ = strconv.Atoi(folderPk)
+	}
+	return filter, true
+}
+
+// setFullContent включает или выключает извлечение полного текста для канала.
+func (e *RestApi) setFullContent(w http.ResponseWriter, req *http.Request) {
+	feedPk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	enabled, err := strconv.ParseBool(req.PostFormValue("fetch_full_content"))
+	if err != nil {
+		e.responseJson(w, "required fetch_full_content (bool)", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	if err := e.uc.SetFullContent(ctx, feedPk, enabled); err != nil {
+		if errors.Is(err, repository.ErrNotFoundFeedPk) {
+			e.responseJson(w, "feed_pk not found", 404, nil)
+			return
+		}
+		e.responseJson(w, "internal server error", 500, nil)
+		return
+	}
+	e.responseJson(w, "no content", 204, nil)
+}
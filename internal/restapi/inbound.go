@@ -0,0 +1,63 @@
+package restapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"rss/internal/repository"
+)
+
+// createInbound выдает пользователю адрес для рассылок,
+// письма на него появляются статьями личного канала.
+func (e *RestApi) createInbound(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	title := req.PostFormValue("title")
+	if utf8.RuneCountInString(title) > 256 {
+		e.responseJson(w, "title longer than 256", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	in, err := e.uc.CreateInbound(ctx, personPk, title)
+	if err != nil {
+		e.responseJson(w, "internal server error", 500, nil)
+		return
+	}
+	e.responseJson(w, "created", 201, in)
+}
+
+// inbounds возвращает адреса для рассылок пользователя.
+func (e *RestApi) inbounds(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	ctx := req.Context()
+
+	entities, err := e.uc.Inbounds(ctx, personPk)
+	if err != nil {
+		e.responseJson(w, "internal server error", 500, nil)
+		return
+	}
+	e.responseJson(w, succes, 200, entities)
+}
+
+// deleteInbound удаляет адрес для рассылок, статьи канала остаются.
+func (e *RestApi) deleteInbound(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	pk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	if err := e.uc.DeleteInbound(ctx, personPk, pk); err != nil {
+		if errors.Is(err, repository.ErrInboundNotFound) {
+			e.responseJson(w, err.Error(), 404, nil)
+			return
+		}
+		e.responseJson(w, "internal server error", 500, nil)
+		return
+	}
+	e.responseJson(w, succes, 200, nil)
+}
@@ -0,0 +1,81 @@
+package restapi
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// после стольких ключей истекшие окна вычищаются
+const loginLimiterPrune = 10000
+
+// loginLimiter считает неудачные входы веб интерфейса и Google Reader по адресу клиента и по логину,
+// после attempts неудач за window вход по ключу закрыт до конца окна.
+type loginLimiter struct {
+	mu       sync.Mutex
+	attempts int
+	window   time.Duration
+	fails    map[string]loginFails
+}
+
+type loginFails struct {
+	n     int
+	since time.Time
+}
+
+func newLoginLimiter(attempts int, window time.Duration) *loginLimiter {
+	return &loginLimiter{attempts: max(attempts, 1), window: window, fails: make(map[string]loginFails)}
+}
+
+// loginKeys ключи попытки входа: адрес клиента и логин без учета регистра.
+func loginKeys(req *http.Request, login string) []string {
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		ip = req.RemoteAddr
+	}
+	return []string{"ip:" + ip, "login:" + strings.ToLower(strings.TrimSpace(login))}
+}
+
+// allowed false если по одному из ключей попытки исчерпаны.
+func (l *loginLimiter) allowed(keys []string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for _, k := range keys {
+		if f, ok := l.fails[k]; ok && now.Sub(f.since) < l.window && f.n >= l.attempts {
+			return false
+		}
+	}
+	return true
+}
+
+// fail засчитывает неудачный вход по всем ключам.
+func (l *loginLimiter) fail(keys []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if len(l.fails) > loginLimiterPrune {
+		for k, f := range l.fails {
+			if now.Sub(f.since) >= l.window {
+				delete(l.fails, k)
+			}
+		}
+	}
+	for _, k := range keys {
+		f := l.fails[k]
+		if now.Sub(f.since) >= l.window {
+			f = loginFails{since: now}
+		}
+		f.n++
+		l.fails[k] = f
+	}
+}
+
+// reset забывает неудачи по ключу после успешного входа.
+func (l *loginLimiter) reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.fails, key)
+}
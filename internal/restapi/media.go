@@ -0,0 +1,97 @@
+package restapi
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"rss/internal/blob"
+	"rss/internal/entity"
+	"rss/internal/repository"
+)
+
+// setMediaSettings обновляет настройки архивирования медиа канала.
+func (e *RestApi) setMediaSettings(w http.ResponseWriter, req *http.Request) {
+	feedPk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	archive, err := strconv.ParseBool(req.PostFormValue("archive_media"))
+	if err != nil {
+		e.responseJson(w, "required archive_media (bool)", 400, nil)
+		return
+	}
+	settings := entity.MediaSettings{FeedPk: feedPk, Archive: archive}
+
+	// лимиты не обязательны, 0 без ограничений
+	if v := req.PostFormValue("retention_days"); v != "" {
+		if settings.RetentionDays, err = strconv.Atoi(v); err != nil || settings.RetentionDays < 0 {
+			e.responseJson(w, "retention_days must be int >= 0", 400, nil)
+			return
+		}
+	}
+	if v := req.PostFormValue("max_count"); v != "" {
+		if settings.MaxCount, err = strconv.Atoi(v); err != nil || settings.MaxCount < 0 {
+			e.responseJson(w, "max_count must be int >= 0", 400, nil)
+			return
+		}
+	}
+
+	if err := e.uc.SetMediaSettings(req.Context(), settings); err != nil {
+		if errors.Is(err, repository.ErrNotFoundFeedPk) {
+			e.responseJson(w, "feed_pk not found", 404, nil)
+			return
+		}
+		e.responseJson(w, "internal server error", 500, nil)
+		return
+	}
+	e.responseJson(w, succes, 200, settings)
+}
+
+// media отдает архивное вложение из хранилища.
+func (e *RestApi) media(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	pk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+
+	r, job, err := e.uc.Media(req.Context(), personPk, pk)
+	if err != nil {
+		switch {
+		case errors.Is(err, blob.ErrDisabled):
+			e.responseJson(w, "media archive disabled", 404, nil)
+		case errors.Is(err, repository.ErrMediaNotFound), errors.Is(err, blob.ErrNotFound):
+			e.responseJson(w, "media not found", 404, nil)
+		default:
+			e.responseJson(w, "internal server error", 500, nil)
+		}
+		return
+	}
+	defer r.Close()
+
+	// тип задает чужой сервер, а отдаем с origin /ui/, поэтому html и svg только скачиваются
+	w.Header().Set("Content-Type", mediaType(job.MimeType))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", "attachment")
+	if _, err := io.Copy(w, r); err != nil {
+		e.log.Err(err).Int("pk", pk).Msg("media copy")
+	}
+}
+
+// mediaType тип вложения, если он безопасен для показа, иначе application/octet-stream.
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mt == "image/svg+xml" {
+		return "application/octet-stream"
+	}
+	if strings.HasPrefix(mt, "audio/") || strings.HasPrefix(mt, "video/") || strings.HasPrefix(mt, "image/") {
+		return mt
+	}
+	return "application/octet-stream"
+}
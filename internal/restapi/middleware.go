@@ -4,6 +4,9 @@ import (
 	"net/http"
 )
 
+// adminPk пользователь с правами администратора
+const adminPk = "35be0a7c-8570-4987-be59-efeac5906d74"
+
 // globalMiddleware ловит и логгирует панику
 func (e *RestApi) globalMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
@@ -22,7 +25,7 @@ func (e *RestApi) globalMiddleware(next http.Handler) http.Handler {
 func (e *RestApi) authAdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		token := req.Header.Get("X-Auth-ID")
-		if token != "35be0a7c-8570-4987-be59-efeac5906d74" {
+		if token != adminPk {
 			e.responseJson(w, "Forbidden", 403, nil)
 			return
 		}
@@ -0,0 +1,29 @@
+package restapi
+
+import "net/http"
+
+// notifications возвращает непрочитанные уведомления пользователя,
+// например о переезде или удалении канала из подписок.
+func (e *RestApi) notifications(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	ctx := req.Context()
+
+	entities, err := e.uc.Notifications(ctx, personPk)
+	if err != nil {
+		e.responseJson(w, "internal server error", 500, nil)
+		return
+	}
+	e.responseJson(w, succes, 200, entities)
+}
+
+// seenNotifications отмечает уведомления пользователя прочитанными.
+func (e *RestApi) seenNotifications(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	ctx := req.Context()
+
+	if err := e.uc.SeenNotifications(ctx, personPk); err != nil {
+		e.responseJson(w, "internal server error", 500, nil)
+		return
+	}
+	e.responseJson(w, succes, 200, nil)
+}
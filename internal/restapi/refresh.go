@@ -0,0 +1,93 @@
+package restapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"rss/internal/repository"
+	"rss/internal/usecase"
+)
+
+// refreshFeed ставит канал на внеочередное обновление.
+func (e *RestApi) refreshFeed(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	feedPk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	job, created, err := e.uc.Refresh(ctx, personPk, feedPk)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFoundFeedPk):
+			e.responseJson(w, "feed_pk not found", 404, nil)
+		case errors.Is(err, repository.ErrNotFoundPerson):
+			e.responseJson(w, err.Error(), 404, nil)
+		case errors.Is(err, usecase.ErrRefreshTooSoon), errors.Is(err, usecase.ErrRefreshLimit):
+			e.responseJson(w, err.Error(), 429, nil)
+		default:
+			e.responseJson(w, "internal server error", 500, nil)
+		}
+		return
+	}
+	if !created {
+		// задача на этот канал уже в очереди
+		e.responseJson(w, "accepted", 202, job)
+		return
+	}
+	e.responseJson(w, "created", 201, job)
+}
+
+// backfillFeed ставит канал на обновление вместе с историей (администратор).
+func (e *RestApi) backfillFeed(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	feedPk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	job, created, err := e.uc.Backfill(ctx, personPk, feedPk)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFoundFeedPk):
+			e.responseJson(w, "feed_pk not found", 404, nil)
+		case errors.Is(err, repository.ErrNotFoundPerson):
+			e.responseJson(w, err.Error(), 404, nil)
+		default:
+			e.responseJson(w, "internal server error", 500, nil)
+		}
+		return
+	}
+	if !created {
+		e.responseJson(w, "accepted", 202, job)
+		return
+	}
+	e.responseJson(w, "created", 201, job)
+}
+
+// refreshStatus возвращает задачу обновления канала.
+func (e *RestApi) refreshStatus(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	pk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	job, err := e.uc.RefreshStatus(ctx, personPk, pk)
+	if err != nil {
+		if errors.Is(err, repository.ErrRefreshNotFound) {
+			e.responseJson(w, err.Error(), 404, nil)
+			return
+		}
+		e.responseJson(w, "internal server error", 500, nil)
+		return
+	}
+	e.responseJson(w, succes, 200, job)
+}
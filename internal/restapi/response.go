@@ -23,7 +23,7 @@ type Response struct {
 // я тут эксперементировал с общим Response на все ручки
 func (e *RestApi) responseJson(w http.ResponseWriter, msg string, code int, body any) {
 	w.Header().Set("Content-Type", "application/json")
-	if code != 200 && code != 201 && code != 204 {
+	if code != 200 && code != 201 && code != 202 && code != 204 {
 		e.log.Error().Str("msg", msg).Msg("response json")
 	}
 	res := Response{
@@ -42,3 +42,19 @@ func (e *RestApi) responseJson(w http.ResponseWriter, msg string, code int, body
 	w.Write(b)
 }
 
+// plainJson отдает body как есть, без общего Response, для протоколов сторонних клиентов.
+func (e *RestApi) plainJson(w http.ResponseWriter, body any) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		e.log.Err(err).Msg("json marshal")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(b)
+}
+
+func (e *RestApi) plainError(w http.ResponseWriter, err error) {
+	e.log.Err(err).Msg("plain response")
+	http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+}
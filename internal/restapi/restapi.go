@@ -3,6 +3,7 @@ package restapi
 import (
 	"context"
 	"errors"
+	"html/template"
 	"net/http"
 	"time"
 
@@ -16,13 +17,21 @@ import (
 type RestApi struct {
 	uc  *usecase.UseCase
 	srv *http.Server
+	cfg config.HttpConfig
 	log zerolog.Logger
+	// шаблоны веб интерфейса
+	pages *template.Template
+	// неудачные входы веб интерфейса
+	logins *loginLimiter
 }
 
 func New(uc *usecase.UseCase, cfg config.HttpConfig, log zerolog.Logger) *RestApi {
 	e := &RestApi{
-		uc:  uc,
-		log: log,
+		uc:     uc,
+		cfg:    cfg,
+		log:    log,
+		pages:  template.Must(template.ParseFS(webFS, "web/*.html")),
+		logins: newLoginLimiter(cfg.LoginAttempts, cfg.LoginWindow),
 	}
 	e.srv = &http.Server{
 		Addr:         cfg.Port,
@@ -0,0 +1,66 @@
+package restapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"rss/internal/repository"
+	"rss/internal/usecase"
+)
+
+// revisions возвращает историю версий статьи из подписок.
+func (e *RestApi) revisions(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	articlePk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	entities, err := e.uc.Revisions(ctx, personPk, articlePk)
+	if err != nil {
+		if errors.Is(err, repository.ErrRevisionNotFound) {
+			e.responseJson(w, err.Error(), 404, nil)
+			return
+		}
+		e.responseJson(w, "internal server error", 500, nil)
+		return
+	}
+	e.responseJson(w, succes, 200, entities)
+}
+
+// revisionDiff возвращает разницу между версиями статьи, query from и to.
+func (e *RestApi) revisionDiff(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	articlePk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	query := req.URL.Query()
+	var from, to int
+	// from и to указываются вместе или не указываются вовсе
+	if query.Has("from") || query.Has("to") {
+		if !IsInt(query.Get("from")) || !IsInt(query.Get("to")) {
+			e.responseJson(w, "required from and to (int)", 400, nil)
+			return
+		}
+		from, _ = strconv.Atoi(query.Get("from"))
+		to, _ = strconv.Atoi(query.Get("to"))
+	}
+	ctx := req.Context()
+
+	d, err := e.uc.RevisionDiff(ctx, personPk, articlePk, from, to)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRevisionNotFound), errors.Is(err, usecase.ErrNothingToCompare):
+			e.responseJson(w, err.Error(), 404, nil)
+		default:
+			e.responseJson(w, "internal server error", 500, nil)
+		}
+		return
+	}
+	e.responseJson(w, succes, 200, d)
+}
@@ -10,6 +10,95 @@ func (e *RestApi) registerRoutes() http.Handler {
 	mux.HandleFunc("PUT /subscribe", e.authUserMiddleware(e.subscribe))
 	mux.HandleFunc("PUT /unsubscribe", e.authUserMiddleware(e.unsubscribe))
 	mux.HandleFunc("GET /article", e.authUserMiddleware(e.article))
+	mux.HandleFunc("GET /search", e.authUserMiddleware(e.search))
+	mux.HandleFunc("GET /article/{pk}/revisions", e.authUserMiddleware(e.revisions))
+	mux.HandleFunc("GET /article/{pk}/diff", e.authUserMiddleware(e.revisionDiff))
+	mux.HandleFunc("POST /article/{pk}/highlights", e.authUserMiddleware(e.createHighlight))
+	mux.HandleFunc("GET /article/{pk}/highlights", e.authUserMiddleware(e.articleHighlights))
+	mux.HandleFunc("POST /article/{pk}/notes", e.authUserMiddleware(e.createNote))
+	mux.HandleFunc("GET /article/{pk}/notes", e.authUserMiddleware(e.articleNotes))
+	mux.HandleFunc("GET /highlights", e.authUserMiddleware(e.highlights))
+	mux.HandleFunc("GET /highlights/export", e.authUserMiddleware(e.exportHighlights))
+	mux.HandleFunc("GET /highlights/{pk}", e.authUserMiddleware(e.highlight))
+	mux.HandleFunc("PUT /highlights/{pk}", e.authUserMiddleware(e.updateHighlight))
+	mux.HandleFunc("DELETE /highlights/{pk}", e.authUserMiddleware(e.deleteHighlight))
+	mux.HandleFunc("PUT /notes/{pk}", e.authUserMiddleware(e.updateNote))
+	mux.HandleFunc("DELETE /notes/{pk}", e.authUserMiddleware(e.deleteNote))
+	mux.HandleFunc("GET /export/epub", e.authUserMiddleware(e.exportEpub))
+	mux.HandleFunc("GET /feeds/{pk}/categories", e.authUserMiddleware(e.feedCategories))
+	mux.HandleFunc("PUT /feeds/{pk}/media", e.authUserMiddleware(e.authAdminMiddleware(e.setMediaSettings)))
+	mux.HandleFunc("GET /media/{pk}", e.authUserMiddleware(e.media))
+	mux.HandleFunc("PUT /feeds/{pk}/full_content", e.authUserMiddleware(e.authAdminMiddleware(e.setFullContent)))
+	mux.HandleFunc("PUT /feeds/{pk}/source", e.authUserMiddleware(e.authAdminMiddleware(e.setSource)))
+	mux.HandleFunc("PUT /feeds/{pk}/processors", e.authUserMiddleware(e.authAdminMiddleware(e.setProcessors)))
+	mux.HandleFunc("POST /feeds/{pk}/refresh", e.authUserMiddleware(e.refreshFeed))
+	mux.HandleFunc("POST /feeds/{pk}/backfill", e.authUserMiddleware(e.authAdminMiddleware(e.backfillFeed)))
+	mux.HandleFunc("GET /refresh/{pk}", e.authUserMiddleware(e.refreshStatus))
+	mux.HandleFunc("GET /notifications", e.authUserMiddleware(e.notifications))
+	mux.HandleFunc("PUT /notifications/seen", e.authUserMiddleware(e.seenNotifications))
+	mux.HandleFunc("POST /newsletters", e.authUserMiddleware(e.createInbound))
+	mux.HandleFunc("GET /newsletters", e.authUserMiddleware(e.inbounds))
+	mux.HandleFunc("DELETE /newsletters/{pk}", e.authUserMiddleware(e.deleteInbound))
+	mux.HandleFunc("POST /folders", e.authUserMiddleware(e.createFolder))
+	mux.HandleFunc("GET /folders", e.authUserMiddleware(e.folders))
+	mux.HandleFunc("PUT /folders/{pk}", e.authUserMiddleware(e.updateFolder))
+	mux.HandleFunc("DELETE /folders/{pk}", e.authUserMiddleware(e.deleteFolder))
+	mux.HandleFunc("POST /folders/{pk}/read", e.authUserMiddleware(e.readFolder))
+	mux.HandleFunc("GET /subscriptions", e.authUserMiddleware(e.subscriptions))
+	mux.HandleFunc("PATCH /subscriptions/{feed_pk}", e.authUserMiddleware(e.patchSubscription))
+	mux.HandleFunc("PUT /subscriptions/{feed_pk}/folder", e.authUserMiddleware(e.setFolder))
+	mux.HandleFunc("POST /rules", e.authUserMiddleware(e.createRule))
+	mux.HandleFunc("GET /rules", e.authUserMiddleware(e.rules))
+	mux.HandleFunc("POST /rules/test", e.authUserMiddleware(e.testRule))
+	mux.HandleFunc("PUT /rules/{pk}", e.authUserMiddleware(e.updateRule))
+	mux.HandleFunc("DELETE /rules/{pk}", e.authUserMiddleware(e.deleteRule))
+	mux.HandleFunc("POST /rules/{pk}/apply", e.authUserMiddleware(e.applyRule))
+	mux.HandleFunc("POST /searches", e.authUserMiddleware(e.createSavedSearch))
+	mux.HandleFunc("GET /searches", e.authUserMiddleware(e.savedSearches))
+	mux.HandleFunc("GET /searches/{pk}", e.authUserMiddleware(e.savedSearch))
+	mux.HandleFunc("PUT /searches/{pk}", e.authUserMiddleware(e.updateSavedSearch))
+	mux.HandleFunc("DELETE /searches/{pk}", e.authUserMiddleware(e.deleteSavedSearch))
+	mux.HandleFunc("GET /searches/{pk}/articles", e.authUserMiddleware(e.savedSearchArticles))
+	mux.HandleFunc("POST /searches/{pk}/read", e.authUserMiddleware(e.readSavedSearch))
+	mux.HandleFunc("POST /searches/{pk}/confirm", e.authUserMiddleware(e.confirmAlertEmail))
+	mux.HandleFunc("PUT /account/api_password", e.authUserMiddleware(e.setApiPassword))
+	mux.HandleFunc("PUT /account/digest", e.authUserMiddleware(e.setDigest))
+	mux.HandleFunc("GET /account/digest", e.authUserMiddleware(e.digest))
+	mux.HandleFunc("DELETE /account/digest", e.authUserMiddleware(e.deleteDigest))
+	mux.HandleFunc("GET /deadletters", e.authUserMiddleware(e.authAdminMiddleware(e.deadLetters)))
+	mux.HandleFunc("POST /deadletters/{pk}/replay", e.authUserMiddleware(e.authAdminMiddleware(e.replayDeadLetter)))
+	mux.HandleFunc("DELETE /deadletters/{pk}", e.authUserMiddleware(e.authAdminMiddleware(e.deleteDeadLetter)))
+
+	// веб интерфейс
+	mux.HandleFunc("GET /ui/login", e.webLoginForm)
+	mux.HandleFunc("POST /ui/login", e.webLogin)
+	mux.HandleFunc("POST /ui/logout", e.webMiddleware(e.webLogout))
+	mux.HandleFunc("GET /ui/{$}", e.webMiddleware(e.webIndex))
+	mux.HandleFunc("POST /ui/subscribe", e.webMiddleware(e.webSubscribe))
+	mux.HandleFunc("POST /ui/unsubscribe", e.webMiddleware(e.webUnsubscribe))
+	mux.HandleFunc("POST /ui/add", e.webMiddleware(e.webAddFeed))
+	mux.HandleFunc("POST /ui/state", e.webMiddleware(e.webState))
+	mux.HandleFunc("POST /ui/open", e.webMiddleware(e.webOpen))
+	mux.HandleFunc("POST /ui/mark-all-read", e.webMiddleware(e.webMarkAllRead))
+	mux.Handle("GET /ui/static/", webStatic())
+
+	// Google Reader API
+	mux.HandleFunc("POST /accounts/ClientLogin", e.clientLogin)
+	mux.HandleFunc("GET /reader/api/0/token", e.greaderAuthMiddleware(e.greaderToken))
+	mux.HandleFunc("GET /reader/api/0/user-info", e.greaderAuthMiddleware(e.greaderUserInfo))
+	mux.HandleFunc("GET /reader/api/0/subscription/list", e.greaderAuthMiddleware(e.greaderSubscriptions))
+	mux.HandleFunc("GET /reader/api/0/tag/list", e.greaderAuthMiddleware(e.greaderTags))
+	mux.HandleFunc("GET /reader/api/0/unread-count", e.greaderAuthMiddleware(e.greaderUnreadCount))
+	mux.HandleFunc("GET /reader/api/0/stream/items/ids", e.greaderAuthMiddleware(e.greaderStreamIds))
+	mux.HandleFunc("GET /reader/api/0/stream/contents", e.greaderAuthMiddleware(e.greaderStreamContents))
+	mux.HandleFunc("GET /reader/api/0/stream/contents/{stream...}", e.greaderAuthMiddleware(e.greaderStreamContents))
+	mux.HandleFunc("POST /reader/api/0/stream/items/contents", e.greaderAuthMiddleware(e.greaderItemsContents))
+	mux.HandleFunc("POST /reader/api/0/edit-tag", e.greaderAuthMiddleware(e.greaderEditMiddleware(e.greaderEditTag)))
+	mux.HandleFunc("POST /reader/api/0/mark-all-as-read", e.greaderAuthMiddleware(e.greaderEditMiddleware(e.greaderMarkAllRead)))
+
+	// Fever API
+	mux.HandleFunc("GET /fever/{$}", e.fever)
+	mux.HandleFunc("POST /fever/{$}", e.fever)
 
 	return e.globalMiddleware(mux)
 }
\ No newline at end of file
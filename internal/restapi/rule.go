@@ -0,0 +1,173 @@
+package restapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"rss/internal/entity"
+	"rss/internal/repository"
+	"rss/internal/usecase"
+)
+
+// ruleBody тело запроса правила, без enabled правило включено.
+type ruleBody struct {
+	Title     string               `json:"title"`
+	Condition entity.RuleCondition `json:"condition"`
+	Actions   []entity.RuleAction  `json:"actions"`
+	Enabled   *bool                `json:"enabled"`
+}
+
+func (b ruleBody) rule() entity.Rule {
+	r := entity.Rule{Title: b.Title, Condition: b.Condition, Actions: b.Actions, Enabled: true}
+	if b.Enabled != nil {
+		r.Enabled = *b.Enabled
+	}
+	return r
+}
+
+// ruleError ответ на ошибки правил.
+func (e *RestApi) ruleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrRuleConfig):
+		e.responseJson(w, err.Error(), 400, nil)
+	case errors.Is(err, repository.ErrRuleNotFound):
+		e.responseJson(w, err.Error(), 404, nil)
+	default:
+		e.responseJson(w, "internal server error", 500, nil)
+	}
+}
+
+// decodeRule читает правило из json тела, при ошибке отвечает 400.
+func (e *RestApi) decodeRule(w http.ResponseWriter, req *http.Request) (entity.Rule, bool) {
+	var body ruleBody
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<16)).Decode(&body); err != nil {
+		e.responseJson(w, "body must be json rule", 400, nil)
+		return entity.Rule{}, false
+	}
+	return body.rule(), true
+}
+
+// recentLimit необязательный limit последних статей.
+func recentLimit(req *http.Request) (int, bool) {
+	v := req.URL.Query().Get("limit")
+	if v == "" {
+		return 0, true
+	}
+	limit, err := strconv.Atoi(v)
+	return limit, err == nil && limit > 0
+}
+
+// createRule создает правило.
+func (e *RestApi) createRule(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	r, ok := e.decodeRule(w, req)
+	if !ok {
+		return
+	}
+	ctx := req.Context()
+
+	r, err := e.uc.CreateRule(ctx, personPk, r)
+	if err != nil {
+		e.ruleError(w, err)
+		return
+	}
+	e.responseJson(w, "created", 201, r)
+}
+
+// rules возвращает правила пользователя.
+func (e *RestApi) rules(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	ctx := req.Context()
+
+	entities, err := e.uc.Rules(ctx, personPk)
+	if err != nil {
+		e.responseJson(w, "internal server error", 500, nil)
+		return
+	}
+	e.responseJson(w, succes, 200, entities)
+}
+
+// updateRule заменяет правило.
+func (e *RestApi) updateRule(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	pk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	r, ok := e.decodeRule(w, req)
+	if !ok {
+		return
+	}
+	ctx := req.Context()
+
+	if err := e.uc.UpdateRule(ctx, personPk, pk, r); err != nil {
+		e.ruleError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, nil)
+}
+
+// deleteRule удаляет правило.
+func (e *RestApi) deleteRule(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	pk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	if err := e.uc.DeleteRule(ctx, personPk, pk); err != nil {
+		e.ruleError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, nil)
+}
+
+// testRule возвращает последние статьи подписок под условие правила, ничего не меняя.
+func (e *RestApi) testRule(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	limit, ok := recentLimit(req)
+	if !ok {
+		e.responseJson(w, "limit must be positive int", 400, nil)
+		return
+	}
+	r, ok := e.decodeRule(w, req)
+	if !ok {
+		return
+	}
+	ctx := req.Context()
+
+	items, err := e.uc.TestRule(ctx, personPk, r.Condition, limit)
+	if err != nil {
+		e.ruleError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, items)
+}
+
+// applyRule применяет правило к последним статьям подписок.
+func (e *RestApi) applyRule(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	pk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	limit, ok := recentLimit(req)
+	if !ok {
+		e.responseJson(w, "limit must be positive int", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	matched, err := e.uc.ApplyRule(ctx, personPk, pk, limit)
+	if err != nil {
+		e.ruleError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, map[string]int{"matched": matched})
+}
@@ -0,0 +1,211 @@
+package restapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"rss/internal/entity"
+	"rss/internal/repository"
+	"rss/internal/usecase"
+)
+
+// savedSearchBody тело запроса сохраненного поиска.
+type savedSearchBody struct {
+	Title      string   `json:"title"`
+	Query      string   `json:"query"`
+	Feeds      []int    `json:"feeds"`
+	Categories []string `json:"categories"`
+	WindowDays int      `json:"window_days"`
+	AlertUrl   string   `json:"alert_url"`
+	AlertEmail string   `json:"alert_email"`
+}
+
+// savedSearchError ответ на ошибки сохраненных поисков.
+func (e *RestApi) savedSearchError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrSavedSearch), errors.Is(err, repository.ErrAlertCode):
+		e.responseJson(w, err.Error(), 400, nil)
+	case errors.Is(err, repository.ErrSavedSearchNotFound):
+		e.responseJson(w, err.Error(), 404, nil)
+	default:
+		e.responseJson(w, "internal server error", 500, nil)
+	}
+}
+
+// decodeSavedSearch читает поиск из json тела, при ошибке отвечает 400.
+func (e *RestApi) decodeSavedSearch(w http.ResponseWriter, req *http.Request) (entity.SavedSearch, bool) {
+	var body savedSearchBody
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<14)).Decode(&body); err != nil {
+		e.responseJson(w, "body must be json object", 400, nil)
+		return entity.SavedSearch{}, false
+	}
+	return entity.SavedSearch{
+		Title:      body.Title,
+		Query:      body.Query,
+		Feeds:      body.Feeds,
+		Categories: body.Categories,
+		WindowDays: body.WindowDays,
+		AlertUrl:   body.AlertUrl,
+		AlertEmail: body.AlertEmail,
+	}, true
+}
+
+// createSavedSearch сохраняет поиск.
+func (e *RestApi) createSavedSearch(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	s, ok := e.decodeSavedSearch(w, req)
+	if !ok {
+		return
+	}
+	ctx := req.Context()
+
+	s, err := e.uc.CreateSavedSearch(ctx, personPk, s)
+	if err != nil {
+		e.savedSearchError(w, err)
+		return
+	}
+	e.responseJson(w, "created", 201, s)
+}
+
+// savedSearches возвращает сохраненные поиски с непрочитанными.
+func (e *RestApi) savedSearches(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	ctx := req.Context()
+
+	entities, err := e.uc.SavedSearches(ctx, personPk)
+	if err != nil {
+		e.responseJson(w, "internal server error", 500, nil)
+		return
+	}
+	e.responseJson(w, succes, 200, entities)
+}
+
+// savedSearch возвращает сохраненный поиск с непрочитанными.
+func (e *RestApi) savedSearch(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	pk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	s, err := e.uc.SavedSearch(ctx, personPk, pk)
+	if err != nil {
+		e.savedSearchError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, s)
+}
+
+// updateSavedSearch заменяет условия и оповещения поиска.
+func (e *RestApi) updateSavedSearch(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	pk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	s, ok := e.decodeSavedSearch(w, req)
+	if !ok {
+		return
+	}
+	ctx := req.Context()
+
+	if err := e.uc.UpdateSavedSearch(ctx, personPk, pk, s); err != nil {
+		e.savedSearchError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, nil)
+}
+
+// deleteSavedSearch удаляет сохраненный поиск.
+func (e *RestApi) deleteSavedSearch(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	pk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	if err := e.uc.DeleteSavedSearch(ctx, personPk, pk); err != nil {
+		e.savedSearchError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, nil)
+}
+
+// savedSearchArticles возвращает статьи поиска: unread=true только непрочитанные, limit, offset.
+func (e *RestApi) savedSearchArticles(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	pk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	query := req.URL.Query()
+	unread := query.Get("unread") == "true"
+	var limit, offset int
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			e.responseJson(w, "limit must be int > 0", 400, nil)
+			return
+		}
+	}
+	if v := query.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			e.responseJson(w, "offset must be int >= 0", 400, nil)
+			return
+		}
+	}
+	ctx := req.Context()
+
+	entities, err := e.uc.SavedSearchArticles(ctx, personPk, pk, unread, limit, offset)
+	if err != nil {
+		e.savedSearchError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, entities)
+}
+
+// readSavedSearch отмечает статьи поиска прочитанными.
+func (e *RestApi) readSavedSearch(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	pk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	if err := e.uc.ViewedSavedSearch(ctx, personPk, pk); err != nil {
+		e.savedSearchError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, nil)
+}
+
+// confirmAlertEmail включает письма на alert_email по коду из письма.
+func (e *RestApi) confirmAlertEmail(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	pk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	code := req.PostFormValue("code")
+	if code == "" {
+		e.responseJson(w, "required code", 400, nil)
+		return
+	}
+	ctx := req.Context()
+
+	if err := e.uc.ConfirmAlertEmail(ctx, personPk, pk, code); err != nil {
+		e.savedSearchError(w, err)
+		return
+	}
+	e.responseJson(w, succes, 200, nil)
+}
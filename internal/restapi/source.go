@@ -0,0 +1,80 @@
+package restapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"rss/internal/entity"
+	"rss/internal/repository"
+	"rss/internal/usecase"
+)
+
+// sourceForm читает из формы вид источника и его разметку,
+// без kind это rss.
+func sourceForm(req *http.Request) (string, entity.SourceConfig) {
+	kind := req.PostFormValue("kind")
+	if kind == "" {
+		kind = entity.FeedKindRss
+	}
+	return kind, entity.SourceConfig{
+		Item:       req.PostFormValue("item"),
+		Title:      req.PostFormValue("title"),
+		Link:       req.PostFormValue("link"),
+		Date:       req.PostFormValue("date"),
+		DateLayout: req.PostFormValue("date_layout"),
+		Content:    req.PostFormValue("content"),
+	}
+}
+
+// setSource меняет вид источника канала и его разметку (администратор).
+func (e *RestApi) setSource(w http.ResponseWriter, req *http.Request) {
+	feedPk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	kind, src := sourceForm(req)
+
+	if err := e.uc.SetSource(req.Context(), feedPk, kind, src); err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrSourceConfig):
+			e.responseJson(w, err.Error(), 400, nil)
+		case errors.Is(err, repository.ErrNotFoundFeedPk):
+			e.responseJson(w, "feed_pk not found", 404, nil)
+		default:
+			e.responseJson(w, "internal server error", 500, nil)
+		}
+		return
+	}
+	e.responseJson(w, succes, 200, map[string]any{"kind": kind, "source": src})
+}
+
+// setProcessors меняет цепочку процессоров статей канала (администратор),
+// тело JSON [{"name": "drop", "params": {"title": "(?i)sponsored"}}].
+func (e *RestApi) setProcessors(w http.ResponseWriter, req *http.Request) {
+	feedPk, err := strconv.Atoi(req.PathValue("pk"))
+	if err != nil {
+		e.responseJson(w, "required pk (int)", 400, nil)
+		return
+	}
+	var cfgs []entity.ProcessorConfig
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<16)).Decode(&cfgs); err != nil {
+		e.responseJson(w, "required json array of processors", 400, nil)
+		return
+	}
+
+	if err := e.uc.SetProcessors(req.Context(), feedPk, cfgs); err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrProcessorConfig):
+			e.responseJson(w, err.Error(), 400, nil)
+		case errors.Is(err, repository.ErrNotFoundFeedPk):
+			e.responseJson(w, "feed_pk not found", 404, nil)
+		default:
+			e.responseJson(w, "internal server error", 500, nil)
+		}
+		return
+	}
+	e.responseJson(w, succes, 200, cfgs)
+}
@@ -0,0 +1,83 @@
+package restapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"rss/internal/entity"
+	"rss/internal/repository"
+	"rss/internal/usecase"
+)
+
+// subscriptionPatch тело PATCH, отсутствующие поля не меняются.
+type subscriptionPatch struct {
+	Title    *string `json:"title"`
+	Pinned   *bool   `json:"pinned"`
+	Priority *int    `json:"priority"`
+	// MutedUntil RFC 3339, пустая строка снимает откладывание
+	MutedUntil *string `json:"muted_until"`
+	Notify     *bool   `json:"notify"`
+	History    *string `json:"history"`
+}
+
+// subscriptions возвращает подписки пользователя с настройками.
+func (e *RestApi) subscriptions(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	ctx := req.Context()
+
+	entities, err := e.uc.Subscriptions(ctx, personPk)
+	if err != nil {
+		e.responseJson(w, "internal server error", 500, nil)
+		return
+	}
+	e.responseJson(w, succes, 200, entities)
+}
+
+// patchSubscription меняет настройки подписки: title, pinned, priority, muted_until, notify, history.
+func (e *RestApi) patchSubscription(w http.ResponseWriter, req *http.Request) {
+	personPk := req.Header.Get("X-Auth-ID")
+	feedPk, err := strconv.Atoi(req.PathValue("feed_pk"))
+	if err != nil {
+		e.responseJson(w, "required feed_pk (int)", 400, nil)
+		return
+	}
+	var body subscriptionPatch
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<14)).Decode(&body); err != nil {
+		e.responseJson(w, "body must be json object", 400, nil)
+		return
+	}
+	patch := entity.SubscriptionPatch{
+		Title:    body.Title,
+		Pinned:   body.Pinned,
+		Priority: body.Priority,
+		Notify:   body.Notify,
+		History:  body.History,
+	}
+	if body.MutedUntil != nil {
+		var until time.Time
+		if *body.MutedUntil != "" {
+			if until, err = time.Parse(time.RFC3339, *body.MutedUntil); err != nil {
+				e.responseJson(w, "muted_until must be RFC 3339", 400, nil)
+				return
+			}
+		}
+		patch.MutedUntil = &until
+	}
+	ctx := req.Context()
+
+	if err := e.uc.UpdateSubscription(ctx, personPk, feedPk, patch); err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrSubscriptionSettings):
+			e.responseJson(w, err.Error(), 400, nil)
+		case errors.Is(err, repository.ErrNotSubscribed):
+			e.responseJson(w, err.Error(), 404, nil)
+		default:
+			e.responseJson(w, "internal server error", 500, nil)
+		}
+		return
+	}
+	e.responseJson(w, succes, 200, nil)
+}
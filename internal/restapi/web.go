@@ -0,0 +1,489 @@
+package restapi
+
+/*
+	Веб интерфейс для чтения в браузере, шаблоны и статика встроены в бинарник.
+	Вход по логину и паролю из PUT /account/api_password, сессия в cookie,
+	каждая форма несет csrf токен сессии. Форма входа защищена double submit cookie.
+*/
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"rss/internal/entity"
+	"rss/internal/sanitize"
+	"rss/internal/usecase"
+)
+
+//go:embed web
+var webFS embed.FS
+
+const (
+	sessionCookie   = "rss_session"
+	loginCsrfCookie = "rss_login_csrf"
+	// статей на страницу списка
+	webPage = 50
+	webCsp  = "default-src 'self'; img-src * data:; media-src *; style-src 'self'; script-src 'self'; frame-ancestors 'none'; form-action 'self'"
+)
+
+type webSessionKey struct{}
+
+// webSessionFrom сессия запроса, проставляется webMiddleware.
+func webSessionFrom(ctx context.Context) entity.Session {
+	s, _ := ctx.Value(webSessionKey{}).(entity.Session)
+	return s
+}
+
+// webMiddleware пускает только с сессией, иначе на страницу входа,
+// у POST сверяет csrf токен формы с сессией.
+func (e *RestApi) webMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Security-Policy", webCsp)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		var token string
+		if c, err := req.Cookie(sessionCookie); err == nil {
+			token = c.Value
+		}
+		s, err := e.uc.Session(req.Context(), token)
+		if err != nil {
+			if !errors.Is(err, usecase.ErrBadCredentials) {
+				e.log.Err(err).Msg("web session")
+			}
+			http.Redirect(w, req, "/ui/login", http.StatusSeeOther)
+			return
+		}
+		if req.Method == http.MethodPost && !sameToken(req.PostFormValue("csrf"), s.Csrf) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, req.WithContext(context.WithValue(req.Context(), webSessionKey{}, s)))
+	}
+}
+
+func sameToken(a, b string) bool {
+	return a != "" && subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func (e *RestApi) setCookie(w http.ResponseWriter, name, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/ui/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   e.cfg.SecureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (e *RestApi) render(w http.ResponseWriter, name string, data any) {
+	w.Header().Set("Content-Security-Policy", webCsp)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := e.pages.ExecuteTemplate(w, name, data); err != nil {
+		e.log.Err(err).Str("page", name).Msg("render")
+	}
+}
+
+type loginPage struct {
+	Csrf  string
+	Error string
+}
+
+// webLoginForm страница входа, csrf кладется и в cookie и в форму.
+func (e *RestApi) webLoginForm(w http.ResponseWriter, req *http.Request) {
+	csrf, err := newCsrf()
+	if err != nil {
+		e.plainError(w, err)
+		return
+	}
+	e.setCookie(w, loginCsrfCookie, csrf, 3600)
+	e.render(w, "login.html", loginPage{Csrf: csrf})
+}
+
+// webLogin открывает сессию по логину и паролю, неудачные попытки ограничены LOGIN_ATTEMPTS.
+func (e *RestApi) webLogin(w http.ResponseWriter, req *http.Request) {
+	c, err := req.Cookie(loginCsrfCookie)
+	if err != nil || !sameToken(req.PostFormValue("csrf"), c.Value) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	ctx := req.Context()
+	login := req.PostFormValue("login")
+	keys := loginKeys(req, login)
+	if !e.logins.allowed(keys) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		e.render(w, "login.html", loginPage{Csrf: c.Value, Error: "Слишком много попыток входа, попробуйте позже"})
+		return
+	}
+
+	token, _, err := e.uc.StartSession(ctx, login, req.PostFormValue("password"), e.cfg.SessionTTL)
+	if err != nil {
+		if !errors.Is(err, usecase.ErrBadCredentials) {
+			e.log.Err(err).Msg("web login")
+		} else {
+			e.logins.fail(keys)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		e.render(w, "login.html", loginPage{Csrf: c.Value, Error: "Неверный логин или пароль"})
+		return
+	}
+	// счетчик адреса не сбрасывается, иначе его обнулял бы вход в свой аккаунт
+	e.logins.reset(keys[1])
+	e.setCookie(w, loginCsrfCookie, "", -1)
+	e.setCookie(w, sessionCookie, token, int(e.cfg.SessionTTL.Seconds()))
+	http.Redirect(w, req, "/ui/", http.StatusSeeOther)
+}
+
+// webLogout закрывает сессию.
+func (e *RestApi) webLogout(w http.ResponseWriter, req *http.Request) {
+	if c, err := req.Cookie(sessionCookie); err == nil {
+		if err := e.uc.EndSession(req.Context(), c.Value); err != nil {
+			e.log.Err(err).Msg("web logout")
+		}
+	}
+	e.setCookie(w, sessionCookie, "", -1)
+	http.Redirect(w, req, "/ui/login", http.StatusSeeOther)
+}
+
+type webSub struct {
+	entity.Subscription
+	Unread int
+}
+
+type webArticle struct {
+	entity.StreamItem
+	Html template.HTML
+}
+
+type indexPage struct {
+	Session   entity.Session
+	Admin     bool
+	Subs      []webSub
+	Unread    int
+	Available []entity.Feed
+	Items     []entity.StreamItem
+	Current   *webArticle
+	Folders   []entity.Folder
+	FeedPk    int
+	FolderPk  int
+	All       bool
+	Starred   bool
+	// Self текущая страница для возврата после форм
+	Self  string
+	Next  string
+	Error string
+}
+
+// Link ссылка на статью в текущем списке.
+func (p indexPage) Link(article int) string {
+	q := p.query(p.FeedPk, p.FolderPk)
+	q.Set("article", strconv.Itoa(article))
+	return webLink(q)
+}
+
+// ListLink ссылка на текущий список без выбранной статьи.
+func (p indexPage) ListLink() string {
+	return webLink(p.query(p.FeedPk, p.FolderPk))
+}
+
+// FeedLink ссылка на список канала, 0 все подписки, с текущими фильтрами.
+func (p indexPage) FeedLink(feedPk int) string {
+	return webLink(p.query(feedPk, 0))
+}
+
+// FolderLink ссылка на список папки с текущими фильтрами.
+func (p indexPage) FolderLink(folderPk int) string {
+	return webLink(p.query(0, folderPk))
+}
+
+// ToggleLink ссылка на тот же список с all или starred наоборот.
+func (p indexPage) ToggleLink(name string) string {
+	q := p.query(p.FeedPk, p.FolderPk)
+	if q.Get(name) == "1" {
+		q.Del(name)
+	} else {
+		q.Set(name, "1")
+	}
+	return webLink(q)
+}
+
+func webLink(q url.Values) string {
+	if len(q) == 0 {
+		return "/ui/"
+	}
+	return "/ui/?" + q.Encode()
+}
+
+func (p indexPage) query(feedPk int, folderPk int) url.Values {
+	q := url.Values{}
+	if feedPk != 0 {
+		q.Set("feed", strconv.Itoa(feedPk))
+	}
+	if folderPk != 0 {
+		q.Set("folder", strconv.Itoa(folderPk))
+	}
+	if p.All {
+		q.Set("all", "1")
+	}
+	if p.Starred {
+		q.Set("starred", "1")
+	}
+	return q
+}
+
+// webIndex подписки с непрочитанными, список статей и выбранная статья.
+// GET ничего не меняет, прочитанной статью отмечает POST /ui/open.
+func (e *RestApi) webIndex(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	s := webSessionFrom(ctx)
+	q := req.URL.Query()
+	page := indexPage{
+		Session: s,
+		Admin:   s.PersonPk == adminPk,
+		All:     q.Get("all") == "1",
+		Starred: q.Get("starred") == "1",
+		Error:   q.Get("error"),
+	}
+	// ошибка показывается один раз, формы возвращают на страницу без нее
+	q.Del("error")
+	page.Self = webLink(q)
+	page.FeedPk, _ = strconv.Atoi(q.Get("feed"))
+	page.FolderPk, _ = strconv.Atoi(q.Get("folder"))
+	offset, _ := strconv.Atoi(q.Get("c"))
+
+	subs, err := e.uc.Subscriptions(ctx, s.PersonPk)
+	if err != nil {
+		e.plainError(w, err)
+		return
+	}
+	counts, err := e.uc.UnreadCounts(ctx, s.PersonPk)
+	if err != nil {
+		e.plainError(w, err)
+		return
+	}
+	unread := make(map[int]int, len(counts))
+	for _, c := range counts {
+		unread[c.FeedPk] = c.Count
+		page.Unread += c.Count
+	}
+	subscribed := make(map[int]bool, len(subs))
+	for _, sub := range subs {
+		page.Subs = append(page.Subs, webSub{Subscription: sub, Unread: unread[sub.FeedPk]})
+		subscribed[sub.FeedPk] = true
+	}
+	page.Folders, err = e.uc.Folders(ctx, s.PersonPk)
+	if err != nil {
+		e.plainError(w, err)
+		return
+	}
+	available, err := e.uc.Available(ctx)
+	if err != nil {
+		e.plainError(w, err)
+		return
+	}
+	for _, f := range available {
+		if !subscribed[f.Pk] {
+			page.Available = append(page.Available, f)
+		}
+	}
+
+	if pk, err := strconv.Atoi(q.Get("article")); err == nil {
+		current, err := e.webArticle(ctx, s.PersonPk, pk)
+		if err != nil {
+			e.plainError(w, err)
+			return
+		}
+		page.Current = current
+	}
+
+	f := entity.StreamFilter{FeedPk: page.FeedPk, FolderPk: page.FolderPk, Starred: page.Starred, Unread: !page.All && !page.Starred, Limit: webPage, Offset: offset}
+	page.Items, err = e.uc.Stream(ctx, s.PersonPk, f)
+	if err != nil {
+		e.plainError(w, err)
+		return
+	}
+	if page.Current != nil && f.Unread {
+		// только что прочитанная статья остается в списке до перехода
+		page.Items = keepCurrent(page.Items, page.Current.StreamItem)
+	}
+	if len(page.Items) == webPage {
+		next := q
+		next.Set("c", strconv.Itoa(offset+webPage))
+		next.Del("article")
+		page.Next = webLink(next)
+	}
+	e.render(w, "index.html", page)
+}
+
+// webArticle статья для панели чтения с очищенным html.
+func (e *RestApi) webArticle(ctx context.Context, personPk string, pk int) (*webArticle, error) {
+	items, err := e.uc.Stream(ctx, personPk, entity.StreamFilter{Pks: []int{pk}, Limit: 1})
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	it := items[0]
+	content := it.FullContent
+	if content == "" {
+		content = it.Content
+	}
+	return &webArticle{StreamItem: it, Html: template.HTML(sanitize.HTML(content))}, nil
+}
+
+func keepCurrent(items []entity.StreamItem, current entity.StreamItem) []entity.StreamItem {
+	for i := range items {
+		if items[i].Pk == current.Pk {
+			return items
+		}
+	}
+	return append([]entity.StreamItem{current}, items...)
+}
+
+// back возвращает на страницу из формы, только внутри /ui/.
+// Прошлая ошибка из адреса убирается, новая errMsg добавляется.
+func back(w http.ResponseWriter, req *http.Request, errMsg string) {
+	to := req.PostFormValue("back")
+	if !strings.HasPrefix(to, "/ui/") || strings.HasPrefix(to, "//") || strings.Contains(to, "\\") {
+		to = "/ui/"
+	}
+	u, err := url.Parse(to)
+	if err != nil || u.Path != "/ui/" {
+		u = &url.URL{Path: "/ui/"}
+	}
+	q := u.Query()
+	q.Del("error")
+	if errMsg != "" {
+		q.Set("error", errMsg)
+	}
+	http.Redirect(w, req, webLink(q), http.StatusSeeOther)
+}
+
+// webOpen отмечает статью прочитанной и открывает ее, back ссылка на статью в списке.
+func (e *RestApi) webOpen(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	pk, err := strconv.Atoi(req.PostFormValue("pk"))
+	if err != nil {
+		back(w, req, "Неверная статья")
+		return
+	}
+	read := true
+	if err := e.uc.SetState(ctx, webSessionFrom(ctx).PersonPk, []int{pk}, &read, nil); err != nil {
+		e.log.Err(err).Msg("web open")
+		back(w, req, "Не удалось отметить прочитанной")
+		return
+	}
+	back(w, req, "")
+}
+
+// webSubscribe подписка на канал из списка доступных.
+func (e *RestApi) webSubscribe(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	feedPk := req.PostFormValue("feed_pk")
+	if !IsInt(feedPk) {
+		back(w, req, "Выберите канал")
+		return
+	}
+	if err := e.uc.Subscribe(ctx, webSessionFrom(ctx).PersonPk, feedPk, ""); err != nil {
+		e.log.Err(err).Msg("web subscribe")
+		back(w, req, "Не удалось подписаться")
+		return
+	}
+	back(w, req, "")
+}
+
+// webUnsubscribe отписка от канала.
+func (e *RestApi) webUnsubscribe(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	feedPk := req.PostFormValue("feed_pk")
+	if !IsInt(feedPk) {
+		back(w, req, "Выберите канал")
+		return
+	}
+	if err := e.uc.Unsubscribe(ctx, webSessionFrom(ctx).PersonPk, feedPk); err != nil {
+		e.log.Err(err).Msg("web unsubscribe")
+		back(w, req, "Не удалось отписаться")
+		return
+	}
+	http.Redirect(w, req, "/ui/", http.StatusSeeOther)
+}
+
+// webAddFeed добавляет rss канал, только администратор.
+func (e *RestApi) webAddFeed(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	if webSessionFrom(ctx).PersonPk != adminPk {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	feedUrl := req.PostFormValue("feed_url")
+	if !IsUrl(feedUrl) {
+		back(w, req, "Неверный url")
+		return
+	}
+	if err := e.uc.AddFeed(ctx, entity.Feed{FeedUrl: feedUrl}); err != nil {
+		e.log.Err(err).Msg("web add feed")
+		back(w, req, "Не удалось добавить канал")
+		return
+	}
+	back(w, req, "")
+}
+
+// webState отмечает статью прочитанной или избранной, read и starred 0 или 1.
+func (e *RestApi) webState(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	pk, err := strconv.Atoi(req.PostFormValue("pk"))
+	if err != nil {
+		back(w, req, "Неверная статья")
+		return
+	}
+	var read, starred *bool
+	if v := req.PostFormValue("read"); v != "" {
+		b := v == "1"
+		read = &b
+	}
+	if v := req.PostFormValue("starred"); v != "" {
+		b := v == "1"
+		starred = &b
+	}
+	if err := e.uc.SetState(ctx, webSessionFrom(ctx).PersonPk, []int{pk}, read, starred); err != nil {
+		e.log.Err(err).Msg("web state")
+		back(w, req, "Не удалось сохранить")
+		return
+	}
+	back(w, req, "")
+}
+
+// webMarkAllRead отмечает прочитанным канал, папку или все подписки.
+func (e *RestApi) webMarkAllRead(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	feedPk, _ := strconv.Atoi(req.PostFormValue("feed_pk"))
+	folderPk, _ := strconv.Atoi(req.PostFormValue("folder_pk"))
+	if err := e.uc.MarkAllRead(ctx, webSessionFrom(ctx).PersonPk, feedPk, folderPk, time.Time{}); err != nil {
+		e.log.Err(err).Msg("web mark all read")
+		back(w, req, "Не удалось отметить прочитанным")
+		return
+	}
+	back(w, req, "")
+}
+
+// webStatic стили и скрипт интерфейса.
+func webStatic() http.Handler {
+	static, _ := fs.Sub(webFS, "web/static")
+	return http.StripPrefix("/ui/static/", http.FileServer(http.FS(static)))
+}
+
+func newCsrf() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
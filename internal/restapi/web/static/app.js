@@ -0,0 +1,87 @@
+// Навигация с клавиатуры: j/k следующая/предыдущая статья, m прочитано, s избранное,
+// u все/непрочитанные, g все подписки, a подписаться.
+(function () {
+	// статья открывается формой, она же отмечает ее прочитанной
+	function items() {
+		return Array.prototype.slice.call(document.querySelectorAll('.items .item form'));
+	}
+
+	function move(step) {
+		var forms = items();
+		if (forms.length === 0) {
+			return;
+		}
+		var current = -1;
+		forms.forEach(function (f, i) {
+			if (f.parentElement.classList.contains('selected')) {
+				current = i;
+			}
+		});
+		var next = current + step;
+		if (current === -1) {
+			next = 0;
+		}
+		if (next < 0 || next >= forms.length) {
+			return;
+		}
+		forms[next].submit();
+	}
+
+	function submit(id) {
+		var form = document.getElementById(id);
+		if (form) {
+			form.submit();
+		}
+	}
+
+	function follow(id) {
+		var link = document.getElementById(id);
+		if (link) {
+			window.location.href = link.href;
+		}
+	}
+
+	document.addEventListener('keydown', function (e) {
+		if (e.ctrlKey || e.metaKey || e.altKey) {
+			return;
+		}
+		var tag = e.target.tagName;
+		if (tag === 'INPUT' || tag === 'SELECT' || tag === 'TEXTAREA') {
+			return;
+		}
+		switch (e.key) {
+		case 'j':
+			move(1);
+			break;
+		case 'k':
+			move(-1);
+			break;
+		case 'm':
+			submit('form-read');
+			break;
+		case 's':
+			submit('form-star');
+			break;
+		case 'u':
+			follow('toggle-all');
+			break;
+		case 'g':
+			window.location.href = '/ui/';
+			break;
+		case 'a':
+			var el = document.getElementById('subscribe') || document.getElementById('add');
+			if (el) {
+				el.focus();
+				e.preventDefault();
+			}
+			break;
+		default:
+			return;
+		}
+	});
+
+	var selected = document.querySelector('.items .item.selected');
+	if (selected) {
+		selected.scrollIntoView({block: 'nearest'});
+	}
+})();
@@ -0,0 +1,228 @@
+// Package rule проверяет и вычисляет правила пользователей над статьями.
+package rule
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"rss/internal/entity"
+	"rss/internal/htmltext"
+)
+
+// Поля статьи в условиях.
+const (
+	FieldTitle    = "title"
+	FieldContent  = "content"
+	FieldAuthor   = "author"
+	FieldCategory = "category"
+	// FieldFeed pk канала, сравнивается как строка
+	FieldFeed = "feed"
+	FieldUrl  = "url"
+)
+
+// Способы сравнения, contains и equals без учета регистра.
+const (
+	OpContains = "contains"
+	OpEquals   = "equals"
+	OpRegex    = "regex"
+)
+
+const (
+	// ограничения размера условия
+	maxDepth = 5
+	maxNodes = 50
+	// ограничения действий
+	maxActions = 10
+	maxTagLen  = 64
+)
+
+var (
+	ErrEmpty      = errors.New("condition is empty")
+	ErrTooComplex = errors.New("condition is too complex")
+	ErrNoActions  = errors.New("rule needs at least one action")
+)
+
+// Matcher скомпилированное условие правила.
+type Matcher struct {
+	node node
+}
+
+type node interface {
+	match(a *entity.Article) bool
+}
+
+// Compile проверяет условие и компилирует регулярные выражения.
+func Compile(c entity.RuleCondition) (*Matcher, error) {
+	n := 0
+	root, err := compile(c, 1, &n)
+	if err != nil {
+		return nil, err
+	}
+	return &Matcher{node: root}, nil
+}
+
+// Match true если статья под условие.
+func (m *Matcher) Match(a *entity.Article) bool {
+	return m.node.match(a)
+}
+
+// ValidateActions проверяет действия правила.
+func ValidateActions(actions []entity.RuleAction) error {
+	if len(actions) == 0 {
+		return ErrNoActions
+	}
+	if len(actions) > maxActions {
+		return fmt.Errorf("rule has more than %d actions", maxActions)
+	}
+	for _, a := range actions {
+		switch a.Type {
+		case entity.RuleRead, entity.RuleStar, entity.RuleHide, entity.RuleNotify:
+		case entity.RuleTag:
+			if v := strings.TrimSpace(a.Value); v == "" || len(v) > maxTagLen {
+				return fmt.Errorf("tag needs value up to %d bytes", maxTagLen)
+			}
+		default:
+			return fmt.Errorf("unknown action %q", a.Type)
+		}
+	}
+	return nil
+}
+
+func compile(c entity.RuleCondition, depth int, n *int) (node, error) {
+	*n++
+	if depth > maxDepth || *n > maxNodes {
+		return nil, ErrTooComplex
+	}
+
+	set := 0
+	for _, ok := range []bool{c.All != nil, c.Any != nil, c.Not != nil, c.Field != ""} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, errors.New("condition needs exactly one of all, any, not or field")
+	}
+
+	switch {
+	case c.All != nil:
+		nodes, err := compileList(c.All, depth, n)
+		return allOf(nodes), err
+	case c.Any != nil:
+		nodes, err := compileList(c.Any, depth, n)
+		return anyOf(nodes), err
+	case c.Not != nil:
+		inner, err := compile(*c.Not, depth+1, n)
+		return not{inner}, err
+	}
+	return compileLeaf(c)
+}
+
+func compileList(list []entity.RuleCondition, depth int, n *int) ([]node, error) {
+	if len(list) == 0 {
+		return nil, ErrEmpty
+	}
+	nodes := make([]node, 0, len(list))
+	for _, c := range list {
+		inner, err := compile(c, depth+1, n)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, inner)
+	}
+	return nodes, nil
+}
+
+func compileLeaf(c entity.RuleCondition) (node, error) {
+	switch c.Field {
+	case FieldTitle, FieldContent, FieldAuthor, FieldCategory, FieldFeed, FieldUrl:
+	default:
+		return nil, fmt.Errorf("unknown field %q", c.Field)
+	}
+	if c.Value == "" {
+		return nil, fmt.Errorf("%s: empty value", c.Field)
+	}
+
+	l := leaf{field: c.Field}
+	switch c.Op {
+	case OpContains:
+		value := strings.ToLower(c.Value)
+		l.test = func(s string) bool { return strings.Contains(strings.ToLower(s), value) }
+	case OpEquals:
+		l.test = func(s string) bool { return strings.EqualFold(s, c.Value) }
+	case OpRegex:
+		re, err := regexp.Compile(c.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.Field, err)
+		}
+		l.test = re.MatchString
+	default:
+		return nil, fmt.Errorf("unknown op %q", c.Op)
+	}
+	return l, nil
+}
+
+type allOf []node
+
+func (ns allOf) match(a *entity.Article) bool {
+	for _, n := range ns {
+		if !n.match(a) {
+			return false
+		}
+	}
+	return true
+}
+
+type anyOf []node
+
+func (ns anyOf) match(a *entity.Article) bool {
+	for _, n := range ns {
+		if n.match(a) {
+			return true
+		}
+	}
+	return false
+}
+
+type not struct {
+	node node
+}
+
+func (n not) match(a *entity.Article) bool {
+	return !n.node.match(a)
+}
+
+// leaf сравнение поля, у авторов и категорий достаточно одного совпадения.
+type leaf struct {
+	field string
+	test  func(string) bool
+}
+
+func (l leaf) match(a *entity.Article) bool {
+	switch l.field {
+	case FieldTitle:
+		return l.test(a.Title)
+	case FieldContent:
+		return l.test(htmltext.Strip(a.Content)) || a.FullContent != "" && l.test(htmltext.Strip(a.FullContent))
+	case FieldUrl:
+		return l.test(a.SourceUrl)
+	case FieldFeed:
+		return l.test(strconv.Itoa(a.FeedPk))
+	case FieldAuthor:
+		for _, au := range a.Authors {
+			if l.test(au.Name) || au.Email != "" && l.test(au.Email) {
+				return true
+			}
+		}
+	case FieldCategory:
+		for _, c := range a.Categories {
+			if l.test(c) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package rule
+
+import (
+	"errors"
+	"testing"
+
+	"rss/internal/entity"
+)
+
+func leafCond(field, op, value string) entity.RuleCondition {
+	return entity.RuleCondition{Field: field, Op: op, Value: value}
+}
+
+// nested условие из depth вложенных not.
+func nested(depth int) entity.RuleCondition {
+	c := leafCond(FieldTitle, OpContains, "go")
+	for i := 1; i < depth; i++ {
+		inner := c
+		c = entity.RuleCondition{Not: &inner}
+	}
+	return c
+}
+
+func TestCompileErrors(t *testing.T) {
+	title := leafCond(FieldTitle, OpContains, "go")
+	wide := make([]entity.RuleCondition, maxNodes)
+	for i := range wide {
+		wide[i] = title
+	}
+	tests := []struct {
+		name string
+		c    entity.RuleCondition
+		err  error
+	}{
+		{"nothing set", entity.RuleCondition{}, nil},
+		{"two kinds", entity.RuleCondition{All: []entity.RuleCondition{title}, Field: FieldTitle, Op: OpContains, Value: "go"}, nil},
+		{"empty all", entity.RuleCondition{All: []entity.RuleCondition{}}, ErrEmpty},
+		{"empty any", entity.RuleCondition{Any: []entity.RuleCondition{}}, ErrEmpty},
+		{"unknown field", leafCond("body", OpContains, "go"), nil},
+		{"unknown op", leafCond(FieldTitle, "like", "go"), nil},
+		{"empty value", leafCond(FieldTitle, OpContains, ""), nil},
+		{"bad regex", leafCond(FieldTitle, OpRegex, "("), nil},
+		{"too deep", nested(maxDepth + 1), ErrTooComplex},
+		{"too many nodes", entity.RuleCondition{Any: wide}, ErrTooComplex},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(tt.c)
+			if err == nil {
+				t.Fatal("Compile: want error")
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("Compile: %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCompileLimits(t *testing.T) {
+	if _, err := Compile(nested(maxDepth)); err != nil {
+		t.Errorf("depth %d: %v", maxDepth, err)
+	}
+	wide := make([]entity.RuleCondition, maxNodes-1)
+	for i := range wide {
+		wide[i] = leafCond(FieldTitle, OpContains, "go")
+	}
+	if _, err := Compile(entity.RuleCondition{Any: wide}); err != nil {
+		t.Errorf("%d nodes: %v", maxNodes, err)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	a := &entity.Article{
+		Title:       "Go 1.22 Released",
+		Content:     "<p>New <b>loop</b> semantics</p>",
+		FullContent: "<article>Range over integers</article>",
+		SourceUrl:   "https://go.dev/blog/go1.22",
+		FeedPk:      12,
+		Authors:     []entity.Author{{Name: "Eli Bendersky"}, {Name: "Gopher", Email: "team@go.dev"}},
+		Categories:  []string{"release", "Go"},
+	}
+	title := leafCond(FieldTitle, OpContains, "released")
+	other := leafCond(FieldTitle, OpContains, "rust")
+	tests := []struct {
+		name string
+		c    entity.RuleCondition
+		want bool
+	}{
+		{"contains ignores case", title, true},
+		{"contains misses", other, false},
+		{"equals ignores case", leafCond(FieldTitle, OpEquals, "go 1.22 released"), true},
+		{"equals whole value", leafCond(FieldTitle, OpEquals, "go 1.22"), false},
+		{"regex", leafCond(FieldUrl, OpRegex, `^https://go\.dev/`), true},
+		{"regex keeps case", leafCond(FieldTitle, OpRegex, "released"), false},
+		{"content without html", leafCond(FieldContent, OpContains, "SEMANTICS"), true},
+		{"content tags ignored", leafCond(FieldContent, OpContains, "<b>"), false},
+		{"full content", leafCond(FieldContent, OpContains, "range over"), true},
+		{"author name", leafCond(FieldAuthor, OpEquals, "eli bendersky"), true},
+		{"author email", leafCond(FieldAuthor, OpContains, "@go.dev"), true},
+		{"any category", leafCond(FieldCategory, OpEquals, "go"), true},
+		{"feed pk", leafCond(FieldFeed, OpEquals, "12"), true},
+		{"feed pk whole", leafCond(FieldFeed, OpEquals, "1"), false},
+		{"all", entity.RuleCondition{All: []entity.RuleCondition{title, other}}, false},
+		{"any", entity.RuleCondition{Any: []entity.RuleCondition{other, title}}, true},
+		{"not", entity.RuleCondition{Not: &other}, true},
+		{"nested", entity.RuleCondition{Any: []entity.RuleCondition{
+			other,
+			{All: []entity.RuleCondition{title, {Not: &entity.RuleCondition{Field: FieldFeed, Op: OpEquals, Value: "12"}}}},
+		}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Compile(tt.c)
+			if err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			if got := m.Match(a); got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchEmptyArticle(t *testing.T) {
+	for _, f := range []string{FieldAuthor, FieldCategory} {
+		m, err := Compile(leafCond(f, OpRegex, ".*"))
+		if err != nil {
+			t.Fatalf("Compile %s: %v", f, err)
+		}
+		if m.Match(&entity.Article{}) {
+			t.Errorf("%s matched article without values", f)
+		}
+	}
+}
+
+func TestValidateActions(t *testing.T) {
+	long := make([]byte, maxTagLen+1)
+	for i := range long {
+		long[i] = 'a'
+	}
+	tests := []struct {
+		name    string
+		actions []entity.RuleAction
+		ok      bool
+	}{
+		{"none", nil, false},
+		{"all kinds", []entity.RuleAction{{Type: entity.RuleRead}, {Type: entity.RuleStar}, {Type: entity.RuleHide}, {Type: entity.RuleNotify}, {Type: entity.RuleTag, Value: "ads"}}, true},
+		{"tag without value", []entity.RuleAction{{Type: entity.RuleTag, Value: "  "}}, false},
+		{"long tag", []entity.RuleAction{{Type: entity.RuleTag, Value: string(long)}}, false},
+		{"unknown", []entity.RuleAction{{Type: "delete"}}, false},
+		{"too many", make([]entity.RuleAction, maxActions+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateActions(tt.actions)
+			if (err == nil) != tt.ok {
+				t.Errorf("ValidateActions: %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
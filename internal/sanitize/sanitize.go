@@ -0,0 +1,199 @@
+package sanitize
+
+/*
+	Санитайзер html по белому списку:
+	1) теги из allowed остаются с разрешенными атрибутами.
+	2) теги из dropped удаляются вместе с содержимым.
+	3) остальные теги удаляются, их текст остается.
+	Ссылки только http, https и mailto, картинки 1x1 (пиксели трекинга) удаляются.
+*/
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var allowed = map[atom.Atom][]string{
+	atom.A:          {"href", "title"},
+	atom.Abbr:       {"title"},
+	atom.B:          nil,
+	atom.Blockquote: {"cite"},
+	atom.Br:         nil,
+	atom.Caption:    nil,
+	atom.Code:       nil,
+	atom.Dd:         nil,
+	atom.Del:        nil,
+	atom.Div:        nil,
+	atom.Dl:         nil,
+	atom.Dt:         nil,
+	atom.Em:         nil,
+	atom.Figcaption: nil,
+	atom.Figure:     nil,
+	atom.H1:         nil,
+	atom.H2:         nil,
+	atom.H3:         nil,
+	atom.H4:         nil,
+	atom.H5:         nil,
+	atom.H6:         nil,
+	atom.Hr:         nil,
+	atom.I:          nil,
+	atom.Img:        {"src", "alt", "title", "width", "height"},
+	atom.Ins:        nil,
+	atom.Li:         nil,
+	atom.Ol:         nil,
+	atom.P:          nil,
+	atom.Pre:        nil,
+	atom.Q:          {"cite"},
+	atom.S:          nil,
+	atom.Small:      nil,
+	atom.Span:       nil,
+	atom.Strong:     nil,
+	atom.Sub:        nil,
+	atom.Sup:        nil,
+	atom.Table:      nil,
+	atom.Tbody:      nil,
+	atom.Td:         {"colspan", "rowspan"},
+	atom.Tfoot:      nil,
+	atom.Th:         {"colspan", "rowspan"},
+	atom.Thead:      nil,
+	atom.Tr:         nil,
+	atom.U:          nil,
+	atom.Ul:         nil,
+}
+
+var dropped = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Head:     true,
+	atom.Title:    true,
+	atom.Iframe:   true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Svg:      true,
+	atom.Math:     true,
+	atom.Form:     true,
+	atom.Button:   true,
+	atom.Select:   true,
+	atom.Textarea: true,
+}
+
+// void теги без закрывающего
+var void = map[atom.Atom]bool{atom.Br: true, atom.Hr: true, atom.Img: true}
+
+// HTML возвращает безопасный html из недоверенного.
+func HTML(s string) string {
+	var b strings.Builder
+	z := html.NewTokenizer(strings.NewReader(s))
+	// глубина внутри удаляемого с содержимым тега
+	var skip int
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			// конец документа или битый хвост, отдаем что собрали
+			return strings.TrimSpace(b.String())
+		}
+		tok := z.Token()
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if dropped[tok.DataAtom] {
+				if tt == html.StartTagToken {
+					skip++
+				}
+				continue
+			}
+			if skip > 0 {
+				continue
+			}
+			attrs, ok := allowed[tok.DataAtom]
+			if !ok {
+				continue
+			}
+			if tok.DataAtom == atom.Img && trackingPixel(tok) {
+				continue
+			}
+			writeTag(&b, tok, attrs)
+		case html.EndTagToken:
+			if dropped[tok.DataAtom] {
+				if skip > 0 {
+					skip--
+				}
+				continue
+			}
+			if skip > 0 || void[tok.DataAtom] {
+				continue
+			}
+			if _, ok := allowed[tok.DataAtom]; ok {
+				b.WriteString("</" + tok.Data + ">")
+			}
+		case html.TextToken:
+			if skip == 0 {
+				b.WriteString(html.EscapeString(tok.Data))
+			}
+		}
+	}
+}
+
+func writeTag(b *strings.Builder, tok html.Token, attrs []string) {
+	b.WriteString("<" + tok.Data)
+	for _, a := range tok.Attr {
+		if a.Namespace != "" || !contains(attrs, a.Key) {
+			continue
+		}
+		v := a.Val
+		if a.Key == "href" || a.Key == "src" || a.Key == "cite" {
+			if v = safeUrl(v); v == "" {
+				continue
+			}
+		}
+		b.WriteString(" " + a.Key + `="` + html.EscapeString(v) + `"`)
+	}
+	if tok.DataAtom == atom.A {
+		b.WriteString(` rel="noopener noreferrer nofollow"`)
+	}
+	if void[tok.DataAtom] {
+		b.WriteString("/>")
+		return
+	}
+	b.WriteString(">")
+}
+
+// safeUrl оставляет только http, https и mailto, относительные ссылки тоже.
+func safeUrl(v string) string {
+	u, err := url.Parse(strings.TrimSpace(v))
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return u.String()
+	}
+	return ""
+}
+
+// trackingPixel картинка 1x1 для учета открытия письма.
+func trackingPixel(tok html.Token) bool {
+	var w, h string
+	for _, a := range tok.Attr {
+		switch a.Key {
+		case "width":
+			w = strings.TrimSpace(a.Val)
+		case "height":
+			h = strings.TrimSpace(a.Val)
+		}
+	}
+	return (w == "0" || w == "1") && (h == "0" || h == "1")
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+// Package sendmail отправляет письма пользователям через SMTP сервер из MailConfig.
+package sendmail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"rss/configs"
+)
+
+// ErrDisabled SMTP_HOST не задан.
+var ErrDisabled = errors.New("smtp is not configured")
+
+// Message письмо, с HTML собирается multipart/alternative с текстовой частью.
+type Message struct {
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type Sender struct {
+	cfg  config.MailConfig
+	from *mail.Address
+}
+
+// New nil если отправка выключена.
+func New(cfg config.MailConfig) (*Sender, error) {
+	if cfg.SmtpHost == "" {
+		return nil, nil
+	}
+	switch cfg.SmtpTLS {
+	case "starttls", "tls", "none":
+	default:
+		return nil, fmt.Errorf("unknown SMTP_TLS %q", cfg.SmtpTLS)
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("MAIL_FROM: %w", err)
+	}
+	return &Sender{cfg: cfg, from: from}, nil
+}
+
+// Send отправляет письмо одним SMTP соединением.
+func (s *Sender) Send(ctx context.Context, m Message) error {
+	if s == nil {
+		return ErrDisabled
+	}
+	rcpts := make([]string, 0, len(m.To))
+	for _, to := range m.To {
+		addr, err := mail.ParseAddress(to)
+		if err != nil {
+			return fmt.Errorf("recipient %q: %w", to, err)
+		}
+		rcpts = append(rcpts, addr.Address)
+	}
+	body, err := s.build(m)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.SmtpSendTimeout)
+	defer cancel()
+	client, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if s.cfg.SmtpUser != "" {
+		auth := smtp.PlainAuth("", s.cfg.SmtpUser, s.cfg.SmtpPassword, s.cfg.SmtpHost)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(s.from.Address); err != nil {
+		return err
+	}
+	for _, to := range rcpts {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// dial подключается с учетом SMTP_TLS, дедлайн контекста ставится на все соединение.
+func (s *Sender) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(s.cfg.SmtpHost, strconv.Itoa(s.cfg.SmtpPort))
+	tlsConfig := &tls.Config{ServerName: s.cfg.SmtpHost}
+
+	var conn net.Conn
+	var err error
+	if s.cfg.SmtpTLS == "tls" {
+		conn, err = (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.cfg.SmtpHost)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if s.cfg.SmtpTLS == "starttls" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// build собирает письмо, части в quoted-printable.
+func (s *Sender) build(m Message) ([]byte, error) {
+	var b bytes.Buffer
+	header := textproto.MIMEHeader{}
+	header.Set("From", s.from.String())
+	header.Set("To", strings.Join(m.To, ", "))
+	// переводы строк в теме дописали бы свои заголовки
+	subject := strings.Join(strings.Fields(m.Subject), " ")
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header.Set("Date", time.Now().Format(time.RFC1123Z))
+	header.Set("Message-ID", "<"+messageId()+"@"+s.from.Address[strings.LastIndexByte(s.from.Address, '@')+1:]+">")
+	header.Set("MIME-Version", "1.0")
+
+	if m.HTML == "" {
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		writeHeader(&b, header)
+		if err := writeQuoted(&b, m.Text); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&b)
+	header.Set("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	writeHeader(&b, header)
+	for _, part := range []struct{ mime, body string }{{"text/plain", m.Text}, {"text/html", m.HTML}} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.mime + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuoted(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func writeHeader(b *bytes.Buffer, header textproto.MIMEHeader) {
+	for _, k := range []string{"From", "To", "Subject", "Date", "Message-ID", "MIME-Version",
+		"Content-Type", "Content-Transfer-Encoding"} {
+		if v := header.Get(k); v != "" {
+			b.WriteString(k + ": " + v + "\r\n")
+		}
+	}
+	b.WriteString("\r\n")
+}
+
+func writeQuoted(w io.Writer, s string) error {
+	qw := quotedprintable.NewWriter(w)
+	if _, err := qw.Write([]byte(s)); err != nil {
+		return err
+	}
+	return qw.Close()
+}
+
+func messageId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,60 @@
+package simhash
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+
+	"rss/internal/htmltext"
+)
+
+// вес слов заголовка относительно слов текста
+const titleWeight = 3
+
+// Fingerprint SimHash заголовка и html текста статьи.
+// Текст нормализуется: теги, регистр и пунктуация отбрасываются,
+// признаками служат пары соседних слов.
+func Fingerprint(title, content string) uint64 {
+	var v [64]int
+
+	add := func(words []string, weight int) {
+		for i := range words {
+			feature := words[i]
+			if i+1 < len(words) {
+				feature += " " + words[i+1]
+			}
+			h := fnv.New64a()
+			h.Write([]byte(feature))
+			sum := h.Sum64()
+			for bit := 0; bit < 64; bit++ {
+				if sum&(1<<bit) != 0 {
+					v[bit] += weight
+				} else {
+					v[bit] -= weight
+				}
+			}
+		}
+	}
+	add(normalize(title), titleWeight)
+	add(normalize(htmltext.Strip(content)), 1)
+
+	var fp uint64
+	for bit := 0; bit < 64; bit++ {
+		if v[bit] > 0 {
+			fp |= 1 << bit
+		}
+	}
+	return fp
+}
+
+// Distance расстояние Хэмминга между отпечатками.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+func normalize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
@@ -0,0 +1,259 @@
+package smtpd
+
+/*
+	Минимальный SMTP сервер только для приема писем (RFC 5321):
+	HELO/EHLO, MAIL, RCPT, DATA, RSET, NOOP, QUIT.
+	Без TLS и AUTH, снаружи его должен закрывать MTA или прокси.
+*/
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// ErrUnknownRecipient получателя нет, письмо отклоняется с 550.
+var ErrUnknownRecipient = errors.New("unknown recipient")
+
+// лимит получателей одного письма
+const maxRecipients = 100
+
+// лимит строки команды с CRLF, RFC 5321 4.5.3.1
+const maxLine = 1000
+
+var errLineTooLong = errors.New("line too long")
+
+// Handler решает, принимать ли получателя, и доставляет письмо.
+type Handler interface {
+	// Recipient ErrUnknownRecipient отклоняет получателя, другая ошибка временная.
+	Recipient(addr string) error
+	// Deliver ошибка временная, отправитель повторит письмо позже.
+	Deliver(from string, to []string, data []byte) error
+}
+
+type Server struct {
+	Addr    string
+	Domain  string
+	MaxSize int64
+	Timeout time.Duration
+	// MaxConns одновременных сессий, сверх лимита 421, 0 без ограничения
+	MaxConns int
+	Handler  Handler
+	// ErrorLog ошибки соединений, может быть nil
+	ErrorLog func(err error)
+}
+
+// ListenAndServe принимает соединения до ошибки листенера.
+func (s *Server) ListenAndServe() error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+func (s *Server) Serve(ln net.Listener) error {
+	defer ln.Close()
+	var sessions chan struct{}
+	if s.MaxConns > 0 {
+		sessions = make(chan struct{}, s.MaxConns)
+	}
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		if sessions != nil {
+			select {
+			case sessions <- struct{}{}:
+			default:
+				conn.SetDeadline(time.Now().Add(time.Second))
+				fmt.Fprintf(conn, "421 %s too many connections\r\n", s.Domain)
+				conn.Close()
+				continue
+			}
+		}
+		go func() {
+			if sessions != nil {
+				defer func() { <-sessions }()
+			}
+			if err := s.serve(conn); err != nil && s.ErrorLog != nil {
+				s.ErrorLog(err)
+			}
+		}()
+	}
+}
+
+// session состояние одной транзакции письма.
+type session struct {
+	from string
+	to   []string
+	mail bool
+}
+
+func (s *Server) serve(conn net.Conn) error {
+	defer conn.Close()
+	// буфер размером в строку, команда длиннее не копится в памяти
+	br := bufio.NewReaderSize(conn, maxLine)
+	tp := &textproto.Conn{Reader: *textproto.NewReader(br), Writer: *textproto.NewWriter(bufio.NewWriter(conn))}
+
+	deadline := func() {
+		if s.Timeout > 0 {
+			conn.SetDeadline(time.Now().Add(s.Timeout))
+		}
+	}
+	deadline()
+	if err := tp.PrintfLine("220 %s ESMTP ready", s.Domain); err != nil {
+		return err
+	}
+
+	var sess session
+	for {
+		deadline()
+		line, err := readCommand(br)
+		if errors.Is(err, errLineTooLong) {
+			if err := tp.PrintfLine("500 line too long"); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		verb = strings.ToUpper(verb)
+
+		var reply string
+		switch verb {
+		case "HELO":
+			reply = "250 " + s.Domain
+		case "EHLO":
+			err = tp.PrintfLine("250-%s\r\n250-SIZE %d\r\n250 8BITMIME", s.Domain, s.MaxSize)
+		case "MAIL":
+			from, ok := path(arg, "FROM:")
+			if !ok {
+				reply = "501 syntax: MAIL FROM:<address>"
+				break
+			}
+			sess = session{from: from, mail: true}
+			reply = "250 ok"
+		case "RCPT":
+			reply = s.rcpt(&sess, arg)
+		case "DATA":
+			if len(sess.to) == 0 {
+				reply = "503 need RCPT first"
+				break
+			}
+			if err = tp.PrintfLine("354 end data with <CR><LF>.<CR><LF>"); err != nil {
+				return err
+			}
+			reply, err = s.data(tp, sess)
+			sess = session{}
+		case "RSET":
+			sess = session{}
+			reply = "250 ok"
+		case "NOOP":
+			reply = "250 ok"
+		case "VRFY":
+			reply = "252 cannot verify"
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return nil
+		default:
+			reply = "502 command not implemented"
+		}
+		if err != nil {
+			return err
+		}
+		if reply != "" {
+			if err := tp.PrintfLine("%s", reply); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readCommand строка команды без CRLF. Строка длиннее maxLine дочитывается
+// и отбрасывается по частям, тогда errLineTooLong.
+func readCommand(br *bufio.Reader) (string, error) {
+	line, err := br.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		for errors.Is(err, bufio.ErrBufferFull) {
+			_, err = br.ReadSlice('\n')
+		}
+		if err != nil {
+			return "", err
+		}
+		return "", errLineTooLong
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+func (s *Server) rcpt(sess *session, arg string) string {
+	if !sess.mail {
+		return "503 need MAIL first"
+	}
+	to, ok := path(arg, "TO:")
+	if !ok || to == "" {
+		return "501 syntax: RCPT TO:<address>"
+	}
+	if len(sess.to) >= maxRecipients {
+		return "452 too many recipients"
+	}
+	if err := s.Handler.Recipient(to); err != nil {
+		if errors.Is(err, ErrUnknownRecipient) {
+			return "550 no such user"
+		}
+		return "451 try again later"
+	}
+	sess.to = append(sess.to, to)
+	return "250 ok"
+}
+
+// data читает тело письма до точки, лишнее сверх MaxSize дочитывается и отбрасывается.
+func (s *Server) data(tp *textproto.Conn, sess session) (string, error) {
+	r := tp.DotReader()
+	body, err := io.ReadAll(io.LimitReader(r, s.MaxSize+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(body)) > s.MaxSize {
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return "", err
+		}
+		return "552 message exceeds fixed maximum message size", nil
+	}
+	if err := s.Handler.Deliver(sess.from, sess.to, body); err != nil {
+		if s.ErrorLog != nil {
+			s.ErrorLog(fmt.Errorf("deliver: %w", err))
+		}
+		return "451 try again later", nil
+	}
+	return "250 ok", nil
+}
+
+// path адрес из "FROM:<addr> SIZE=..." без угловых скобок.
+func path(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	arg = strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(arg, "<") {
+		return "", false
+	}
+	end := strings.IndexByte(arg, '>')
+	if end < 0 {
+		return "", false
+	}
+	return arg[1:end], true
+}
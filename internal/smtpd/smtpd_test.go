@@ -0,0 +1,143 @@
+package smtpd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testHandler принимает только known@ и запоминает письма.
+type testHandler struct {
+	mu   sync.Mutex
+	mail []string
+}
+
+func (h *testHandler) Recipient(addr string) error {
+	if !strings.HasPrefix(addr, "known@") {
+		return ErrUnknownRecipient
+	}
+	return nil
+}
+
+func (h *testHandler) Deliver(from string, to []string, data []byte) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.mail = append(h.mail, fmt.Sprintf("%s>%s:%s", from, strings.Join(to, ","), data))
+	return nil
+}
+
+func testServer(t *testing.T, maxConns int) (string, *testHandler) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &testHandler{}
+	srv := &Server{Domain: "test.local", MaxSize: 64, Timeout: 5 * time.Second, MaxConns: maxConns, Handler: h}
+	go srv.Serve(ln)
+	t.Cleanup(func() { ln.Close() })
+	return ln.Addr().String(), h
+}
+
+// client соединение с прочитанным приветствием.
+func client(t *testing.T, addr string) *textproto.Conn {
+	t.Helper()
+	c, err := textproto.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if _, _, err := c.ReadResponse(220); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// cmd отправляет команду и проверяет код ответа.
+func cmd(t *testing.T, c *textproto.Conn, code int, line string) {
+	t.Helper()
+	if err := c.PrintfLine("%s", line); err != nil {
+		t.Fatal(err)
+	}
+	if _, msg, err := c.ReadResponse(code); err != nil {
+		t.Fatalf("%.40s: %v %s", line, err, msg)
+	}
+}
+
+func TestSession(t *testing.T) {
+	addr, h := testServer(t, 0)
+	c := client(t, addr)
+
+	cmd(t, c, 250, "EHLO client")
+	cmd(t, c, 503, "RCPT TO:<known@test.local>")
+	cmd(t, c, 501, "MAIL FROM:me@example.com")
+	cmd(t, c, 250, "MAIL FROM:<me@example.com> SIZE=10")
+	cmd(t, c, 550, "RCPT TO:<other@test.local>")
+	cmd(t, c, 250, "rcpt to:<known@test.local>")
+	cmd(t, c, 354, "DATA")
+	cmd(t, c, 250, "Subject: hi\r\n\r\n..dot\r\n.")
+	cmd(t, c, 503, "DATA")
+
+	cmd(t, c, 250, "MAIL FROM:<me@example.com>")
+	cmd(t, c, 250, "RCPT TO:<known@test.local>")
+	cmd(t, c, 354, "DATA")
+	cmd(t, c, 552, strings.Repeat("x", 100)+"\r\n.")
+	cmd(t, c, 221, "QUIT")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.mail) != 1 || h.mail[0] != "me@example.com>known@test.local:Subject: hi\n\n.dot\n" {
+		t.Errorf("delivered %q", h.mail)
+	}
+}
+
+func TestLongLine(t *testing.T) {
+	addr, _ := testServer(t, 0)
+	c := client(t, addr)
+
+	cmd(t, c, 500, "NOOP "+strings.Repeat("x", 10*maxLine))
+	// после длинной строки сессия продолжается
+	cmd(t, c, 250, "NOOP "+strings.Repeat("x", maxLine-7))
+	cmd(t, c, 500, "NOOP "+strings.Repeat("x", maxLine-6))
+	cmd(t, c, 250, "NOOP")
+}
+
+func TestMaxConns(t *testing.T) {
+	addr, _ := testServer(t, 1)
+	first := client(t, addr)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "421 ") {
+		t.Fatalf("second connection got %q, %v", line, err)
+	}
+
+	// после закрытия первой сессии место освобождается
+	cmd(t, first, 221, "QUIT")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c, err := textproto.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, _, _ := c.ReadResponse(0)
+		c.Close()
+		if code == 220 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no free session after QUIT, got %d", code)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,189 @@
+package usecase
+
+import (
+    "context"
+    "crypto/md5"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "strings"
+    "time"
+
+    "rss/internal/entity"
+
+    "golang.org/x/crypto/bcrypt"
+)
+
+const minApiPassword = 8
+
+// SetApiPassword задает логин и пароль, по которым входят сторонние клиенты.
+// Fever передает только md5(login:password), поэтому ключ Fever хранится отдельно.
+// Смена пароля отзывает все токены клиентов и сессии веб интерфейса.
+func (uc *UseCase) SetApiPassword(ctx context.Context, personPk string, login string, password string) error {
+    if login == "" || len(password) < minApiPassword {
+        return ErrApiPassword
+    }
+    hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+    if err != nil {
+        return err
+    }
+    return uc.repo.SetApiPassword(ctx, personPk, login, string(hash), feverKey(login, password))
+}
+
+// Login проверяет логин и пароль и выдает новый токен стороннего клиента.
+// В базе хранится только хэш токена.
+func (uc *UseCase) Login(ctx context.Context, login string, password string) (string, error) {
+    personPk, err := uc.checkPassword(ctx, login, password)
+    if err != nil {
+        return "", err
+    }
+    token, err := randomToken()
+    if err != nil {
+        return "", err
+    }
+    if err := uc.repo.CreateToken(ctx, personPk, tokenHash(token)); err != nil {
+        return "", err
+    }
+    return token, nil
+}
+
+// StartSession проверяет логин и пароль и открывает сессию веб интерфейса на ttl.
+// Возвращает токен для cookie, в базе только его хэш.
+func (uc *UseCase) StartSession(ctx context.Context, login string, password string, ttl time.Duration) (string, entity.Session, error) {
+    personPk, err := uc.checkPassword(ctx, login, password)
+    if err != nil {
+        return "", entity.Session{}, err
+    }
+    token, err := randomToken()
+    if err != nil {
+        return "", entity.Session{}, err
+    }
+    csrf, err := randomToken()
+    if err != nil {
+        return "", entity.Session{}, err
+    }
+    s := entity.Session{
+        Account: entity.Account{PersonPk: personPk, Login: login},
+        Csrf:    csrf,
+        Expires: time.Now().Add(ttl),
+    }
+    if err := uc.repo.CreateSession(ctx, tokenHash(token), s); err != nil {
+        return "", s, err
+    }
+    return token, s, nil
+}
+
+// Session возвращает сессию веб интерфейса по токену из cookie.
+func (uc *UseCase) Session(ctx context.Context, token string) (entity.Session, error) {
+    if token == "" {
+        return entity.Session{}, ErrBadCredentials
+    }
+    s, err := uc.repo.Session(ctx, tokenHash(token))
+    if err != nil {
+        return s, errors.Join(ErrBadCredentials, err)
+    }
+    return s, nil
+}
+
+// EndSession закрывает сессию веб интерфейса.
+func (uc *UseCase) EndSession(ctx context.Context, token string) error {
+    return uc.repo.DeleteSession(ctx, tokenHash(token))
+}
+
+// checkPassword возвращает пользователя, если пароль подходит.
+func (uc *UseCase) checkPassword(ctx context.Context, login string, password string) (string, error) {
+    personPk, hash, err := uc.repo.Credentials(ctx, login)
+    if err != nil {
+        return "", ErrBadCredentials
+    }
+    if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+        return "", ErrBadCredentials
+    }
+    return personPk, nil
+}
+
+func randomToken() (string, error) {
+    buf := make([]byte, 20)
+    if _, err := rand.Read(buf); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(buf), nil
+}
+
+// Authenticate возвращает пользователя по токену клиента.
+func (uc *UseCase) Authenticate(ctx context.Context, token string) (entity.Account, error) {
+    if token == "" {
+        return entity.Account{}, ErrBadCredentials
+    }
+    account, err := uc.repo.AccountByToken(ctx, tokenHash(token))
+    if err != nil {
+        return account, errors.Join(ErrBadCredentials, err)
+    }
+    return account, nil
+}
+
+// FeverAuthenticate возвращает пользователя по api_key Fever.
+func (uc *UseCase) FeverAuthenticate(ctx context.Context, apiKey string) (entity.Account, error) {
+    if apiKey == "" {
+        return entity.Account{}, ErrBadCredentials
+    }
+    account, err := uc.repo.AccountByFeverKey(ctx, strings.ToLower(apiKey))
+    if err != nil {
+        return account, errors.Join(ErrBadCredentials, err)
+    }
+    return account, nil
+}
+
+func feverKey(login string, password string) string {
+    sum := md5.Sum([]byte(login + ":" + password))
+    return hex.EncodeToString(sum[:])
+}
+
+func tokenHash(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
+
+// Subscriptions возвращает каналы подписок пользователя.
+func (uc *UseCase) Subscriptions(ctx context.Context, personPk string) ([]entity.Subscription, error) {
+    return uc.repo.Subscriptions(ctx, personPk)
+}
+
+// StreamIds возвращает pk статей потока.
+func (uc *UseCase) StreamIds(ctx context.Context, personPk string, f entity.StreamFilter) ([]int, error) {
+    return uc.repo.StreamIds(ctx, personPk, f)
+}
+
+// Stream возвращает статьи потока с прочитанным и избранным.
+// В отличие от Article дата просмотра не меняется, клиенты отмечают прочитанное сами.
+func (uc *UseCase) Stream(ctx context.Context, personPk string, f entity.StreamFilter) ([]entity.StreamItem, error) {
+    return uc.repo.Stream(ctx, personPk, f)
+}
+
+// StreamCount возвращает количество статей потока.
+func (uc *UseCase) StreamCount(ctx context.Context, personPk string, f entity.StreamFilter) (int, error) {
+    return uc.repo.StreamCount(ctx, personPk, f)
+}
+
+// UnreadCounts возвращает количество непрочитанных по каналам.
+func (uc *UseCase) UnreadCounts(ctx context.Context, personPk string) ([]entity.UnreadCount, error) {
+    return uc.repo.UnreadCounts(ctx, personPk)
+}
+
+// SetState отмечает статьи прочитанными и избранными, nil оставляет как есть.
+func (uc *UseCase) SetState(ctx context.Context, personPk string, pks []int, read *bool, starred *bool) error {
+    if len(pks) == 0 || (read == nil && starred == nil) {
+        return nil
+    }
+    return uc.repo.SetState(ctx, personPk, pks, read, starred)
+}
+
+// MarkAllRead отмечает прочитанным канал или папку, с нулевыми все подписки,
+// до before, нулевое значит до текущего момента.
+func (uc *UseCase) MarkAllRead(ctx context.Context, personPk string, feedPk int, folderPk int, before time.Time) error {
+    if before.IsZero() || before.After(time.Now()) {
+        before = time.Now()
+    }
+    return uc.repo.MarkAllRead(ctx, personPk, feedPk, folderPk, before)
+}
@@ -0,0 +1,277 @@
+package usecase
+
+import (
+    "context"
+    "fmt"
+    "sort"
+    "strings"
+    "unicode/utf8"
+
+    "rss/internal/anchor"
+    "rss/internal/entity"
+)
+
+const (
+    maxHighlightLen = 4096
+    maxNoteLen      = 10_000
+)
+
+// CreateHighlight привязывает цитату к тексту статьи и сохраняет выделение.
+// Start подсказка, где искать цитату, -1 без подсказки.
+func (uc *UseCase) CreateHighlight(ctx context.Context, personPk string, articlePk int, q anchor.Quote, start int) (entity.Highlight, error) {
+    h, err := uc.anchorHighlight(ctx, articlePk, q, start)
+    if err != nil {
+        return h, err
+    }
+    return uc.repo.CreateHighlight(ctx, personPk, h)
+}
+
+// UpdateHighlight перепривязывает выделение к новой цитате в той же статье.
+func (uc *UseCase) UpdateHighlight(ctx context.Context, personPk string, pk int, q anchor.Quote, start int) error {
+    old, err := uc.repo.Highlight(ctx, personPk, pk)
+    if err != nil {
+        return err
+    }
+    h, err := uc.anchorHighlight(ctx, old.ArticlePk, q, start)
+    if err != nil {
+        return err
+    }
+    return uc.repo.UpdateHighlight(ctx, personPk, pk, h)
+}
+
+// Highlight возвращает выделение с заметками.
+func (uc *UseCase) Highlight(ctx context.Context, personPk string, pk int) (entity.Highlight, error) {
+    h, err := uc.repo.Highlight(ctx, personPk, pk)
+    if err != nil {
+        return h, err
+    }
+    moved, err := uc.reanchor(ctx, personPk, h.ArticlePk)
+    if err != nil {
+        return h, err
+    }
+    if moved {
+        if h, err = uc.repo.Highlight(ctx, personPk, pk); err != nil {
+            return h, err
+        }
+    }
+    highlights := []entity.Highlight{h}
+    if err := uc.attachNotes(ctx, personPk, highlights); err != nil {
+        return h, err
+    }
+    return highlights[0], nil
+}
+
+// Highlights возвращает выделения пользователя с заметками,
+// выделения измененных статей сначала перепривязываются.
+func (uc *UseCase) Highlights(ctx context.Context, personPk string, f entity.HighlightFilter) ([]entity.Highlight, error) {
+    if f.ArticlePk != 0 {
+        if err := uc.articleExists(ctx, f.ArticlePk); err != nil {
+            return nil, err
+        }
+    }
+    if _, err := uc.reanchor(ctx, personPk, f.ArticlePk); err != nil {
+        return nil, err
+    }
+    highlights, err := uc.repo.Highlights(ctx, personPk, f)
+    if err != nil {
+        return nil, err
+    }
+    if err := uc.attachNotes(ctx, personPk, highlights); err != nil {
+        return nil, err
+    }
+    return highlights, nil
+}
+
+// DeleteHighlight удаляет выделение вместе с его заметками.
+func (uc *UseCase) DeleteHighlight(ctx context.Context, personPk string, pk int) error {
+    return uc.repo.DeleteHighlight(ctx, personPk, pk)
+}
+
+// CreateNote сохраняет заметку к статье или к выделению в ней.
+func (uc *UseCase) CreateNote(ctx context.Context, personPk string, n entity.Note) (entity.Note, error) {
+    body, err := validateNote(n.Body)
+    if err != nil {
+        return n, err
+    }
+    n.Body = body
+    if err := uc.articleExists(ctx, n.ArticlePk); err != nil {
+        return n, err
+    }
+    return uc.repo.CreateNote(ctx, personPk, n)
+}
+
+// Notes возвращает заметки пользователя к статье.
+func (uc *UseCase) Notes(ctx context.Context, personPk string, articlePk int) ([]entity.Note, error) {
+    if err := uc.articleExists(ctx, articlePk); err != nil {
+        return nil, err
+    }
+    return uc.repo.Notes(ctx, personPk, []int{articlePk})
+}
+
+// UpdateNote меняет текст заметки.
+func (uc *UseCase) UpdateNote(ctx context.Context, personPk string, pk int, body string) error {
+    body, err := validateNote(body)
+    if err != nil {
+        return err
+    }
+    return uc.repo.UpdateNote(ctx, personPk, pk, body)
+}
+
+// DeleteNote удаляет заметку.
+func (uc *UseCase) DeleteNote(ctx context.Context, personPk string, pk int) error {
+    return uc.repo.DeleteNote(ctx, personPk, pk)
+}
+
+// Annotations возвращает все выделения и заметки пользователя по статьям
+// для экспорта, статьи от последних аннотированных.
+func (uc *UseCase) Annotations(ctx context.Context, personPk string) ([]entity.Annotations, error) {
+    if _, err := uc.reanchor(ctx, personPk, 0); err != nil {
+        return nil, err
+    }
+    highlights, err := uc.repo.Highlights(ctx, personPk, entity.HighlightFilter{})
+    if err != nil {
+        return nil, err
+    }
+    notes, err := uc.repo.Notes(ctx, personPk, nil)
+    if err != nil {
+        return nil, err
+    }
+
+    index := make(map[int]int)
+    var entities []entity.Annotations
+    group := func(ref *entity.ArticleRef) *entity.Annotations {
+        i, ok := index[ref.Pk]
+        if !ok {
+            i = len(entities)
+            index[ref.Pk] = i
+            entities = append(entities, entity.Annotations{Article: *ref, Highlights: []entity.Highlight{}, Notes: []entity.Note{}})
+        }
+        return &entities[i]
+    }
+    byHighlight := make(map[int][]entity.Note)
+    for _, n := range notes {
+        if n.HighlightPk != nil {
+            n.Article = nil
+            byHighlight[*n.HighlightPk] = append(byHighlight[*n.HighlightPk], n)
+        }
+    }
+    // выделения от новых к старым задают порядок статей
+    for _, h := range highlights {
+        a := group(h.Article)
+        h.Article = nil
+        h.Notes = byHighlight[h.Pk]
+        a.Highlights = append(a.Highlights, h)
+    }
+    for _, n := range notes {
+        if n.HighlightPk == nil {
+            a := group(n.Article)
+            n.Article = nil
+            a.Notes = append(a.Notes, n)
+        }
+    }
+    for _, a := range entities {
+        // внутри статьи выделения по порядку текста
+        sort.SliceStable(a.Highlights, func(i, j int) bool { return a.Highlights[i].Start < a.Highlights[j].Start })
+    }
+    if entities == nil {
+        entities = []entity.Annotations{}
+    }
+    return entities, nil
+}
+
+// anchorHighlight ищет цитату в текущем тексте статьи, контекст берется из текста,
+// присланный prefix и suffix только выбирают среди нескольких вхождений.
+func (uc *UseCase) anchorHighlight(ctx context.Context, articlePk int, q anchor.Quote, start int) (entity.Highlight, error) {
+    h := entity.Highlight{ArticlePk: articlePk}
+    exact := anchor.Normalize(q.Exact)
+    if exact == "" || utf8.RuneCountInString(exact) > maxHighlightLen {
+        return h, fmt.Errorf("%w: exact required, up to %d characters", ErrHighlight, maxHighlightLen)
+    }
+    content, hash, err := uc.repo.ArticleContent(ctx, articlePk)
+    if err != nil {
+        return h, err
+    }
+    text := anchor.Text(content)
+    begin, end, ok := anchor.Find(text, q, start)
+    if !ok {
+        return h, fmt.Errorf("%w: quote not found in article text", ErrHighlight)
+    }
+    h.Exact = exact
+    h.Start, h.End = begin, end
+    h.Prefix, h.Suffix = anchor.Context(text, begin, end)
+    h.ContentHash = hash
+    return h, nil
+}
+
+// reanchor перепривязывает выделения статей, изменившихся после привязки,
+// по цитате с подсказкой на старое место. Не найденные отмечаются orphaned
+// и проверяются снова после следующей правки статьи.
+func (uc *UseCase) reanchor(ctx context.Context, personPk string, articlePk int) (bool, error) {
+    stale, err := uc.repo.StaleHighlights(ctx, personPk, articlePk)
+    if err != nil || len(stale) == 0 {
+        return false, err
+    }
+    texts := make(map[int]string)
+    highlights := make([]entity.Highlight, 0, len(stale))
+    for _, s := range stale {
+        text, ok := texts[s.ArticlePk]
+        if !ok {
+            text = anchor.Text(s.Content)
+            texts[s.ArticlePk] = text
+        }
+        h := s.Highlight
+        h.ContentHash = s.ArticleHash
+        start, end, found := anchor.Find(text, anchor.Quote{Exact: h.Exact, Prefix: h.Prefix, Suffix: h.Suffix}, h.Start)
+        if found {
+            h.Start, h.End = start, end
+            h.Prefix, h.Suffix = anchor.Context(text, start, end)
+        }
+        h.Orphaned = !found
+        highlights = append(highlights, h)
+    }
+    return true, uc.repo.ReanchorHighlights(ctx, highlights)
+}
+
+// attachNotes добавляет к выделениям их заметки.
+func (uc *UseCase) attachNotes(ctx context.Context, personPk string, highlights []entity.Highlight) error {
+    if len(highlights) == 0 {
+        return nil
+    }
+    seen := make(map[int]bool)
+    var articlePks []int
+    for _, h := range highlights {
+        if !seen[h.ArticlePk] {
+            seen[h.ArticlePk] = true
+            articlePks = append(articlePks, h.ArticlePk)
+        }
+    }
+    notes, err := uc.repo.Notes(ctx, personPk, articlePks)
+    if err != nil {
+        return err
+    }
+    byHighlight := make(map[int][]entity.Note)
+    for _, n := range notes {
+        if n.HighlightPk != nil {
+            n.Article = nil
+            byHighlight[*n.HighlightPk] = append(byHighlight[*n.HighlightPk], n)
+        }
+    }
+    for i := range highlights {
+        highlights[i].Notes = byHighlight[highlights[i].Pk]
+    }
+    return nil
+}
+
+// articleExists ErrNoArticle, если статьи нет.
+func (uc *UseCase) articleExists(ctx context.Context, articlePk int) error {
+    _, _, err := uc.repo.ArticleContent(ctx, articlePk)
+    return err
+}
+
+func validateNote(body string) (string, error) {
+    body = strings.TrimSpace(body)
+    if body == "" || utf8.RuneCountInString(body) > maxNoteLen {
+        return body, fmt.Errorf("%w: body required, up to %d characters", ErrNote, maxNoteLen)
+    }
+    return body, nil
+}
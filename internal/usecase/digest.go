@@ -0,0 +1,45 @@
+package usecase
+
+import (
+    "context"
+    "fmt"
+    "net/mail"
+    "strings"
+    "time"
+
+    "rss/internal/digest"
+    "rss/internal/entity"
+)
+
+// SetDigest включает или меняет рассылку непрочитанных, следующее письмо по новому расписанию.
+func (uc *UseCase) SetDigest(ctx context.Context, personPk string, d entity.Digest) (entity.Digest, error) {
+    if uc.mail.SmtpHost == "" {
+        return d, fmt.Errorf("%w: email is disabled", ErrDigestSettings)
+    }
+    addr, err := mail.ParseAddress(strings.TrimSpace(d.Email))
+    if err != nil {
+        return d, fmt.Errorf("%w: email: %v", ErrDigestSettings, err)
+    }
+    d.Email = addr.Address
+    if d.Timezone == "" {
+        d.Timezone = "UTC"
+    }
+    if err := digest.Validate(d); err != nil {
+        return d, fmt.Errorf("%w: %v", ErrDigestSettings, err)
+    }
+    d.NextSend = digest.Next(d, time.Now())
+    if err := uc.repo.SetDigest(ctx, personPk, d); err != nil {
+        return d, err
+    }
+    return uc.repo.Digest(ctx, personPk)
+}
+
+// Digest возвращает настройки рассылки.
+func (uc *UseCase) Digest(ctx context.Context, personPk string) (entity.Digest, error) {
+    return uc.repo.Digest(ctx, personPk)
+}
+
+// DeleteDigest выключает рассылку.
+func (uc *UseCase) DeleteDigest(ctx context.Context, personPk string) error {
+    return uc.repo.DeleteDigest(ctx, personPk)
+}
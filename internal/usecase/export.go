@@ -0,0 +1,217 @@
+package usecase
+
+import (
+    "context"
+    "crypto/rand"
+    "fmt"
+    "io"
+    "net/http"
+    "sort"
+    "sync"
+    "time"
+
+    "rss/internal/entity"
+    "rss/internal/epub"
+)
+
+// картинки, которые понимают читалки EPUB 3, svg не берем из-за скриптов
+var epubImageTypes = map[string]bool{
+    "image/jpeg": true,
+    "image/png":  true,
+    "image/gif":  true,
+    "image/webp": true,
+}
+
+// ExportEpub собирает книгу из статей подписок и отдает ее в write, пока держит место
+// среди EXPORT_CONCURRENCY книг, иначе ErrExportBusy.
+func (uc *UseCase) ExportEpub(ctx context.Context, personPk string, f entity.ExportFilter, write func(epub.Book) error) error {
+    select {
+    case uc.exports <- struct{}{}:
+        defer func() { <-uc.exports }()
+    default:
+        return ErrExportBusy
+    }
+    book, err := uc.buildEpub(ctx, personPk, f)
+    if err != nil {
+        return err
+    }
+    return write(book)
+}
+
+// buildEpub собирает книгу: главы от старых к новым, при явных Pks в их порядке.
+// Картинки скачиваются и кладутся в книгу,
+// не скачанные за EXPORT_TIMEOUT или сверх лимитов заменяются своим alt.
+func (uc *UseCase) buildEpub(ctx context.Context, personPk string, f entity.ExportFilter) (epub.Book, error) {
+    var book epub.Book
+    if len(f.Pks) == 0 && f.FeedPk == 0 && f.Since.IsZero() && f.Until.IsZero() {
+        return book, fmt.Errorf("%w: articles, feed_pk, since or until required", ErrExport)
+    }
+    if len(f.Pks) > uc.export.MaxArticles {
+        return book, fmt.Errorf("%w: up to %d articles", ErrExport, uc.export.MaxArticles)
+    }
+    if !f.Since.IsZero() && !f.Until.IsZero() && f.Until.Before(f.Since) {
+        return book, fmt.Errorf("%w: until before since", ErrExport)
+    }
+
+    items, err := uc.repo.Stream(ctx, personPk, entity.StreamFilter{
+        Pks: f.Pks, FeedPk: f.FeedPk, Since: f.Since, Until: f.Until, Oldest: true, Limit: uc.export.MaxArticles + 1,
+    })
+    if err != nil {
+        return book, err
+    }
+    if len(items) == 0 {
+        return book, fmt.Errorf("%w: no articles in subscriptions match", ErrExport)
+    }
+    if len(items) > uc.export.MaxArticles {
+        return book, fmt.Errorf("%w: more than %d articles, narrow the selection", ErrExport, uc.export.MaxArticles)
+    }
+    if len(f.Pks) > 0 {
+        order := make(map[int]int, len(f.Pks))
+        for i, pk := range f.Pks {
+            if _, ok := order[pk]; !ok {
+                order[pk] = i
+            }
+        }
+        sort.SliceStable(items, func(i, j int) bool { return order[items[i].Pk] < order[items[j].Pk] })
+    }
+    subs, err := uc.repo.Subscriptions(ctx, personPk)
+    if err != nil {
+        return book, err
+    }
+    feeds := make(map[int]string, len(subs))
+    for _, s := range subs {
+        feeds[s.FeedPk] = s.Title
+    }
+
+    fragments := make([]*epub.Fragment, len(items))
+    var urls []string
+    seen := make(map[string]bool)
+    for i, it := range items {
+        if fragments[i], err = epub.Parse(it.Content, it.SourceUrl); err != nil {
+            return book, err
+        }
+        for _, u := range fragments[i].Images() {
+            if !seen[u] && len(urls) < uc.export.MaxImages {
+                seen[u] = true
+                urls = append(urls, u)
+            }
+        }
+    }
+    // в книге только скачанные
+    names := make(map[string]string)
+    for i, img := range uc.fetchImages(ctx, urls) {
+        if img.Data != nil {
+            names[urls[i]] = img.Name
+            book.Images = append(book.Images, img)
+        }
+    }
+
+    for i, it := range items {
+        title := it.Title
+        if title == "" {
+            title = it.SourceUrl
+        }
+        book.Chapters = append(book.Chapters, epub.Chapter{
+            Title:     title,
+            Feed:      feeds[it.FeedPk],
+            Url:       it.SourceUrl,
+            Published: it.Published,
+            Body:      fragments[i].XHTML(names),
+        })
+    }
+
+    book.Title = f.Title
+    if book.Title == "" && f.FeedPk != 0 {
+        book.Title = feeds[f.FeedPk]
+    }
+    if book.Title == "" {
+        book.Title = "Articles " + items[0].Published.Format("02.01.2006") + " – " + items[len(items)-1].Published.Format("02.01.2006")
+    }
+    book.Language = f.Language
+    if book.Language == "" {
+        book.Language = "en"
+    }
+    book.Modified = time.Now()
+    if book.Identifier, err = newUrnUuid(); err != nil {
+        return book, err
+    }
+    return book, nil
+}
+
+// fetchImages качает картинки параллельно в пределах лимитов,
+// i-ая картинка книги соответствует urls[i], у не скачанных Data nil.
+func (uc *UseCase) fetchImages(ctx context.Context, urls []string) []epub.Image {
+    images := make([]epub.Image, len(urls))
+    if len(urls) == 0 {
+        return images
+    }
+    ctx, cancel := context.WithTimeout(ctx, uc.export.Timeout)
+    defer cancel()
+
+    var (
+        mu    sync.Mutex
+        total int64
+        wg    sync.WaitGroup
+    )
+    sem := make(chan struct{}, max(uc.export.ImageWorkers, 1))
+    for i, u := range urls {
+        wg.Add(1)
+        sem <- struct{}{}
+        go func(i int, u string) {
+            defer wg.Done()
+            defer func() { <-sem }()
+            data, mediaType, err := uc.fetchImage(ctx, u)
+            if err != nil {
+                return
+            }
+            mu.Lock()
+            defer mu.Unlock()
+            if total+int64(len(data)) > uc.export.ImagesMaxSize {
+                return
+            }
+            total += int64(len(data))
+            images[i] = epub.Image{Name: epub.ImageName(i, mediaType), MediaType: mediaType, Data: data}
+        }(i, u)
+    }
+    wg.Wait()
+    return images
+}
+
+// fetchImage тип картинки определяется по содержимому, заголовкам сервера не верим.
+func (uc *UseCase) fetchImage(ctx context.Context, url string) ([]byte, string, error) {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+    if err != nil {
+        return nil, "", err
+    }
+    resp, err := uc.client.Do(req)
+    if err != nil {
+        return nil, "", err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return nil, "", fmt.Errorf("status %d", resp.StatusCode)
+    }
+    data, err := io.ReadAll(io.LimitReader(resp.Body, uc.export.ImageMaxSize+1))
+    if err != nil {
+        return nil, "", err
+    }
+    if int64(len(data)) > uc.export.ImageMaxSize {
+        return nil, "", fmt.Errorf("image larger than %d", uc.export.ImageMaxSize)
+    }
+    mediaType := http.DetectContentType(data)
+    if !epubImageTypes[mediaType] {
+        return nil, "", fmt.Errorf("unsupported image type %s", mediaType)
+    }
+    return data, mediaType, nil
+}
+
+// newUrnUuid случайный идентификатор книги urn:uuid по RFC 4122 v4.
+func newUrnUuid() (string, error) {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    b[6] = b[6]&0x0f | 0x40
+    b[8] = b[8]&0x3f | 0x80
+    return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
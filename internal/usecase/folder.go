@@ -0,0 +1,53 @@
+package usecase
+
+import (
+    "context"
+    "strings"
+    "unicode/utf8"
+
+    "rss/internal/entity"
+)
+
+const maxFolderTitle = 128
+
+// CreateFolder создает папку подписок, с parentPk вложенную.
+func (uc *UseCase) CreateFolder(ctx context.Context, personPk string, parentPk int, title string) (entity.Folder, error) {
+    title, err := folderTitle(title)
+    if err != nil {
+        return entity.Folder{}, err
+    }
+    return uc.repo.CreateFolder(ctx, personPk, parentPk, title)
+}
+
+// Folders возвращает папки пользователя с непрочитанными.
+func (uc *UseCase) Folders(ctx context.Context, personPk string) ([]entity.Folder, error) {
+    return uc.repo.Folders(ctx, personPk)
+}
+
+// UpdateFolder переименовывает и переносит папку.
+func (uc *UseCase) UpdateFolder(ctx context.Context, personPk string, pk int, parentPk int, title string) error {
+    title, err := folderTitle(title)
+    if err != nil {
+        return err
+    }
+    return uc.repo.UpdateFolder(ctx, personPk, pk, parentPk, title)
+}
+
+// DeleteFolder удаляет папку с подпапками, подписки остаются.
+func (uc *UseCase) DeleteFolder(ctx context.Context, personPk string, pk int) error {
+    return uc.repo.DeleteFolder(ctx, personPk, pk)
+}
+
+// SetFolder кладет подписку в папку, 0 убирает из папки.
+func (uc *UseCase) SetFolder(ctx context.Context, personPk string, feedPk int, folderPk int) error {
+    return uc.repo.SetFolder(ctx, personPk, feedPk, folderPk)
+}
+
+// folderTitle без слэшей, они разделяют папку и подпапку в ярлыках Google Reader.
+func folderTitle(title string) (string, error) {
+    title = strings.TrimSpace(title)
+    if title == "" || utf8.RuneCountInString(title) > maxFolderTitle || strings.Contains(title, "/") {
+        return "", ErrFolderTitle
+    }
+    return title, nil
+}
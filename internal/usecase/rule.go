@@ -0,0 +1,149 @@
+package usecase
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "unicode/utf8"
+
+    "rss/internal/entity"
+    "rss/internal/rule"
+)
+
+const (
+    maxRuleTitle = 128
+    // последних статей для проверки и ретроактивного применения правила по умолчанию
+    defaultRuleRecent = 200
+    maxRuleRecent     = 10000
+    // размер страницы при выборке последних статей
+    ruleRecentPage = 1000
+)
+
+// CreateRule создает правило, оно применяется к новым статьям подписок.
+func (uc *UseCase) CreateRule(ctx context.Context, personPk string, r entity.Rule) (entity.Rule, error) {
+    r, err := validateRule(r)
+    if err != nil {
+        return r, err
+    }
+    return uc.repo.CreateRule(ctx, personPk, r)
+}
+
+// Rules возвращает правила пользователя.
+func (uc *UseCase) Rules(ctx context.Context, personPk string) ([]entity.Rule, error) {
+    return uc.repo.Rules(ctx, personPk)
+}
+
+// UpdateRule заменяет правило, уже примененные действия остаются.
+func (uc *UseCase) UpdateRule(ctx context.Context, personPk string, pk int, r entity.Rule) error {
+    r, err := validateRule(r)
+    if err != nil {
+        return err
+    }
+    return uc.repo.UpdateRule(ctx, personPk, pk, r)
+}
+
+// DeleteRule удаляет правило.
+func (uc *UseCase) DeleteRule(ctx context.Context, personPk string, pk int) error {
+    return uc.repo.DeleteRule(ctx, personPk, pk)
+}
+
+// TestRule возвращает статьи из последних limit статей подписок, подходящие под условие.
+// Ничего не меняет, действия правила не проверяются.
+func (uc *UseCase) TestRule(ctx context.Context, personPk string, cond entity.RuleCondition, limit int) ([]entity.StreamItem, error) {
+    m, err := rule.Compile(cond)
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrRuleConfig, err)
+    }
+    matched := []entity.StreamItem{}
+    err = uc.recent(ctx, personPk, limit, func(items []entity.StreamItem) {
+        for _, it := range items {
+            if m.Match(&it.Article) {
+                matched = append(matched, it)
+            }
+        }
+    })
+    if err != nil {
+        return nil, err
+    }
+    return matched, nil
+}
+
+// ApplyRule применяет правило к последним limit статьям подписок, возвращает сколько совпало.
+// Уведомления только для новых статей, к старым действие notify не применяется.
+func (uc *UseCase) ApplyRule(ctx context.Context, personPk string, pk int, limit int) (int, error) {
+    r, err := uc.repo.Rule(ctx, personPk, pk)
+    if err != nil {
+        return 0, err
+    }
+    m, err := rule.Compile(r.Condition)
+    if err != nil {
+        return 0, fmt.Errorf("%w: %v", ErrRuleConfig, err)
+    }
+    actions := make([]entity.RuleAction, 0, len(r.Actions))
+    for _, a := range r.Actions {
+        if a.Type != entity.RuleNotify {
+            actions = append(actions, a)
+        }
+    }
+    r.Actions = actions
+    var hits []entity.RuleHit
+    err = uc.recent(ctx, personPk, limit, func(items []entity.StreamItem) {
+        for _, it := range items {
+            if m.Match(&it.Article) {
+                hits = append(hits, entity.RuleHit{Rule: r, Article: articleRef(it.Article)})
+            }
+        }
+    })
+    if err != nil {
+        return 0, err
+    }
+    if len(r.Actions) == 0 {
+        return len(hits), nil
+    }
+    return len(hits), uc.repo.ApplyRules(ctx, hits, nil)
+}
+
+// recent передает в fn страницами последние limit статей подписок
+// вместе со скрытыми и из отложенных подписок.
+func (uc *UseCase) recent(ctx context.Context, personPk string, limit int, fn func([]entity.StreamItem)) error {
+    if limit <= 0 {
+        limit = defaultRuleRecent
+    }
+    if limit > maxRuleRecent {
+        return fmt.Errorf("%w: limit up to %d", ErrRuleConfig, maxRuleRecent)
+    }
+    f := entity.StreamFilter{Hidden: true, Muted: true, ByPk: true}
+    for limit > 0 {
+        f.Limit = min(limit, ruleRecentPage)
+        items, err := uc.repo.Stream(ctx, personPk, f)
+        if err != nil {
+            return err
+        }
+        fn(items)
+        if len(items) < f.Limit {
+            return nil
+        }
+        limit -= len(items)
+        f.BeforePk = items[len(items)-1].Pk
+    }
+    return nil
+}
+
+// validateRule проверяет название, условие и действия.
+func validateRule(r entity.Rule) (entity.Rule, error) {
+    r.Title = strings.TrimSpace(r.Title)
+    if r.Title == "" || utf8.RuneCountInString(r.Title) > maxRuleTitle {
+        return r, fmt.Errorf("%w: title required, up to %d characters", ErrRuleConfig, maxRuleTitle)
+    }
+    if _, err := rule.Compile(r.Condition); err != nil {
+        return r, fmt.Errorf("%w: %v", ErrRuleConfig, err)
+    }
+    if err := rule.ValidateActions(r.Actions); err != nil {
+        return r, fmt.Errorf("%w: %v", ErrRuleConfig, err)
+    }
+    return r, nil
+}
+
+func articleRef(a entity.Article) entity.ArticleRef {
+    return entity.ArticleRef{Pk: a.Pk, Title: a.Title, SourceUrl: a.SourceUrl, FeedPk: a.FeedPk, Published: a.Published}
+}
@@ -0,0 +1,119 @@
+package usecase
+
+import (
+    "context"
+    "fmt"
+    "net/mail"
+    "net/url"
+    "strings"
+    "unicode/utf8"
+
+    "rss/internal/entity"
+)
+
+const (
+    maxSearchTitle      = 128
+    maxSearchQuery      = 512
+    maxSearchFeeds      = 100
+    maxSearchCategories = 50
+    maxSearchWindow     = 3650
+)
+
+// CreateSavedSearch сохраняет поиск по всем каналам, непрочитанными считаются статьи после создания.
+func (uc *UseCase) CreateSavedSearch(ctx context.Context, personPk string, s entity.SavedSearch) (entity.SavedSearch, error) {
+    s, err := uc.validateSavedSearch(s)
+    if err != nil {
+        return s, err
+    }
+    return uc.repo.CreateSavedSearch(ctx, personPk, s)
+}
+
+// SavedSearches возвращает сохраненные поиски с непрочитанными.
+func (uc *UseCase) SavedSearches(ctx context.Context, personPk string) ([]entity.SavedSearch, error) {
+    return uc.repo.SavedSearches(ctx, personPk)
+}
+
+// SavedSearch возвращает сохраненный поиск с непрочитанными.
+func (uc *UseCase) SavedSearch(ctx context.Context, personPk string, pk int) (entity.SavedSearch, error) {
+    return uc.repo.SavedSearch(ctx, personPk, pk)
+}
+
+// UpdateSavedSearch заменяет условия и оповещения, прочитанное не меняется.
+func (uc *UseCase) UpdateSavedSearch(ctx context.Context, personPk string, pk int, s entity.SavedSearch) error {
+    s, err := uc.validateSavedSearch(s)
+    if err != nil {
+        return err
+    }
+    return uc.repo.UpdateSavedSearch(ctx, personPk, pk, s)
+}
+
+// DeleteSavedSearch удаляет сохраненный поиск.
+func (uc *UseCase) DeleteSavedSearch(ctx context.Context, personPk string, pk int) error {
+    return uc.repo.DeleteSavedSearch(ctx, personPk, pk)
+}
+
+// SavedSearchArticles возвращает статьи сохраненного поиска, с unread только непрочитанные.
+func (uc *UseCase) SavedSearchArticles(ctx context.Context, personPk string, pk int, unread bool, limit int, offset int) ([]entity.Article, error) {
+    return uc.repo.SavedSearchArticles(ctx, personPk, pk, unread, limit, offset)
+}
+
+// ViewedSavedSearch отмечает статьи сохраненного поиска прочитанными.
+func (uc *UseCase) ViewedSavedSearch(ctx context.Context, personPk string, pk int) error {
+    return uc.repo.ViewedSavedSearch(ctx, personPk, pk)
+}
+
+// ConfirmAlertEmail включает письма на alert_email по коду, который crawly прислал на этот адрес.
+func (uc *UseCase) ConfirmAlertEmail(ctx context.Context, personPk string, pk int, code string) error {
+    return uc.repo.ConfirmAlertEmail(ctx, personPk, pk, tokenHash(strings.TrimSpace(code)))
+}
+
+// validateSavedSearch проверяет и нормализует поиск, без условий он совпал бы со всеми статьями.
+func (uc *UseCase) validateSavedSearch(s entity.SavedSearch) (entity.SavedSearch, error) {
+    s.Title = strings.TrimSpace(s.Title)
+    if s.Title == "" || utf8.RuneCountInString(s.Title) > maxSearchTitle {
+        return s, fmt.Errorf("%w: title required, up to %d characters", ErrSavedSearch, maxSearchTitle)
+    }
+    s.Query = strings.TrimSpace(s.Query)
+    if utf8.RuneCountInString(s.Query) > maxSearchQuery {
+        return s, fmt.Errorf("%w: query longer than %d", ErrSavedSearch, maxSearchQuery)
+    }
+    if len(s.Feeds) > maxSearchFeeds || len(s.Categories) > maxSearchCategories {
+        return s, fmt.Errorf("%w: up to %d feeds and %d categories", ErrSavedSearch, maxSearchFeeds, maxSearchCategories)
+    }
+    if s.Feeds == nil {
+        s.Feeds = []int{}
+    }
+    categories := make([]string, 0, len(s.Categories))
+    for _, c := range s.Categories {
+        if c = strings.ToLower(strings.TrimSpace(c)); c != "" {
+            categories = append(categories, c)
+        }
+    }
+    s.Categories = categories
+    if s.Query == "" && len(s.Feeds) == 0 && len(s.Categories) == 0 {
+        return s, fmt.Errorf("%w: query, feeds or categories required", ErrSavedSearch)
+    }
+    if s.WindowDays < 0 || s.WindowDays > maxSearchWindow {
+        return s, fmt.Errorf("%w: window_days out of range 0..%d", ErrSavedSearch, maxSearchWindow)
+    }
+
+    s.AlertUrl = strings.TrimSpace(s.AlertUrl)
+    if s.AlertUrl != "" {
+        u, err := url.Parse(s.AlertUrl)
+        if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+            return s, fmt.Errorf("%w: alert_url must be http or https url", ErrSavedSearch)
+        }
+    }
+    s.AlertEmail = strings.TrimSpace(s.AlertEmail)
+    if s.AlertEmail != "" {
+        if uc.mail.SmtpHost == "" {
+            return s, fmt.Errorf("%w: email alerts are disabled", ErrSavedSearch)
+        }
+        addr, err := mail.ParseAddress(s.AlertEmail)
+        if err != nil {
+            return s, fmt.Errorf("%w: alert_email: %v", ErrSavedSearch, err)
+        }
+        s.AlertEmail = addr.Address
+    }
+    return s, nil
+}
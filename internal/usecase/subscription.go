@@ -0,0 +1,52 @@
+package usecase
+
+import (
+    "context"
+    "fmt"
+    "strconv"
+    "time"
+    "unicode/utf8"
+
+    "rss/internal/entity"
+)
+
+const (
+    // дней истории при подписке по умолчанию
+    defaultHistory       = "30"
+    maxHistoryDays       = 3650
+    maxSubscriptionTitle = 256
+    maxPriority          = 1000
+)
+
+// UpdateSubscription меняет настройки подписки, History заново показывает историю канала.
+func (uc *UseCase) UpdateSubscription(ctx context.Context, personPk string, feedPk int, p entity.SubscriptionPatch) error {
+    if p.Title != nil && utf8.RuneCountInString(*p.Title) > maxSubscriptionTitle {
+        return fmt.Errorf("%w: title longer than %d", ErrSubscriptionSettings, maxSubscriptionTitle)
+    }
+    if p.Priority != nil && (*p.Priority < -maxPriority || *p.Priority > maxPriority) {
+        return fmt.Errorf("%w: priority out of range ±%d", ErrSubscriptionSettings, maxPriority)
+    }
+    if p.History != nil {
+        viewed, err := historyViewed(*p.History)
+        if err != nil {
+            return err
+        }
+        p.Viewed = &viewed
+    }
+    return uc.repo.UpdateSubscription(ctx, personPk, feedPk, p)
+}
+
+// historyViewed дата просмотра, до которой статьи канала считаются прочитанными.
+func historyViewed(history string) (time.Time, error) {
+    switch history {
+    case "none":
+        return time.Now(), nil
+    case "all":
+        return time.Unix(0, 0), nil
+    }
+    days, err := strconv.Atoi(history)
+    if err != nil || days < 0 || days > maxHistoryDays {
+        return time.Time{}, fmt.Errorf("%w: history must be none, all or days up to %d", ErrSubscriptionSettings, maxHistoryDays)
+    }
+    return time.Now().AddDate(0, 0, -days), nil
+}
@@ -2,27 +2,160 @@ package usecase
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
     
+	"rss/configs"
+	"rss/internal/blob"
+	"rss/internal/diff"
 	"rss/internal/entity"
+	"rss/internal/processor"
+	"rss/internal/safehttp"
 )
 
+var (
+    // ErrNothingToCompare у статьи меньше двух версий.
+    ErrNothingToCompare = errors.New("article has only one revision")
+    // ErrRefreshTooSoon канал обновлялся меньше Cooldown назад.
+    ErrRefreshTooSoon = errors.New("feed was refreshed recently")
+    // ErrRefreshLimit пользователь исчерпал лимит обновлений в час.
+    ErrRefreshLimit = errors.New("refresh limit per hour exceeded")
+    // ErrSourceConfig неизвестный вид источника или не хватает разметки.
+    ErrSourceConfig = errors.New("invalid source config")
+    // ErrProcessorConfig неизвестный процессор или неверные параметры.
+    ErrProcessorConfig = errors.New("invalid processor config")
+    // ErrBadCredentials неверный логин или пароль стороннего клиента.
+    ErrBadCredentials = errors.New("bad login or password")
+    // ErrApiPassword слишком короткий пароль или пустой логин.
+    ErrApiPassword = errors.New("login required and password must be at least 8 characters")
+    // ErrFolderTitle пустое, длинное или со слэшем название папки.
+    ErrFolderTitle = errors.New("folder title required, up to 128 characters without slash")
+    // ErrSubscriptionSettings неверные настройки подписки.
+    ErrSubscriptionSettings = errors.New("invalid subscription settings")
+    // ErrRuleConfig неверное условие, действия или название правила.
+    ErrRuleConfig = errors.New("invalid rule")
+    // ErrSavedSearch неверные условия или оповещения сохраненного поиска.
+    ErrSavedSearch = errors.New("invalid saved search")
+    // ErrDigestSettings неверный адрес или расписание рассылки, или почта выключена.
+    ErrDigestSettings = errors.New("invalid digest settings")
+    // ErrHighlight пустая или длинная цитата, или ее нет в тексте статьи.
+    ErrHighlight = errors.New("invalid highlight")
+    // ErrNote пустая или длинная заметка.
+    ErrNote = errors.New("invalid note")
+    // ErrExport пустая или слишком большая выборка статей для книги.
+    ErrExport = errors.New("invalid export")
+    // ErrExportBusy уже собирается EXPORT_CONCURRENCY книг.
+    ErrExportBusy = errors.New("too many exports, try later")
+)
 
 type Repository interface {
     Available(ctx context.Context) ([]entity.Feed, error)
-    AddFeed(ctx context.Context, feedUrl string) error
-    Subscribe(ctx context.Context, personPk string, feedPk string) error
+    AddFeed(ctx context.Context, feed entity.Feed) error
+    SetSource(ctx context.Context, feedPk int, kind string, src entity.SourceConfig) error
+    SetProcessors(ctx context.Context, feedPk int, cfgs []entity.ProcessorConfig) error
+    Subscribe(ctx context.Context, personPk string, feedPk string, viewed time.Time) error
     Unsubscribe(ctx context.Context, personPk string, feedPk string) error
-    Article(ctx context.Context, personPk string) ([]entity.Article, error)
+    Article(ctx context.Context, personPk string, f entity.ArticleFilter) ([]entity.Article, error)
+    Search(ctx context.Context, personPk string, f entity.ArticleFilter) ([]entity.Article, error)
+    FeedCategories(ctx context.Context, personPk string, feedPk int) ([]entity.CategoryCount, error)
     Viewed(ctx context.Context, personPk string) error
+    SetMediaSettings(ctx context.Context, s entity.MediaSettings) error
+    Media(ctx context.Context, personPk string, pk int) (entity.MediaJob, error)
+    SetFullContent(ctx context.Context, feedPk int, enabled bool) error
+    Revisions(ctx context.Context, personPk string, articlePk int) ([]entity.Revision, error)
+    Revision(ctx context.Context, personPk string, articlePk int, pk int) (entity.Revision, error)
+    AddArticle(ctx context.Context, batch []entity.Article) []entity.ArticleResult
+    DeadLetters(ctx context.Context, limit int) ([]entity.DeadLetter, error)
+    DeadLetter(ctx context.Context, pk int) (entity.DeadLetter, error)
+    DeleteDeadLetter(ctx context.Context, pk int) error
+    EnqueueRefresh(ctx context.Context, personPk string, feedPk int, backfill bool) (entity.RefreshJob, bool, error)
+    EnqueueRefreshLimited(ctx context.Context, personPk string, feedPk int, cooldown time.Duration, perHour int) (entity.RefreshJob, bool, error)
+    LastRefresh(ctx context.Context, feedPk int) (entity.RefreshJob, error)
+    Refresh(ctx context.Context, personPk string, pk int) (entity.RefreshJob, error)
+    Notifications(ctx context.Context, personPk string) ([]entity.Notification, error)
+    SeenNotifications(ctx context.Context, personPk string) error
+    CreateInbound(ctx context.Context, personPk string, token string, title string) (entity.Inbound, error)
+    Inbounds(ctx context.Context, personPk string) ([]entity.Inbound, error)
+    DeleteInbound(ctx context.Context, personPk string, pk int) error
+    SetApiPassword(ctx context.Context, personPk string, login string, hash string, feverKey string) error
+    Credentials(ctx context.Context, login string) (string, string, error)
+    CreateToken(ctx context.Context, personPk string, tokenHash string) error
+    AccountByToken(ctx context.Context, tokenHash string) (entity.Account, error)
+    AccountByFeverKey(ctx context.Context, key string) (entity.Account, error)
+    CreateSession(ctx context.Context, tokenHash string, s entity.Session) error
+    Session(ctx context.Context, tokenHash string) (entity.Session, error)
+    DeleteSession(ctx context.Context, tokenHash string) error
+    Subscriptions(ctx context.Context, personPk string) ([]entity.Subscription, error)
+    StreamIds(ctx context.Context, personPk string, f entity.StreamFilter) ([]int, error)
+    StreamCount(ctx context.Context, personPk string, f entity.StreamFilter) (int, error)
+    Stream(ctx context.Context, personPk string, f entity.StreamFilter) ([]entity.StreamItem, error)
+    UnreadCounts(ctx context.Context, personPk string) ([]entity.UnreadCount, error)
+    SetState(ctx context.Context, personPk string, pks []int, read *bool, starred *bool) error
+    MarkAllRead(ctx context.Context, personPk string, feedPk int, folderPk int, before time.Time) error
+    CreateFolder(ctx context.Context, personPk string, parentPk int, title string) (entity.Folder, error)
+    Folders(ctx context.Context, personPk string) ([]entity.Folder, error)
+    UpdateFolder(ctx context.Context, personPk string, pk int, parentPk int, title string) error
+    DeleteFolder(ctx context.Context, personPk string, pk int) error
+    SetFolder(ctx context.Context, personPk string, feedPk int, folderPk int) error
+    UpdateSubscription(ctx context.Context, personPk string, feedPk int, p entity.SubscriptionPatch) error
+    CreateRule(ctx context.Context, personPk string, r entity.Rule) (entity.Rule, error)
+    Rules(ctx context.Context, personPk string) ([]entity.Rule, error)
+    Rule(ctx context.Context, personPk string, pk int) (entity.Rule, error)
+    UpdateRule(ctx context.Context, personPk string, pk int, r entity.Rule) error
+    DeleteRule(ctx context.Context, personPk string, pk int) error
+    ApplyRules(ctx context.Context, hits []entity.RuleHit, ruled []int) error
+    CreateSavedSearch(ctx context.Context, personPk string, s entity.SavedSearch) (entity.SavedSearch, error)
+    SavedSearches(ctx context.Context, personPk string) ([]entity.SavedSearch, error)
+    SavedSearch(ctx context.Context, personPk string, pk int) (entity.SavedSearch, error)
+    UpdateSavedSearch(ctx context.Context, personPk string, pk int, s entity.SavedSearch) error
+    DeleteSavedSearch(ctx context.Context, personPk string, pk int) error
+    SavedSearchArticles(ctx context.Context, personPk string, pk int, unread bool, limit int, offset int) ([]entity.Article, error)
+    ViewedSavedSearch(ctx context.Context, personPk string, pk int) error
+    ConfirmAlertEmail(ctx context.Context, personPk string, pk int, codeHash string) error
+    SetDigest(ctx context.Context, personPk string, d entity.Digest) error
+    Digest(ctx context.Context, personPk string) (entity.Digest, error)
+    DeleteDigest(ctx context.Context, personPk string) error
+    ArticleContent(ctx context.Context, articlePk int) (string, string, error)
+    CreateHighlight(ctx context.Context, personPk string, h entity.Highlight) (entity.Highlight, error)
+    Highlight(ctx context.Context, personPk string, pk int) (entity.Highlight, error)
+    Highlights(ctx context.Context, personPk string, f entity.HighlightFilter) ([]entity.Highlight, error)
+    UpdateHighlight(ctx context.Context, personPk string, pk int, h entity.Highlight) error
+    DeleteHighlight(ctx context.Context, personPk string, pk int) error
+    StaleHighlights(ctx context.Context, personPk string, articlePk int) ([]entity.StaleHighlight, error)
+    ReanchorHighlights(ctx context.Context, highlights []entity.Highlight) error
+    CreateNote(ctx context.Context, personPk string, n entity.Note) (entity.Note, error)
+    Notes(ctx context.Context, personPk string, articlePks []int) ([]entity.Note, error)
+    UpdateNote(ctx context.Context, personPk string, pk int, body string) error
+    DeleteNote(ctx context.Context, personPk string, pk int) error
 }
 
 type UseCase struct {
-    repo Repository
+    repo    Repository
+    store   blob.Store
+    refresh config.RefreshConfig
+    mail    config.MailConfig
+    export  config.ExportConfig
+    // client качает картинки для книг, только с публичных адресов
+    client  *http.Client
+    // exports книги в работе, каждая держит картинки в памяти
+    exports chan struct{}
 }
 
-func New(r Repository) *UseCase{
+// New store может быть nil, тогда архивные вложения не отдаются.
+func New(r Repository, store blob.Store, refresh config.RefreshConfig, mail config.MailConfig, export config.ExportConfig) *UseCase{
     return &UseCase{
-        repo: r,
+        repo:    r,
+        store:   store,
+        refresh: refresh,
+        mail:    mail,
+        export:  export,
+        client:  safehttp.Client(export.ImageTimeout),
+        exports: make(chan struct{}, max(export.Concurrency, 1)),
     }
 }
 
@@ -31,14 +164,58 @@ func (uc *UseCase) Available(ctx context.Context) ([]entity.Feed, error) {
     return uc.repo.Available(ctx)
 }
 
-// AddFeed добавляет новый RSS источник.
-func (uc *UseCase) AddFeed(ctx context.Context, feedUrl string) error {
-    return uc.repo.AddFeed(ctx, feedUrl)
+// AddFeed добавляет новый источник, без Kind это rss.
+func (uc *UseCase) AddFeed(ctx context.Context, feed entity.Feed) error {
+    if feed.Kind == "" {
+        feed.Kind = entity.FeedKindRss
+    }
+    if err := validateSource(feed.Kind, feed.Source); err != nil {
+        return err
+    }
+    return uc.repo.AddFeed(ctx, feed)
 }
 
-// Subscribe подписывает пользователя на RSS канал.
-func (uc *UseCase) Subscribe(ctx context.Context, personPk string, feedPk string) error {
-    return uc.repo.Subscribe(ctx, personPk, feedPk)
+// SetSource меняет вид источника канала и его разметку.
+func (uc *UseCase) SetSource(ctx context.Context, feedPk int, kind string, src entity.SourceConfig) error {
+    if err := validateSource(kind, src); err != nil {
+        return err
+    }
+    return uc.repo.SetSource(ctx, feedPk, kind, src)
+}
+
+// SetProcessors меняет цепочку процессоров статей канала.
+func (uc *UseCase) SetProcessors(ctx context.Context, feedPk int, cfgs []entity.ProcessorConfig) error {
+    if err := processor.Validate(cfgs); err != nil {
+        return fmt.Errorf("%w: %v", ErrProcessorConfig, err)
+    }
+    return uc.repo.SetProcessors(ctx, feedPk, cfgs)
+}
+
+// validateSource html без селектора item и json без пути item разобрать нечем.
+func validateSource(kind string, src entity.SourceConfig) error {
+    switch kind {
+    case entity.FeedKindRss, entity.FeedKindSitemap, entity.FeedKindJson:
+        return nil
+    case entity.FeedKindHtml:
+        if src.Item == "" {
+            return fmt.Errorf("%w: html requires item selector", ErrSourceConfig)
+        }
+        return nil
+    }
+    return fmt.Errorf("%w: unknown kind %q", ErrSourceConfig, kind)
+}
+
+// Subscribe подписывает пользователя на RSS канал,
+// history сколько истории показать: none, all или число дней, по умолчанию месяц.
+func (uc *UseCase) Subscribe(ctx context.Context, personPk string, feedPk string, history string) error {
+    if history == "" {
+        history = defaultHistory
+    }
+    viewed, err := historyViewed(history)
+    if err != nil {
+        return err
+    }
+    return uc.repo.Subscribe(ctx, personPk, feedPk, viewed)
 }
 
 // Unsubscribe отписывает пользователя на RSS канал.
@@ -48,11 +225,16 @@ func (uc *UseCase) Unsubscribe(ctx context.Context, personPk string, feedPk stri
 
 // Article возвращает список статей для пользователя
 // и обновляет дату последнего просмотра у пользователя.
-func (uc *UseCase) Article(ctx context.Context, personPk string) ([]entity.Article, error) {
-    entities, err := uc.repo.Article(ctx, personPk)
+// С фильтром дата просмотра не обновляется,
+// иначе статьи не попавшие в фильтр перестанут быть новыми.
+func (uc *UseCase) Article(ctx context.Context, personPk string, f entity.ArticleFilter) ([]entity.Article, error) {
+    entities, err := uc.repo.Article(ctx, personPk, f)
     if err != nil {
 		return nil, err
 	}
+    if !f.IsZero() {
+        return entities, nil
+    }
     // обновляет дату последнего просмотра новостей пользователем
     // на практике это должно инициироваться с фронтенда 
     // после фактического просмотра пользователем.
@@ -60,4 +242,187 @@ func (uc *UseCase) Article(ctx context.Context, personPk string) ([]entity.Artic
 		return nil, err
 	}
     return entities, nil
-}
\ No newline at end of file
+}
+// SetMediaSettings обновляет настройки архивирования медиа канала.
+func (uc *UseCase) SetMediaSettings(ctx context.Context, s entity.MediaSettings) error {
+    return uc.repo.SetMediaSettings(ctx, s)
+}
+
+// Media открывает архивное вложение из хранилища.
+func (uc *UseCase) Media(ctx context.Context, personPk string, pk int) (io.ReadCloser, entity.MediaJob, error) {
+    if uc.store == nil {
+        return nil, entity.MediaJob{}, blob.ErrDisabled
+    }
+    job, err := uc.repo.Media(ctx, personPk, pk)
+    if err != nil {
+        return nil, job, err
+    }
+    r, err := uc.store.Get(ctx, job.BlobKey)
+    if err != nil {
+        return nil, job, err
+    }
+    return r, job, nil
+}
+
+// Search ищет статьи по всем подписанным каналам.
+func (uc *UseCase) Search(ctx context.Context, personPk string, f entity.ArticleFilter) ([]entity.Article, error) {
+    return uc.repo.Search(ctx, personPk, f)
+}
+
+// FeedCategories возвращает категории статей канала из подписок пользователя.
+func (uc *UseCase) FeedCategories(ctx context.Context, personPk string, feedPk int) ([]entity.CategoryCount, error) {
+    return uc.repo.FeedCategories(ctx, personPk, feedPk)
+}
+
+// SetFullContent включает или выключает извлечение полного текста для канала.
+func (uc *UseCase) SetFullContent(ctx context.Context, feedPk int, enabled bool) error {
+    return uc.repo.SetFullContent(ctx, feedPk, enabled)
+}
+
+// Revisions возвращает историю версий статьи из подписок пользователя.
+func (uc *UseCase) Revisions(ctx context.Context, personPk string, articlePk int) ([]entity.Revision, error) {
+    return uc.repo.Revisions(ctx, personPk, articlePk)
+}
+
+// RevisionDiff возвращает разницу между версиями статьи,
+// без from и to между предпоследней и последней версией.
+func (uc *UseCase) RevisionDiff(ctx context.Context, personPk string, articlePk int, from int, to int) (entity.RevisionDiff, error) {
+    if from == 0 && to == 0 {
+        revisions, err := uc.repo.Revisions(ctx, personPk, articlePk)
+        if err != nil {
+            return entity.RevisionDiff{}, err
+        }
+        if len(revisions) < 2 {
+            return entity.RevisionDiff{}, ErrNothingToCompare
+        }
+        from, to = revisions[1].Pk, revisions[0].Pk
+    }
+
+    a, err := uc.repo.Revision(ctx, personPk, articlePk, from)
+    if err != nil {
+        return entity.RevisionDiff{}, err
+    }
+    b, err := uc.repo.Revision(ctx, personPk, articlePk, to)
+    if err != nil {
+        return entity.RevisionDiff{}, err
+    }
+    return entity.RevisionDiff{
+        From:    a.Pk,
+        To:      b.Pk,
+        Title:   diff.Text(a.Title, b.Title),
+        Content: diff.Text(a.Content, b.Content),
+    }, nil
+}
+
+// DeadLetters возвращает очередь статей, которые не удалось записать.
+func (uc *UseCase) DeadLetters(ctx context.Context, limit int) ([]entity.DeadLetter, error) {
+    return uc.repo.DeadLetters(ctx, limit)
+}
+
+// ReplayDeadLetter повторяет запись статьи из очереди,
+// при успехе AddArticle сам убирает ее из очереди.
+func (uc *UseCase) ReplayDeadLetter(ctx context.Context, pk int) (entity.ArticleResult, error) {
+    d, err := uc.repo.DeadLetter(ctx, pk)
+    if err != nil {
+        return entity.ArticleResult{}, err
+    }
+    results := uc.repo.AddArticle(ctx, []entity.Article{d.Article})
+    return results[0], nil
+}
+
+// DeleteDeadLetter убирает статью из очереди без повтора.
+func (uc *UseCase) DeleteDeadLetter(ctx context.Context, pk int) error {
+    return uc.repo.DeleteDeadLetter(ctx, pk)
+}
+
+// Refresh ставит канал на внеочередное обновление,
+// если задача на канал уже в очереди или в работе, возвращает ее и false.
+func (uc *UseCase) Refresh(ctx context.Context, personPk string, feedPk int) (entity.RefreshJob, bool, error) {
+    // лимиты проверяются в одном запросе со вставкой, здесь только причина отказа
+    job, created, err := uc.repo.EnqueueRefreshLimited(ctx, personPk, feedPk, uc.refresh.Cooldown, uc.refresh.PerHour)
+    if err != nil || created {
+        return job, created, err
+    }
+    last, err := uc.repo.LastRefresh(ctx, feedPk)
+    switch {
+    case err != nil:
+        return last, false, err
+    case last.Status == entity.RefreshQueued || last.Status == entity.RefreshRunning:
+        return last, false, nil
+    case last.Pk != 0 && time.Since(last.Created) < uc.refresh.Cooldown:
+        return last, false, ErrRefreshTooSoon
+    }
+    return entity.RefreshJob{}, false, ErrRefreshLimit
+}
+
+// Backfill ставит канал на обновление вместе со страницами истории,
+// запрос администратора идет без лимитов Refresh.
+// Если задача на канал уже в очереди или в работе, возвращает ее и false.
+func (uc *UseCase) Backfill(ctx context.Context, personPk string, feedPk int) (entity.RefreshJob, bool, error) {
+    last, err := uc.repo.LastRefresh(ctx, feedPk)
+    if err != nil {
+        return last, false, err
+    }
+    if last.Status == entity.RefreshQueued || last.Status == entity.RefreshRunning {
+        return last, false, nil
+    }
+
+    job, created, err := uc.repo.EnqueueRefresh(ctx, personPk, feedPk, true)
+    if err != nil || created {
+        return job, created, err
+    }
+    // задачу на канал успели поставить между проверкой и вставкой
+    last, err = uc.repo.LastRefresh(ctx, feedPk)
+    return last, false, err
+}
+
+// RefreshStatus возвращает задачу обновления канала, поставленную пользователем или на его подписку.
+func (uc *UseCase) RefreshStatus(ctx context.Context, personPk string, pk int) (entity.RefreshJob, error) {
+    return uc.repo.Refresh(ctx, personPk, pk)
+}
+
+// Notifications возвращает непрочитанные уведомления пользователя.
+func (uc *UseCase) Notifications(ctx context.Context, personPk string) ([]entity.Notification, error) {
+    return uc.repo.Notifications(ctx, personPk)
+}
+
+// SeenNotifications отмечает уведомления пользователя прочитанными.
+func (uc *UseCase) SeenNotifications(ctx context.Context, personPk string) error {
+    return uc.repo.SeenNotifications(ctx, personPk)
+}
+
+// CreateInbound выдает пользователю новый адрес для рассылок.
+// Адрес случайный, чтобы его нельзя было подобрать и засыпать канал чужими письмами.
+func (uc *UseCase) CreateInbound(ctx context.Context, personPk string, title string) (entity.Inbound, error) {
+    token := make([]byte, 10)
+    if _, err := rand.Read(token); err != nil {
+        return entity.Inbound{}, err
+    }
+    in, err := uc.repo.CreateInbound(ctx, personPk, hex.EncodeToString(token), title)
+    if err != nil {
+        return in, err
+    }
+    in.Address = uc.inboundAddress(in.Token)
+    return in, nil
+}
+
+// Inbounds возвращает адреса для рассылок пользователя.
+func (uc *UseCase) Inbounds(ctx context.Context, personPk string) ([]entity.Inbound, error) {
+    entities, err := uc.repo.Inbounds(ctx, personPk)
+    if err != nil {
+        return nil, err
+    }
+    for i := range entities {
+        entities[i].Address = uc.inboundAddress(entities[i].Token)
+    }
+    return entities, nil
+}
+
+// DeleteInbound удаляет адрес для рассылок пользователя.
+func (uc *UseCase) DeleteInbound(ctx context.Context, personPk string, pk int) error {
+    return uc.repo.DeleteInbound(ctx, personPk, pk)
+}
+
+func (uc *UseCase) inboundAddress(token string) string {
+    return token + "@" + uc.mail.Domain
+}